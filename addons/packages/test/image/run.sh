@@ -0,0 +1,34 @@
+#!/bin/bash
+
+# Copyright 2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+# SPDX-License-Identifier: Apache-2.0
+
+# Verifies an installed TCE package as a Sonobuoy plugin. The JUnit results
+# and the log of the suite are written to the results directory, then their
+# path is written to the done file Sonobuoy waits for.
+
+set -o nounset
+set -o pipefail
+
+RESULTS_DIR="${RESULTS_DIR:-/tmp/sonobuoy/results}"
+SERVICE_ACCOUNT_DIR=/var/run/secrets/kubernetes.io/serviceaccount
+
+mkdir -p "${RESULTS_DIR}"
+
+# point kubectl at the cluster, with the service account of the plugin
+if [[ -z "${KUBECONFIG:-}" && -f "${SERVICE_ACCOUNT_DIR}/token" ]]; then
+    export KUBECONFIG=/tmp/kubeconfig
+    kubectl config set-cluster sonobuoy --server="https://${KUBERNETES_SERVICE_HOST}:${KUBERNETES_SERVICE_PORT}" \
+        --certificate-authority="${SERVICE_ACCOUNT_DIR}/ca.crt" --embed-certs=true > /dev/null
+    kubectl config set-credentials sonobuoy --token="$(cat "${SERVICE_ACCOUNT_DIR}/token")" > /dev/null
+    kubectl config set-context sonobuoy --cluster=sonobuoy --user=sonobuoy > /dev/null
+    kubectl config use-context sonobuoy > /dev/null
+fi
+
+/suite/suite.test -test.v -test.timeout=0 -ginkgo.v -ginkgo.noColor 2>&1 \
+    | tee "${RESULTS_DIR}/suite.log" \
+    | go-junit-report > "${RESULTS_DIR}/junit.xml"
+
+# the done file is written even when the suite fails, for Sonobuoy to collect its results
+tar -czf "${RESULTS_DIR}/results.tar.gz" -C "${RESULTS_DIR}" junit.xml suite.log
+echo -n "${RESULTS_DIR}/results.tar.gz" > "${RESULTS_DIR}/done"
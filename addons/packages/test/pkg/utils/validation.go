@@ -55,6 +55,26 @@ func ValidatePackageInstallReady(namespace, name string) {
 	}, DeploymentTimeout, DeploymentCheckInterval).Should(gomega.Equal("True"), fmt.Sprintf("%s/%s packageinstalls was never ready", namespace, name))
 }
 
+func ValidateStatefulSetReady(namespace, name string) {
+	gomega.EventuallyWithOffset(1, func() (bool, error) {
+		replicas, err := Kubectl(nil, "-n", namespace, "get", "statefulset", name, "-o", "jsonpath={.spec.replicas}")
+		if err != nil {
+			return false, err
+		}
+		readyReplicas, err := Kubectl(nil, "-n", namespace, "get", "statefulset", name, "-o", "jsonpath={.status.readyReplicas}")
+		if err != nil {
+			return false, err
+		}
+		return replicas == readyReplicas, nil
+	}, DeploymentTimeout, DeploymentCheckInterval).Should(gomega.Equal(true), fmt.Sprintf("%s/%s statefulset was never ready", namespace, name))
+}
+
+func ValidateAppReady(namespace, name string) {
+	gomega.EventuallyWithOffset(1, func() (string, error) {
+		return Kubectl(nil, "-n", namespace, "get", "apps.kappctrl.k14s.io", name, "-o", "jsonpath={.status.conditions[?(@.type == 'ReconcileSucceeded')].status}")
+	}, DeploymentTimeout, DeploymentCheckInterval).Should(gomega.Equal("True"), fmt.Sprintf("%s/%s app was never ready", namespace, name))
+}
+
 func ValidateDeploymentNotFound(namespace, name string) {
 	gomega.Eventually(func() error {
 		_, err := Kubectl(nil, "-n", namespace, "get", "deployment", name)
@@ -0,0 +1,55 @@
+// Copyright 2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// package verify_test implements verifying a package installed in a cluster.
+// It is run for every installed TCE package by the tce-packages profile of
+// tanzu conformance, and only reads the cluster: the package install and the
+// workloads of the package are left as they are.
+package verify_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestPackageVerify(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Installed Package Verification Suite")
+}
+
+var (
+	// packageName is the name of the verified package, e.g.
+	// external-dns.community.tanzu.vmware.com. Provided by using the
+	// PACKAGE_NAME env var.
+	packageName string
+
+	// packageVersion is the installed version of the package. Provided by
+	// using the PACKAGE_VERSION env var.
+	packageVersion string
+
+	// packageInstallName is the name of the package install of the package.
+	// Provided by using the PACKAGE_INSTALL_NAME env var.
+	packageInstallName string
+
+	// packageInstallNamespace is the namespace of the package install of the
+	// package. Provided by using the PACKAGE_INSTALL_NAMESPACE env var.
+	packageInstallNamespace string
+)
+
+var _ = BeforeSuite(func() {
+	packageName = requiredEnv("PACKAGE_NAME")
+	packageVersion = requiredEnv("PACKAGE_VERSION")
+	packageInstallName = requiredEnv("PACKAGE_INSTALL_NAME")
+	packageInstallNamespace = requiredEnv("PACKAGE_INSTALL_NAMESPACE")
+	fmt.Fprintf(GinkgoWriter, "Info: verifying package install %s/%s of %s, version %s.\n", packageInstallNamespace, packageInstallName, packageName, packageVersion)
+})
+
+func requiredEnv(name string) string {
+	value := os.Getenv(name)
+	ExpectWithOffset(1, value).NotTo(BeEmpty(), fmt.Sprintf("%s is not set", name))
+	return value
+}
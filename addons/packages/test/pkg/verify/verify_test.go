@@ -0,0 +1,65 @@
+// Copyright 2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// package verify_test implements verifying a package installed in a cluster
+package verify_test
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/vmware-tanzu/community-edition/addons/packages/test/pkg/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// appLabelKey is the label kapp sets on the resources of an app
+const appLabelKey = "kapp.k14s.io/app"
+
+var _ = Describe("Installed package", func() {
+	It("installs the package and version under test", func() {
+		refName, err := utils.Kubectl(nil, "-n", packageInstallNamespace, "get", "packageinstall", packageInstallName, "-o", "jsonpath={.spec.packageRef.refName}")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refName).To(Equal(packageName))
+
+		version, err := utils.Kubectl(nil, "-n", packageInstallNamespace, "get", "packageinstall", packageInstallName, "-o", "jsonpath={.status.version}")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal(packageVersion))
+	})
+
+	It("is reconciled", func() {
+		By("validating the package install is reconciled")
+		utils.ValidatePackageInstallReady(packageInstallNamespace, packageInstallName)
+
+		By("validating the app of the package install is reconciled")
+		utils.ValidateAppReady(packageInstallNamespace, packageInstallName)
+	})
+
+	It("has its workloads ready", func() {
+		// kapp records the label of the resources of the app in the
+		// <app>-ctrl config map of the app
+		spec, err := utils.Kubectl(nil, "-n", packageInstallNamespace, "get", "configmap", packageInstallName+"-ctrl", "-o", "jsonpath={.data.spec}")
+		Expect(err).NotTo(HaveOccurred())
+		meta := struct {
+			LabelValue string `json:"labelValue"`
+		}{}
+		Expect(json.Unmarshal([]byte(spec), &meta)).To(Succeed())
+		Expect(meta.LabelValue).NotTo(BeEmpty())
+		selector := appLabelKey + "=" + meta.LabelValue
+
+		for kind, validate := range map[string]func(namespace, name string){
+			"deployments":  utils.ValidateDeploymentReady,
+			"daemonsets":   utils.ValidateDaemonsetReady,
+			"statefulsets": utils.ValidateStatefulSetReady,
+		} {
+			workloads, listErr := utils.Kubectl(nil, "get", kind, "--all-namespaces", "-l", selector, "-o", `jsonpath={range .items[*]}{.metadata.namespace}/{.metadata.name}{"\n"}{end}`)
+			Expect(listErr).NotTo(HaveOccurred())
+			for _, workload := range strings.Fields(workloads) {
+				By("validating " + kind + " " + workload + " is ready")
+				parts := strings.SplitN(workload, "/", 2)
+				validate(parts[0], parts[1])
+			}
+		}
+	})
+})
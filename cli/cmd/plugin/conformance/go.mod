@@ -4,8 +4,12 @@ go 1.16
 
 require (
 	github.com/spf13/cobra v1.2.1
+	github.com/spf13/pflag v1.0.5
 	github.com/vmware-tanzu/sonobuoy v0.53.2
 	github.com/vmware-tanzu/tanzu-framework v0.10.0
+	k8s.io/apimachinery v0.21.3
+	k8s.io/client-go v0.21.3
 	k8s.io/klog/v2 v2.9.0 // indirect
 	sigs.k8s.io/controller-runtime v0.9.0 // indirect
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -46,6 +46,10 @@ func main() {
 		conformance.StatusCmd,
 		conformance.ResultsCmd,
 		conformance.GenCmd,
+		conformance.HistoryCmd,
+		conformance.DiffCmd,
+		conformance.ReportCmd,
+		conformance.ImagesCmd,
 	)
 
 	// Remove the generated version command and replace it with ours,
@@ -0,0 +1,112 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/cli/component"
+)
+
+// diffOptions are the options of the diff command
+type diffOptions struct {
+	outputFormat string
+}
+
+var dfo = diffOptions{}
+
+// DiffCmd compares the results of two runs of the results store
+var DiffCmd = &cobra.Command{
+	Use:   "diff <run A> <run B>",
+	Short: "Compare the results of two runs",
+	Long: `Compare the results of two runs of the results history, listing
+the tests newly failing, newly passing and newly skipped in run B`,
+	Args: cobra.ExactArgs(2),
+	RunE: diff,
+}
+
+func init() {
+	DiffCmd.Flags().StringVarP(&dfo.outputFormat, "output", "o", "", "Output format (table, json or yaml)")
+}
+
+const (
+	changeNewlyFailing = "newly failing"
+	changeNewlyPassing = "newly passing"
+	changeNewlySkipped = "newly skipped"
+)
+
+// testChange is a test whose status changed between two runs
+type testChange struct {
+	change string
+	before string
+	after  testResult
+}
+
+func diff(cmd *cobra.Command, args []string) error {
+	if err := validateOutputFormat(dfo.outputFormat); err != nil {
+		return err
+	}
+	runA, err := loadRun(args[0])
+	if err != nil {
+		return err
+	}
+	runB, err := loadRun(args[1])
+	if err != nil {
+		return err
+	}
+
+	changes := diffRuns(runA, runB)
+	if len(changes) == 0 && (dfo.outputFormat == "" || dfo.outputFormat == string(component.TableOutputType)) {
+		fmt.Fprintf(cmd.OutOrStdout(), "No changes between runs %s and %s\n", runA.ID, runB.ID)
+		return nil
+	}
+
+	t := component.NewOutputWriter(cmd.OutOrStdout(), dfo.outputFormat, "CHANGE", "PLUGIN", "TEST", "BEFORE", "AFTER")
+	for _, c := range changes {
+		t.AddRow(c.change, c.after.Plugin, c.after.Name, c.before, c.after.Status)
+	}
+	t.Render()
+	return nil
+}
+
+// diffRuns returns the tests of run B newly failing, newly passing and newly
+// skipped since run A, in this order. Tests missing from run A are compared
+// against a missing status.
+func diffRuns(runA, runB *runRecord) []testChange {
+	before := make(map[testResult]string, len(runA.Tests))
+	for _, test := range runA.Tests {
+		before[testResult{Plugin: test.Plugin, Name: test.Name}] = test.Status
+	}
+
+	changes := map[string][]testChange{}
+	for _, test := range runB.Tests {
+		status := before[testResult{Plugin: test.Plugin, Name: test.Name}]
+		if status == test.Status {
+			continue
+		}
+		var change string
+		switch test.Status {
+		case statusFailed:
+			change = changeNewlyFailing
+		case statusPassed:
+			change = changeNewlyPassing
+		case statusSkipped:
+			change = changeNewlySkipped
+		default:
+			continue
+		}
+		if status == "" {
+			status = "missing"
+		}
+		changes[change] = append(changes[change], testChange{change: change, before: status, after: test})
+	}
+
+	var ordered []testChange
+	for _, change := range []string{changeNewlyFailing, changeNewlyPassing, changeNewlySkipped} {
+		ordered = append(ordered, changes[change]...)
+	}
+	return ordered
+}
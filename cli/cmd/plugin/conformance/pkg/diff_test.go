@@ -0,0 +1,49 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffRuns(t *testing.T) {
+	runA := &runRecord{ID: "a", Tests: []testResult{
+		{Plugin: "e2e", Name: "still passing", Status: statusPassed},
+		{Plugin: "e2e", Name: "now failing", Status: statusPassed},
+		{Plugin: "e2e", Name: "now passing", Status: statusFailed},
+		{Plugin: "e2e", Name: "now skipped", Status: statusPassed},
+		{Plugin: "e2e", Name: "removed", Status: statusFailed},
+		{Plugin: "systemd-logs", Name: "now failing", Status: statusFailed},
+	}}
+	runB := &runRecord{ID: "b", Tests: []testResult{
+		{Plugin: "e2e", Name: "now skipped", Status: statusSkipped},
+		{Plugin: "e2e", Name: "now passing", Status: statusPassed},
+		{Plugin: "e2e", Name: "still passing", Status: statusPassed},
+		{Plugin: "e2e", Name: "now failing", Status: statusFailed, Message: "timeout"},
+		{Plugin: "e2e", Name: "added", Status: statusFailed},
+		{Plugin: "e2e", Name: "unknown status", Status: "unknown"},
+		{Plugin: "systemd-logs", Name: "now failing", Status: statusFailed},
+	}}
+
+	want := []testChange{
+		{change: changeNewlyFailing, before: statusPassed, after: runB.Tests[3]},
+		{change: changeNewlyFailing, before: "missing", after: runB.Tests[4]},
+		{change: changeNewlyPassing, before: statusFailed, after: runB.Tests[1]},
+		{change: changeNewlySkipped, before: statusPassed, after: runB.Tests[0]},
+	}
+	if got := diffRuns(runA, runB); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected changes %+v, got %+v", want, got)
+	}
+}
+
+func TestDiffRunsUnchanged(t *testing.T) {
+	run := &runRecord{ID: "a", Tests: []testResult{
+		{Plugin: "e2e", Name: "passing", Status: statusPassed},
+		{Plugin: "e2e", Name: "failing", Status: statusFailed},
+	}}
+	if changes := diffRuns(run, run); len(changes) != 0 {
+		t.Errorf("expected no changes between identical runs, got %+v", changes)
+	}
+}
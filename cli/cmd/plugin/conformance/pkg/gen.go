@@ -7,4 +7,4 @@ import (
 	"github.com/vmware-tanzu/sonobuoy/cmd/sonobuoy/app"
 )
 
-var GenCmd = app.NewCmdGen()
+var GenCmd = withRegistry(withProfiles(app.NewCmdGen()))
@@ -0,0 +1,143 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/cli/component"
+)
+
+type historyOptions struct {
+	outputFormat string
+}
+
+var ho = historyOptions{}
+
+// HistoryCmd lists the runs of the results store
+var HistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the results of past runs",
+	Long: `List the results of past runs, recorded in the results store
+when they are retrieved`,
+	Args: cobra.NoArgs,
+	RunE: history,
+}
+
+func init() {
+	HistoryCmd.Flags().StringVarP(&ho.outputFormat, "output", "o", "", "Output format (table, json or yaml)")
+}
+
+func history(cmd *cobra.Command, _ []string) error {
+	if err := validateOutputFormat(ho.outputFormat); err != nil {
+		return err
+	}
+	runs, err := listRuns()
+	if err != nil {
+		return err
+	}
+
+	t := component.NewOutputWriter(cmd.OutOrStdout(), ho.outputFormat, "ID", "RETRIEVED", "TCE", "KUBERNETES", "PASSED", "FAILED", "SKIPPED")
+	for _, run := range runs {
+		tceVersion := run.TCEVersion
+		if tceVersion == "" {
+			tceVersion = "unknown"
+		}
+		t.AddRow(run.ID, run.Retrieved.Format(time.RFC3339), tceVersion, run.KubernetesVersion, run.Passed, run.Failed, run.Skipped)
+	}
+	t.Render()
+	return nil
+}
+
+// validateOutputFormat checks the output format is supported by component.NewOutputWriter
+func validateOutputFormat(outputFormat string) error {
+	switch component.OutputType(outputFormat) {
+	case "", component.TableOutputType, component.JSONOutputType, component.YAMLOutputType:
+		return nil
+	}
+	return fmt.Errorf("unsupported output format %q: must be one of table, json or yaml", outputFormat)
+}
+
+// withHistory records the results retrieved by a Sonobuoy retrieve command
+// in the results store
+func withHistory(cmd *cobra.Command) *cobra.Command {
+	var tceVersion string
+	addTCEVersionFlag(cmd, &tceVersion)
+
+	var start time.Time
+	preRunE, preRun := cmd.PreRunE, cmd.PreRun
+	postRunE, postRun := cmd.PostRunE, cmd.PostRun
+
+	cmd.PreRun = nil
+	cmd.PreRunE = func(c *cobra.Command, args []string) error {
+		// the modification times of files may be truncated to the second
+		start = time.Now().Truncate(time.Second)
+		if preRunE != nil {
+			return preRunE(c, args)
+		}
+		if preRun != nil {
+			preRun(c, args)
+		}
+		return nil
+	}
+
+	cmd.PostRun = nil
+	cmd.PostRunE = func(c *cobra.Command, args []string) error {
+		if postRunE != nil {
+			if err := postRunE(c, args); err != nil {
+				return err
+			}
+		} else if postRun != nil {
+			postRun(c, args)
+		}
+		recordRetrievedRuns(c, args, start, tceVersion)
+		return nil
+	}
+	return cmd
+}
+
+// addTCEVersionFlag adds the --tce-version flag to a command recording runs
+// in the results store. The TCE version of a cluster is not recorded in the
+// cluster: it is set by the user, and is not recorded when it is not set.
+func addTCEVersionFlag(cmd *cobra.Command, tceVersion *string) {
+	cmd.Flags().StringVar(tceVersion, "tce-version", "", "TCE version of the cluster of the run, recorded in the results history")
+}
+
+// recordRetrievedRuns records the tarballs written by a retrieve command in
+// the results store, with the TCE version of the cluster of the run. Failing
+// to record them does not fail the command, as the results were retrieved.
+func recordRetrievedRuns(cmd *cobra.Command, args []string, start time.Time, tceVersion string) {
+	if flag := cmd.Flags().Lookup("extract"); flag != nil && flag.Value.String() == "true" {
+		fmt.Fprintln(os.Stderr, "Extracted results are not recorded in the results history")
+		return
+	}
+
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	tarballs, err := filepath.Glob(filepath.Join(dir, "*.tar.gz"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot record the results in the results history: %v\n", err)
+		return
+	}
+
+	for _, tarball := range tarballs {
+		info, statErr := os.Stat(tarball)
+		if statErr != nil || info.ModTime().Before(start) {
+			continue
+		}
+		run, saveErr := saveRun(tarball, tceVersion)
+		if saveErr != nil {
+			fmt.Fprintf(os.Stderr, "Cannot record %s in the results history: %v\n", tarball, saveErr)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Recorded results as run %s: %d passed, %d failed, %d skipped\n", run.ID, run.Passed, run.Failed, run.Skipped)
+	}
+}
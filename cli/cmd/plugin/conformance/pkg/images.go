@@ -0,0 +1,423 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/yaml"
+
+	"github.com/vmware-tanzu/sonobuoy/pkg/buildinfo"
+	"github.com/vmware-tanzu/sonobuoy/pkg/config"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/cli/component"
+)
+
+const (
+	// defaultSonobuoyRepo is the repository of the image of the Sonobuoy
+	// aggregator, tagged with the Sonobuoy version
+	defaultSonobuoyRepo = "sonobuoy/sonobuoy"
+	// defaultConformanceRepo is the repository of the image of the e2e
+	// plugin, tagged with the Kubernetes version of the cluster
+	defaultConformanceRepo = "k8s.gcr.io/conformance"
+	// e2eTestBinary is the binary of the e2e tests in the conformance image
+	e2eTestBinary = "/usr/local/bin/e2e.test"
+)
+
+// e2eRegistries are the registries of the images of the Kubernetes e2e tests,
+// by the keys of the e2e repo config of Sonobuoy
+var e2eRegistries = []struct{ key, registry string }{
+	{"dockerLibraryRegistry", "docker.io/library"},
+	{"dockerGluster", "docker.io/gluster"},
+	{"e2eRegistry", "gcr.io/kubernetes-e2e-test-images"},
+	{"e2eVolumeRegistry", "gcr.io/kubernetes-e2e-test-images/volume"},
+	{"promoterE2eRegistry", "k8s.gcr.io/e2e-test-images"},
+	{"buildImageRegistry", "k8s.gcr.io/build-image"},
+	{"gcEtcdRegistry", "k8s.gcr.io"},
+	{"gcRegistry", "k8s.gcr.io"},
+	{"sigStorageRegistry", "k8s.gcr.io/sig-storage"},
+	{"gcrReleaseRegistry", "gcr.io/gke-release"},
+	{"sampleRegistry", "gcr.io/google-samples"},
+	{"microsoftRegistry", "mcr.microsoft.com"},
+}
+
+// unmirroredRegistries are the registries of the e2e tests of invalid and
+// authenticated registries, whose images are not mirrored
+var unmirroredRegistries = []string{
+	"invalid.com/invalid",
+	"gcr.io/authenticated-image-pulling",
+	"gcr.io/k8s-authenticated-test",
+}
+
+type imagesOptions struct {
+	registry          string
+	kubernetesVersion string
+	kubeconfig        string
+	context           string
+	packageTests      bool
+	packageTestRepo   string
+	outputFormat      string
+}
+
+var imo = imagesOptions{}
+
+// ImagesCmd manages the images of conformance runs, to mirror them to a
+// private registry
+var ImagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "Manage the images of conformance runs",
+	Long: `Manage the images of conformance runs: the Sonobuoy images, the
+conformance image and the images of the e2e tests for the Kubernetes version
+of the cluster, and the image verifying the installed TCE packages`,
+}
+
+var imagesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the images of conformance runs",
+	Args:  cobra.NoArgs,
+	RunE:  listImages,
+}
+
+var imagesPullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "Pull the images of conformance runs with Docker",
+	Args:  cobra.NoArgs,
+	RunE:  pullImages,
+}
+
+var imagesPushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "Push the images of conformance runs to a registry mirror with Docker",
+	Args:  cobra.NoArgs,
+	RunE:  pushImages,
+}
+
+func init() {
+	ImagesCmd.PersistentFlags().StringVar(&imo.registry, "registry", "", "Registry mirror of the images, replacing the registry of every image")
+	ImagesCmd.PersistentFlags().StringVar(&imo.kubernetesVersion, "kubernetes-version", "", "Kubernetes version of the e2e tests, the version of the cluster by default")
+	ImagesCmd.PersistentFlags().StringVar(&imo.kubeconfig, "kubeconfig", "", "Path to the kubeconfig of the cluster")
+	ImagesCmd.PersistentFlags().StringVar(&imo.context, "context", "", "Context of the cluster in the kubeconfig")
+	ImagesCmd.PersistentFlags().BoolVar(&imo.packageTests, "package-tests", false, "Include the image verifying the installed TCE packages, used by the tce-packages profile")
+	ImagesCmd.PersistentFlags().StringVar(&imo.packageTestRepo, "package-test-image-repo", defaultPackageTestImageRepo, "Repository of the image verifying the installed TCE packages")
+	imagesListCmd.Flags().StringVarP(&imo.outputFormat, "output", "o", "", "Output format (table, json or yaml)")
+
+	ImagesCmd.AddCommand(imagesListCmd, imagesPullCmd, imagesPushCmd)
+}
+
+func listImages(cmd *cobra.Command, _ []string) error {
+	if err := validateOutputFormat(imo.outputFormat); err != nil {
+		return err
+	}
+	images, err := conformanceImages(cmd)
+	if err != nil {
+		return err
+	}
+
+	t := component.NewOutputWriter(cmd.OutOrStdout(), imo.outputFormat, "IMAGE", "MIRROR")
+	for _, image := range images {
+		mirror := ""
+		if imo.registry != "" {
+			mirror = mirrorImage(image, imo.registry)
+		}
+		t.AddRow(image, mirror)
+	}
+	t.Render()
+	return nil
+}
+
+func pullImages(cmd *cobra.Command, _ []string) error {
+	images, err := conformanceImages(cmd)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, image := range images {
+		fmt.Fprintf(os.Stderr, "Pulling %s\n", image)
+		if pullErr := runDocker("pull", image); pullErr != nil {
+			fmt.Fprintln(os.Stderr, pullErr)
+			failed = append(failed, image)
+		}
+	}
+	return imagesError("pull", failed, len(images))
+}
+
+func pushImages(cmd *cobra.Command, _ []string) error {
+	if imo.registry == "" {
+		return fmt.Errorf("no registry mirror specified: set --registry")
+	}
+	images, err := conformanceImages(cmd)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, image := range images {
+		mirror := mirrorImage(image, imo.registry)
+		fmt.Fprintf(os.Stderr, "Pushing %s to %s\n", image, mirror)
+		for _, args := range [][]string{{"pull", image}, {"tag", image, mirror}, {"push", mirror}} {
+			if dockerErr := runDocker(args...); dockerErr != nil {
+				fmt.Fprintln(os.Stderr, dockerErr)
+				failed = append(failed, image)
+				break
+			}
+		}
+	}
+	return imagesError("push", failed, len(images))
+}
+
+func imagesError(operation string, failed []string, total int) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("failed to %s %d of %d images:\n%s", operation, len(failed), total, strings.Join(failed, "\n"))
+}
+
+// runDocker runs a Docker command, returning its output on failure
+func runDocker(args ...string) error {
+	output, err := exec.Command("docker", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker %s failed: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return nil
+}
+
+// conformanceImages returns the images of the conformance runs of a
+// Kubernetes version. The images of the e2e tests are listed by the e2e test
+// binary of the conformance image, which is pulled with Docker.
+func conformanceImages(cmd *cobra.Command) ([]string, error) {
+	version := imo.kubernetesVersion
+	if version == "" {
+		var err error
+		version, err = clusterKubernetesVersion(cmd)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get the Kubernetes version of the cluster, set --kubernetes-version: %v", err)
+		}
+	}
+	conformanceImage := conformanceImageOf(version)
+
+	output, err := exec.Command("docker", "run", "--rm", "--entrypoint", e2eTestBinary, conformanceImage, "--list-images").Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list the images of the e2e tests of %s: %v", conformanceImage, err)
+	}
+
+	images := map[string]bool{
+		sonobuoyImage():                true,
+		config.DefaultSystemdLogsImage: true,
+		conformanceImage:               true,
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if image := strings.TrimSpace(line); image != "" && !isUnmirrored(image) {
+			images[image] = true
+		}
+	}
+
+	// the verification of the packages only reads the cluster: the images of
+	// the packages are pulled from the package repositories installed in it
+	if imo.packageTests {
+		images[packageTestImage(imo.packageTestRepo)] = true
+	}
+
+	list := make([]string, 0, len(images))
+	for image := range images {
+		list = append(list, image)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+func isUnmirrored(image string) bool {
+	for _, registry := range unmirroredRegistries {
+		if strings.HasPrefix(image, registry+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func sonobuoyImage() string {
+	return defaultSonobuoyRepo + ":" + buildinfo.Version
+}
+
+func conformanceImageOf(kubernetesVersion string) string {
+	return defaultConformanceRepo + ":" + upstreamVersion(kubernetesVersion)
+}
+
+// upstreamVersion returns the upstream Kubernetes version of a version, such
+// as v1.21.2 for v1.21.2+vmware.1
+func upstreamVersion(version string) string {
+	version = strings.SplitN(version, "+", 2)[0]
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return version
+}
+
+// clusterKubernetesVersion returns the upstream Kubernetes version of the
+// cluster targeted by the kubeconfig and context flags of a command
+func clusterKubernetesVersion(cmd *cobra.Command) (string, error) {
+	restConfig, err := newRestConfig(cmd)
+	if err != nil {
+		return "", err
+	}
+	client, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return "", err
+	}
+	version, err := client.ServerVersion()
+	if err != nil {
+		return "", err
+	}
+	return upstreamVersion(version.GitVersion), nil
+}
+
+// mirrorImage returns the image of a registry mirror, replacing the registry
+// of an image. Images without a registry are images of Docker Hub.
+func mirrorImage(image, registry string) string {
+	return strings.TrimSuffix(registry, "/") + "/" + imagePath(image)
+}
+
+// mirrorRegistry returns the registry of a mirror replacing a registry, or a
+// repository of a registry
+func mirrorRegistry(registry, mirror string) string {
+	if !strings.Contains(registry, "/") {
+		return strings.TrimSuffix(mirror, "/")
+	}
+	return mirrorImage(registry, mirror)
+}
+
+// imagePath returns the path of an image in its registry
+func imagePath(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 {
+		return "library/" + image
+	}
+	if parts[0] == "localhost" || strings.ContainsAny(parts[0], ".:") {
+		return parts[1]
+	}
+	return image
+}
+
+// writeE2ERepoConfig writes the e2e repo config of Sonobuoy pulling the images
+// of the e2e tests from a registry mirror
+func writeE2ERepoConfig(dir, registry string) (string, error) {
+	registries := map[string]string{}
+	for _, r := range e2eRegistries {
+		registries[r.key] = mirrorRegistry(r.registry, registry)
+	}
+
+	data, err := yaml.Marshal(registries)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "e2e-repo-config.yaml")
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// withRegistry adds the --registry flag to a Sonobuoy run or gen command, to
+// pull every image of the run from a registry mirror
+func withRegistry(cmd *cobra.Command) *cobra.Command {
+	var registry string
+	cmd.Flags().StringVar(&registry, "registry", "", "Registry mirror of the images of the run, pushed by tanzu conformance images push")
+
+	var dir string
+	preRunE, preRun := cmd.PreRunE, cmd.PreRun
+	postRunE, postRun := cmd.PostRunE, cmd.PostRun
+
+	cmd.PreRun = nil
+	cmd.PreRunE = func(c *cobra.Command, args []string) error {
+		if registry != "" {
+			var err error
+			dir, err = applyRegistry(c, registry)
+			if err != nil {
+				return err
+			}
+		}
+		if preRunE != nil {
+			return preRunE(c, args)
+		}
+		if preRun != nil {
+			preRun(c, args)
+		}
+		return nil
+	}
+
+	cmd.PostRun = nil
+	cmd.PostRunE = func(c *cobra.Command, args []string) error {
+		if dir != "" {
+			defer os.RemoveAll(dir)
+		}
+		if postRunE != nil {
+			return postRunE(c, args)
+		}
+		if postRun != nil {
+			postRun(c, args)
+		}
+		return nil
+	}
+	return cmd
+}
+
+// applyRegistry sets the images of a Sonobuoy command to the images of a
+// registry mirror, unless they were set on the command line. The returned
+// directory holds the e2e repo config.
+func applyRegistry(cmd *cobra.Command, registry string) (string, error) {
+	// --kubernetes-version replaces the deprecated --kube-conformance-image-version
+	var version *pflag.Flag
+	for _, name := range []string{"kubernetes-version", "kube-conformance-image-version"} {
+		if flag := cmd.Flags().Lookup(name); flag != nil && (version == nil || !version.Changed && flag.Changed) {
+			version = flag
+		}
+	}
+	if version == nil {
+		return "", fmt.Errorf("flag --kubernetes-version is not supported by this version of Sonobuoy")
+	}
+	kubernetesVersion := version.Value.String()
+	if kubernetesVersion == "" || kubernetesVersion == "auto" || kubernetesVersion == "ignore" || kubernetesVersion == "latest" {
+		var err error
+		kubernetesVersion, err = clusterKubernetesVersion(cmd)
+		if err != nil {
+			return "", fmt.Errorf("cannot get the Kubernetes version of the cluster: %v", err)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "conformance-registry-")
+	if err != nil {
+		return "", err
+	}
+	repoConfig, err := writeE2ERepoConfig(dir, registry)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	for _, flag := range []struct{ name, value string }{
+		{"sonobuoy-image", mirrorImage(sonobuoyImage(), registry)},
+		{"systemd-logs-image", mirrorImage(config.DefaultSystemdLogsImage, registry)},
+		{"kube-conformance-image", mirrorImage(conformanceImageOf(kubernetesVersion), registry)},
+		{"e2e-repo-config", repoConfig},
+	} {
+		if setErr := setDefaultFlag(cmd, flag.name, flag.value); setErr != nil {
+			os.RemoveAll(dir)
+			return "", setErr
+		}
+	}
+	if flag := cmd.Flags().Lookup("package-test-image-repo"); flag != nil && !flag.Changed {
+		if setErr := cmd.Flags().Set(flag.Name, mirrorImage(defaultPackageTestImageRepo, registry)); setErr != nil {
+			os.RemoveAll(dir)
+			return "", setErr
+		}
+	}
+	return dir, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import "testing"
+
+func TestImagePath(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"busybox:1.29", "library/busybox:1.29"},
+		{"sonobuoy/sonobuoy:v0.53.2", "sonobuoy/sonobuoy:v0.53.2"},
+		{"k8s.gcr.io/e2e-test-images/agnhost:2.32", "e2e-test-images/agnhost:2.32"},
+		{"registry:5000/conformance:v1.21.2", "conformance:v1.21.2"},
+		{"localhost/conformance:v1.21.2", "conformance:v1.21.2"},
+	}
+	for _, test := range tests {
+		t.Run(test.image, func(t *testing.T) {
+			if got := imagePath(test.image); got != test.want {
+				t.Errorf("expected path %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestMirrorImage(t *testing.T) {
+	tests := []struct {
+		image    string
+		registry string
+		want     string
+	}{
+		{"busybox:1.29", "harbor.local/mirror", "harbor.local/mirror/library/busybox:1.29"},
+		{"sonobuoy/sonobuoy:v0.53.2", "harbor.local/mirror/", "harbor.local/mirror/sonobuoy/sonobuoy:v0.53.2"},
+		{"k8s.gcr.io/e2e-test-images/agnhost:2.32", "harbor.local", "harbor.local/e2e-test-images/agnhost:2.32"},
+		{"registry:5000/conformance:v1.21.2", "harbor.local:8443", "harbor.local:8443/conformance:v1.21.2"},
+	}
+	for _, test := range tests {
+		t.Run(test.image, func(t *testing.T) {
+			if got := mirrorImage(test.image, test.registry); got != test.want {
+				t.Errorf("expected image %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestMirrorRegistry(t *testing.T) {
+	tests := []struct {
+		registry string
+		want     string
+	}{
+		{"k8s.gcr.io", "harbor.local/mirror"},
+		{"k8s.gcr.io/e2e-test-images", "harbor.local/mirror/e2e-test-images"},
+		{"gcr.io/authenticated-image-pulling", "harbor.local/mirror/authenticated-image-pulling"},
+	}
+	for _, test := range tests {
+		t.Run(test.registry, func(t *testing.T) {
+			if got := mirrorRegistry(test.registry, "harbor.local/mirror/"); got != test.want {
+				t.Errorf("expected registry %q, got %q", test.want, got)
+			}
+		})
+	}
+}
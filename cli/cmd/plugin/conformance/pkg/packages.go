@@ -0,0 +1,199 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/cli"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// tcePackageSuffix is the suffix of the names of the TCE packages
+	tcePackageSuffix = ".community.tanzu.vmware.com"
+
+	// defaultPackageTestImageRepo is the repository of the image verifying the
+	// installed TCE packages
+	defaultPackageTestImageRepo = "projects.registry.vmware.com/tce/package-tests"
+
+	// packageVerifyImageName is the name of the image verifying the installed
+	// TCE packages, tagged with the TCE version, built by make
+	// build-package-test-images
+	packageVerifyImageName = "verify"
+
+	// sonobuoyResultsDir is where Sonobuoy collects the results of plugins
+	sonobuoyResultsDir = "/tmp/sonobuoy/results"
+
+	listPackagesTimeout = 30 * time.Second
+)
+
+var packageInstallGVR = schema.GroupVersionResource{
+	Group:    "packaging.carvel.dev",
+	Version:  "v1alpha1",
+	Resource: "packageinstalls",
+}
+
+// installedPackage is a TCE package installed in the cluster
+type installedPackage struct {
+	name      string
+	version   string
+	install   string
+	namespace string
+}
+
+// addPackagePlugins adds a Sonobuoy plugin to a Sonobuoy command verifying
+// every installed TCE package. The plugins only read the cluster: the package
+// installs are not changed. The returned function removes the plugin
+// definitions.
+func addPackagePlugins(cmd *cobra.Command, imageRepo string) (func(), error) {
+	client, err := newDynamicClient(cmd)
+	if err != nil {
+		return nil, err
+	}
+	packages, err := listInstalledPackages(client)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "conformance-packages-")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	if len(packages) == 0 {
+		cleanup()
+		return nil, fmt.Errorf("no TCE package is installed in the cluster")
+	}
+	for _, p := range packages {
+		path, writeErr := writePackagePlugin(dir, p, imageRepo)
+		if writeErr != nil {
+			cleanup()
+			return nil, writeErr
+		}
+		if setErr := cmd.Flags().Set("plugin", path); setErr != nil {
+			cleanup()
+			return nil, setErr
+		}
+	}
+	return cleanup, nil
+}
+
+// newRestConfig returns the configuration of the client of the cluster
+// targeted by the kubeconfig and context flags of a Sonobuoy command
+func newRestConfig(cmd *cobra.Command) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	overrides := &clientcmd.ConfigOverrides{}
+	if flag := cmd.Flags().Lookup("kubeconfig"); flag != nil {
+		rules.ExplicitPath = flag.Value.String()
+	}
+	if flag := cmd.Flags().Lookup("context"); flag != nil {
+		overrides.CurrentContext = flag.Value.String()
+	}
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("cannot load kubeconfig: %v", err)
+	}
+	return config, nil
+}
+
+// newDynamicClient returns a client of the cluster targeted by a Sonobuoy
+// command
+func newDynamicClient(cmd *cobra.Command) (dynamic.Interface, error) {
+	config, err := newRestConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(config)
+}
+
+func listInstalledPackages(client dynamic.Interface) ([]installedPackage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), listPackagesTimeout)
+	defer cancel()
+
+	list, err := client.Resource(packageInstallGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list installed packages: %v", err)
+	}
+
+	var packages []installedPackage
+	for i := range list.Items {
+		item := &list.Items[i]
+		refName, _, _ := unstructured.NestedString(item.Object, "spec", "packageRef", "refName")
+		if !strings.HasSuffix(refName, tcePackageSuffix) {
+			continue
+		}
+		version, _, _ := unstructured.NestedString(item.Object, "status", "version")
+		if version == "" {
+			version, _, _ = unstructured.NestedString(item.Object, "spec", "packageRef", "versionSelection", "constraints")
+		}
+		packages = append(packages, installedPackage{
+			name:      strings.TrimSuffix(refName, tcePackageSuffix),
+			version:   version,
+			install:   item.GetName(),
+			namespace: item.GetNamespace(),
+		})
+	}
+	return packages, nil
+}
+
+// packageTestImage returns the image verifying the installed packages, of
+// the version of TCE of the CLI
+func packageTestImage(imageRepo string) string {
+	return fmt.Sprintf("%s/%s:%s", imageRepo, packageVerifyImageName, cli.BuildVersion)
+}
+
+// writePackagePlugin writes the definition of the Sonobuoy plugin verifying
+// a package install. The image writes the JUnit results of the verification
+// to the results directory, along with the done file of Sonobuoy.
+func writePackagePlugin(dir string, p installedPackage, imageRepo string) (string, error) {
+	// package installs are named uniquely in their namespace only
+	pluginName := fmt.Sprintf("package-%s-%s", p.namespace, p.install)
+	definition := map[string]interface{}{
+		"sonobuoy-config": map[string]interface{}{
+			"driver":        "Job",
+			"plugin-name":   pluginName,
+			"result-format": "junit",
+			"description":   fmt.Sprintf("Verification of the %s package, version %s, installed as %s/%s", p.name, p.version, p.namespace, p.install),
+		},
+		"spec": map[string]interface{}{
+			"name":            "plugin",
+			"image":           packageTestImage(imageRepo),
+			"imagePullPolicy": "IfNotPresent",
+			"env": []interface{}{
+				map[string]interface{}{"name": "PACKAGE_NAME", "value": p.name + tcePackageSuffix},
+				map[string]interface{}{"name": "PACKAGE_VERSION", "value": p.version},
+				map[string]interface{}{"name": "PACKAGE_INSTALL_NAME", "value": p.install},
+				map[string]interface{}{"name": "PACKAGE_INSTALL_NAMESPACE", "value": p.namespace},
+			},
+			"volumeMounts": []interface{}{
+				map[string]interface{}{"name": "results", "mountPath": sonobuoyResultsDir},
+			},
+		},
+	}
+
+	data, err := yaml.Marshal(definition)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, pluginName+".yaml")
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,222 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	profileQuick     = "tce-quick"
+	profileCertified = "tce-certified"
+	profilePackages  = "tce-packages"
+
+	infrastructureDocker = "docker"
+)
+
+// profile presets the flags of the Sonobuoy run and gen commands for the
+// conformance runs of TCE clusters. Flags set on the command line take
+// precedence over the profile.
+type profile struct {
+	description string
+	// mode is the Sonobuoy mode, which sets the focus and skip of the e2e tests
+	mode    string
+	focus   string
+	skips   []string
+	plugins []string
+	timeout time.Duration
+	// packages verifies every installed TCE package
+	packages bool
+}
+
+var profiles = map[string]profile{
+	profileQuick: {
+		description: "a single e2e test, checking the cluster can run conformance tests",
+		mode:        "quick",
+		plugins:     []string{"e2e"},
+		timeout:     30 * time.Minute,
+	},
+	profileCertified: {
+		description: "the e2e tests of the CNCF conformance certification, and the systemd logs of the nodes",
+		mode:        "certified-conformance",
+		plugins:     []string{"e2e", "systemd-logs"},
+		timeout:     4 * time.Hour,
+	},
+	profilePackages: {
+		description: "the verification of the installed TCE packages, reading their installs and workloads",
+		timeout:     time.Hour,
+		packages:    true,
+	},
+}
+
+// infrastructureSkips are the e2e tests known not to pass on clusters of an
+// infrastructure provider, skipped by the profiles running e2e tests
+var infrastructureSkips = map[string][]string{
+	infrastructureDocker: {
+		// Docker clusters have no load balancer provider
+		`LoadBalancer`,
+		// host ports are bound by the Docker network of the nodes, the tests
+		// of their conflicts across host IPs and protocols fail
+		`HostPort validates that there is no conflict between pods with same hostPort but different hostIP and protocol`,
+	},
+}
+
+type profileOptions struct {
+	name                 string
+	infrastructure       string
+	packageTestImageRepo string
+}
+
+// withProfiles adds the --profile flag to a Sonobuoy run or gen command
+func withProfiles(cmd *cobra.Command) *cobra.Command {
+	options := &profileOptions{}
+	cmd.Flags().StringVar(&options.name, "profile", "", fmt.Sprintf("TCE conformance profile, presetting the tests, plugins and timeout (%s)", strings.Join(profileNames(), "|")))
+	cmd.Flags().StringVar(&options.infrastructure, "infrastructure", "", "Infrastructure provider of the cluster, for the profile to skip the tests it does not support (docker)")
+	cmd.Flags().StringVar(&options.packageTestImageRepo, "package-test-image-repo", defaultPackageTestImageRepo, "Repository of the image verifying the installed TCE packages, used by the tce-packages profile")
+
+	preRunE, preRun := cmd.PreRunE, cmd.PreRun
+	postRunE, postRun := cmd.PostRunE, cmd.PostRun
+	cleanup := func() {}
+
+	cmd.PreRun = nil
+	cmd.PreRunE = func(c *cobra.Command, args []string) error {
+		var err error
+		cleanup, err = applyProfile(c, options)
+		if err != nil {
+			return err
+		}
+		if preRunE != nil {
+			return preRunE(c, args)
+		}
+		if preRun != nil {
+			preRun(c, args)
+		}
+		return nil
+	}
+
+	cmd.PostRun = nil
+	cmd.PostRunE = func(c *cobra.Command, args []string) error {
+		defer cleanup()
+		if postRunE != nil {
+			return postRunE(c, args)
+		}
+		if postRun != nil {
+			postRun(c, args)
+		}
+		return nil
+	}
+	return cmd
+}
+
+func profileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfile sets the flags of a Sonobuoy command from a profile. The
+// returned function removes the files written for the profile.
+func applyProfile(cmd *cobra.Command, options *profileOptions) (func(), error) {
+	noCleanup := func() {}
+	if options.name == "" {
+		if options.infrastructure != "" {
+			return noCleanup, fmt.Errorf("--infrastructure is only used with --profile")
+		}
+		return noCleanup, nil
+	}
+
+	p, ok := profiles[options.name]
+	if !ok {
+		return noCleanup, fmt.Errorf("unknown profile %q: must be one of %s", options.name, strings.Join(profileNames(), ", "))
+	}
+	skips := append([]string{}, p.skips...)
+	if options.infrastructure != "" {
+		infrastructureSkip, supported := infrastructureSkips[options.infrastructure]
+		if !supported {
+			return noCleanup, fmt.Errorf("unsupported infrastructure %q: must be docker", options.infrastructure)
+		}
+		skips = append(skips, infrastructureSkip...)
+	}
+
+	if p.mode != "" {
+		if err := setDefaultFlag(cmd, "mode", p.mode); err != nil {
+			return noCleanup, err
+		}
+	}
+	// the mode sets the value of --e2e-skip, which the skips of the profile
+	// would replace: the skip of the mode is kept
+	if modeSkip := cmd.Flags().Lookup("e2e-skip"); modeSkip != nil && modeSkip.Value.String() != "" && len(skips) > 0 {
+		skips = append([]string{modeSkip.Value.String()}, skips...)
+	}
+
+	for _, flag := range []struct{ name, value string }{
+		{"e2e-focus", p.focus},
+		{"e2e-skip", strings.Join(skips, "|")},
+		{"timeout", strconv.Itoa(int(p.timeout.Seconds()))},
+	} {
+		if flag.value == "" {
+			continue
+		}
+		if err := setDefaultFlag(cmd, flag.name, flag.value); err != nil {
+			return noCleanup, err
+		}
+	}
+
+	if err := setDefaultPlugins(cmd, p.plugins); err != nil {
+		return noCleanup, err
+	}
+
+	cleanup := noCleanup
+	if p.packages {
+		var err error
+		cleanup, err = addPackagePlugins(cmd, options.packageTestImageRepo)
+		if err != nil {
+			return noCleanup, err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Using profile %s: %s\n", options.name, p.description)
+	return cleanup, nil
+}
+
+// setDefaultFlag sets a flag of a Sonobuoy command, unless it was set on the
+// command line
+func setDefaultFlag(cmd *cobra.Command, name, value string) error {
+	flag := cmd.Flags().Lookup(name)
+	if flag == nil {
+		return fmt.Errorf("flag --%s is not supported by this version of Sonobuoy", name)
+	}
+	if flag.Changed {
+		return nil
+	}
+	return cmd.Flags().Set(name, value)
+}
+
+// setDefaultPlugins sets the plugins of a Sonobuoy command, unless they were
+// set on the command line
+func setDefaultPlugins(cmd *cobra.Command, plugins []string) error {
+	flag := cmd.Flags().Lookup("plugin")
+	if flag == nil {
+		return fmt.Errorf("flag --plugin is not supported by this version of Sonobuoy")
+	}
+	if flag.Changed {
+		return nil
+	}
+	for _, plugin := range plugins {
+		if err := cmd.Flags().Set("plugin", plugin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
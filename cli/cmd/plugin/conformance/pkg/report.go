@@ -0,0 +1,326 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vmware-tanzu/sonobuoy/pkg/buildinfo"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/cli"
+)
+
+const (
+	reportFormatJUnit    = "junit"
+	reportFormatHTML     = "html"
+	reportFormatMarkdown = "markdown"
+)
+
+type reportOptions struct {
+	format string
+}
+
+var ro = reportOptions{}
+
+// ReportCmd writes a report of the results of a run
+var ReportCmd = &cobra.Command{
+	Use:   "report <tarball>",
+	Short: "Write a report of the results of a run",
+	Long: `Write a report of the results of a run, from the tarball retrieved by
+tanzu conformance retrieve. The tests of all plugins are reported together,
+along with the TCE, Sonobuoy and Kubernetes versions.`,
+	Args: cobra.ExactArgs(1),
+	RunE: report,
+}
+
+func init() {
+	ReportCmd.Flags().StringVar(&ro.format, "format", reportFormatJUnit, "Format of the report (junit, html or markdown)")
+}
+
+// reportData is the content of a report
+type reportData struct {
+	Generated         time.Time
+	TCEVersion        string
+	TCESHA            string
+	SonobuoyVersion   string
+	KubernetesVersion string
+	Tarball           string
+	Passed            int
+	Failed            int
+	Skipped           int
+	Plugins           []pluginReport
+}
+
+// pluginReport are the results of the tests of a plugin
+type pluginReport struct {
+	Name    string
+	Tests   []testResult
+	Passed  int
+	Failed  int
+	Skipped int
+}
+
+func report(cmd *cobra.Command, args []string) error {
+	var write func(io.Writer, *reportData) error
+	switch ro.format {
+	case reportFormatJUnit:
+		write = writeJUnitReport
+	case reportFormatHTML:
+		write = writeHTMLReport
+	case reportFormatMarkdown:
+		write = writeMarkdownReport
+	default:
+		return fmt.Errorf("unsupported report format %q: must be one of junit, html or markdown", ro.format)
+	}
+
+	results, err := readRunResults(args[0])
+	if err != nil {
+		return err
+	}
+	return write(cmd.OutOrStdout(), newReportData(args[0], results))
+}
+
+func newReportData(tarball string, results *runResults) *reportData {
+	data := &reportData{
+		Generated:         time.Now(),
+		TCEVersion:        cli.BuildVersion,
+		TCESHA:            cli.BuildSHA,
+		SonobuoyVersion:   buildinfo.Version,
+		KubernetesVersion: results.kubernetesVersion,
+		Tarball:           tarball,
+	}
+
+	plugins := map[string]*pluginReport{}
+	for _, test := range results.tests {
+		p, ok := plugins[test.Plugin]
+		if !ok {
+			p = &pluginReport{Name: test.Plugin}
+			plugins[test.Plugin] = p
+		}
+		p.Tests = append(p.Tests, test)
+		switch test.Status {
+		case statusPassed:
+			p.Passed++
+			data.Passed++
+		case statusFailed:
+			p.Failed++
+			data.Failed++
+		case statusSkipped:
+			p.Skipped++
+			data.Skipped++
+		}
+	}
+
+	for _, p := range plugins {
+		data.Plugins = append(data.Plugins, *p)
+	}
+	sort.Slice(data.Plugins, func(i, j int) bool {
+		return data.Plugins[i].Name < data.Plugins[j].Name
+	})
+	return data
+}
+
+// FailedTests returns the failed tests of a plugin, for the HTML template
+func (p pluginReport) FailedTests() []testResult {
+	var failed []testResult
+	for _, test := range p.Tests {
+		if test.Status == statusFailed {
+			failed = append(failed, test)
+		}
+	}
+	return failed
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnitReport writes a JUnit report with a test suite per plugin
+func writeJUnitReport(w io.Writer, data *reportData) error {
+	properties := []junitProperty{
+		{Name: "tce.version", Value: data.TCEVersion},
+		{Name: "tce.sha", Value: data.TCESHA},
+		{Name: "sonobuoy.version", Value: data.SonobuoyVersion},
+		{Name: "kubernetes.version", Value: data.KubernetesVersion},
+	}
+
+	suites := junitTestSuites{
+		Name:     "conformance",
+		Tests:    data.Passed + data.Failed + data.Skipped,
+		Failures: data.Failed,
+		Skipped:  data.Skipped,
+	}
+	for _, p := range data.Plugins {
+		suite := junitTestSuite{
+			Name:       p.Name,
+			Tests:      p.Passed + p.Failed + p.Skipped,
+			Failures:   p.Failed,
+			Skipped:    p.Skipped,
+			Timestamp:  data.Generated.Format(time.RFC3339),
+			Properties: properties,
+		}
+		for _, test := range p.Tests {
+			c := junitTestCase{Name: test.Name, Classname: p.Name}
+			switch test.Status {
+			case statusFailed:
+				c.Failure = &junitFailure{Message: firstLine(test.Message), Text: test.Message}
+			case statusSkipped:
+				c.Skipped = &struct{}{}
+			case statusPassed:
+			default:
+				// other statuses, such as unknown, are not counted as tests
+				continue
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func firstLine(s string) string {
+	return strings.SplitN(s, "\n", 2)[0]
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Conformance report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+.passed { color: #2e7d32; }
+.failed { color: #c62828; }
+.skipped { color: #757575; }
+pre { background: #f5f5f5; padding: 0.6em; overflow-x: auto; }
+</style>
+</head>
+<body>
+<h1>Conformance report</h1>
+<table>
+<tr><th>TCE version</th><td>{{.TCEVersion}} ({{.TCESHA}})</td></tr>
+<tr><th>Sonobuoy version</th><td>{{.SonobuoyVersion}}</td></tr>
+<tr><th>Kubernetes version</th><td>{{.KubernetesVersion}}</td></tr>
+<tr><th>Results</th><td>{{.Tarball}}</td></tr>
+<tr><th>Generated</th><td>{{.Generated.Format "2006-01-02T15:04:05Z07:00"}}</td></tr>
+</table>
+<h2>Summary</h2>
+<table>
+<tr><th>Plugin</th><th>Passed</th><th>Failed</th><th>Skipped</th></tr>
+{{range .Plugins}}<tr><td>{{.Name}}</td><td class="passed">{{.Passed}}</td><td class="failed">{{.Failed}}</td><td class="skipped">{{.Skipped}}</td></tr>
+{{end}}<tr><th>Total</th><th class="passed">{{.Passed}}</th><th class="failed">{{.Failed}}</th><th class="skipped">{{.Skipped}}</th></tr>
+</table>
+{{if .Failed}}
+<h2>Failed tests</h2>
+{{range .Plugins}}{{range .FailedTests}}<h3 class="failed">[{{.Plugin}}] {{.Name}}</h3>
+{{with .Message}}<pre>{{.}}</pre>
+{{end}}{{end}}{{end}}{{end}}
+{{range .Plugins}}
+<h2>{{.Name}}</h2>
+<table>
+<tr><th>Test</th><th>Status</th></tr>
+{{range .Tests}}<tr><td>{{.Name}}</td><td class="{{.Status}}">{{.Status}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+// writeHTMLReport writes an HTML report, with the failure messages of the
+// failed tests and the results of every test
+func writeHTMLReport(w io.Writer, data *reportData) error {
+	return htmlReportTemplate.Execute(w, data)
+}
+
+// writeMarkdownReport writes a Markdown report, with the failure messages of
+// the failed tests
+func writeMarkdownReport(w io.Writer, data *reportData) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Conformance report\n\n")
+	fmt.Fprintf(&b, "| | |\n|:--- |:--- |\n")
+	fmt.Fprintf(&b, "| TCE version | %s (%s) |\n", data.TCEVersion, data.TCESHA)
+	fmt.Fprintf(&b, "| Sonobuoy version | %s |\n", data.SonobuoyVersion)
+	fmt.Fprintf(&b, "| Kubernetes version | %s |\n", data.KubernetesVersion)
+	fmt.Fprintf(&b, "| Results | %s |\n", data.Tarball)
+	fmt.Fprintf(&b, "| Generated | %s |\n\n", data.Generated.Format(time.RFC3339))
+
+	fmt.Fprintf(&b, "## Summary\n\n")
+	fmt.Fprintf(&b, "| Plugin | Passed | Failed | Skipped |\n|:--- |:--- |:--- |:--- |\n")
+	for _, p := range data.Plugins {
+		fmt.Fprintf(&b, "| %s | %d | %d | %d |\n", p.Name, p.Passed, p.Failed, p.Skipped)
+	}
+	fmt.Fprintf(&b, "| **Total** | %d | %d | %d |\n", data.Passed, data.Failed, data.Skipped)
+
+	if data.Failed > 0 {
+		fmt.Fprintf(&b, "\n## Failed tests\n")
+		for _, p := range data.Plugins {
+			for _, test := range p.FailedTests() {
+				fmt.Fprintf(&b, "\n### [%s] %s\n", test.Plugin, escapeMarkdown(test.Name))
+				if test.Message != "" {
+					fmt.Fprintf(&b, "\n```\n%s\n```\n", strings.TrimRight(test.Message, "\n"))
+				}
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "|", `\|`)
+
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
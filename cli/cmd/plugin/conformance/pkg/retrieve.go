@@ -7,4 +7,4 @@ import (
 	"github.com/vmware-tanzu/sonobuoy/cmd/sonobuoy/app"
 )
 
-var RetrieveCmd = app.NewCmdRetrieve()
+var RetrieveCmd = withHistory(app.NewCmdRetrieve())
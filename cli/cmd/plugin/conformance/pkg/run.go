@@ -7,4 +7,4 @@ import (
 	"github.com/vmware-tanzu/sonobuoy/cmd/sonobuoy/app"
 )
 
-var RunCmd = app.NewCmdRun()
+var RunCmd = withWorkflow(withRegistry(withProfiles(app.NewCmdRun())))
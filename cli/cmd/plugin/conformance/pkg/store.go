@@ -0,0 +1,267 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/config"
+)
+
+const (
+	statusPassed  = "passed"
+	statusFailed  = "failed"
+	statusSkipped = "skipped"
+
+	// runIDFormat is the format of the IDs of the runs in the results store,
+	// the time they were retrieved
+	runIDFormat = "20060102-150405"
+
+	// sonobuoyResultsFile is the file of the results of a plugin, under
+	// plugins/<plugin> in the tarball of a run
+	sonobuoyResultsFile = "sonobuoy_results.yaml"
+	// serverVersionFile holds the version of the Kubernetes API server of the
+	// cluster of a run
+	serverVersionFile = "serverversion.json"
+)
+
+// runRecord is a run in the results store
+type runRecord struct {
+	ID                string       `json:"id"`
+	Retrieved         time.Time    `json:"retrieved"`
+	Tarball           string       `json:"tarball"`
+	TCEVersion        string       `json:"tceVersion"`
+	KubernetesVersion string       `json:"kubernetesVersion"`
+	Passed            int          `json:"passed"`
+	Failed            int          `json:"failed"`
+	Skipped           int          `json:"skipped"`
+	Tests             []testResult `json:"tests"`
+}
+
+// testResult is the result of a test of a Sonobuoy plugin
+type testResult struct {
+	Plugin string `json:"plugin"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Message is the failure message of failed tests
+	Message string `json:"message,omitempty"`
+}
+
+// resultItem is an item of the results of a Sonobuoy plugin, whose leaves
+// are the tests of the plugin
+type resultItem struct {
+	Name    string                 `json:"name"`
+	Status  string                 `json:"status"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	Items   []resultItem           `json:"items,omitempty"`
+}
+
+// serverVersion is the version reported by the Kubernetes API server
+type serverVersion struct {
+	GitVersion string `json:"gitVersion"`
+}
+
+// runResults are the results of a Sonobuoy run, read from its tarball
+type runResults struct {
+	kubernetesVersion string
+	tests             []testResult
+}
+
+// readRunResults reads the results of the tests of every plugin of a run from
+// the tarball retrieved by Sonobuoy
+func readRunResults(tarball string) (*runResults, error) {
+	f, err := os.Open(tarball)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read Sonobuoy results %s: %v", tarball, err)
+	}
+	defer gz.Close()
+
+	results := &runResults{}
+	plugins := 0
+	tr := tar.NewReader(gz)
+	for {
+		header, nextErr := tr.Next()
+		if nextErr == io.EOF {
+			break
+		}
+		if nextErr != nil {
+			return nil, fmt.Errorf("cannot read Sonobuoy results %s: %v", tarball, nextErr)
+		}
+
+		name := path.Clean(header.Name)
+		switch {
+		case path.Base(name) == serverVersionFile:
+			var version serverVersion
+			if decodeErr := json.NewDecoder(tr).Decode(&version); decodeErr != nil {
+				return nil, fmt.Errorf("cannot read %s of %s: %v", name, tarball, decodeErr)
+			}
+			results.kubernetesVersion = version.GitVersion
+		case strings.HasPrefix(name, "plugins/") && path.Base(name) == sonobuoyResultsFile:
+			data, readErr := io.ReadAll(tr)
+			if readErr != nil {
+				return nil, fmt.Errorf("cannot read %s of %s: %v", name, tarball, readErr)
+			}
+			var item resultItem
+			if decodeErr := yaml.Unmarshal(data, &item); decodeErr != nil {
+				return nil, fmt.Errorf("cannot read %s of %s: %v", name, tarball, decodeErr)
+			}
+			plugin := strings.Split(name, "/")[1]
+			results.tests = append(results.tests, flattenResults(plugin, item)...)
+			plugins++
+		}
+	}
+
+	if plugins == 0 {
+		return nil, fmt.Errorf("no plugin results in %s: the results of the run may not be processed yet", tarball)
+	}
+	return results, nil
+}
+
+// flattenResults returns the tests of the results of a plugin, the leaves of
+// the items of the results
+func flattenResults(plugin string, item resultItem) []testResult {
+	if len(item.Items) > 0 {
+		var tests []testResult
+		for _, child := range item.Items {
+			tests = append(tests, flattenResults(plugin, child)...)
+		}
+		return tests
+	}
+
+	test := testResult{Plugin: plugin, Name: item.Name, Status: item.Status}
+	if failure, ok := item.Details["failure"].(string); ok && item.Status == statusFailed {
+		test.Message = failure
+	}
+	return []testResult{test}
+}
+
+// resultsStoreDir returns the directory of the results store
+func resultsStoreDir() (string, error) {
+	dir, err := config.LocalDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "conformance", "runs"), nil
+}
+
+// saveRun records the results of a run in the results store, with the TCE
+// version of its cluster
+func saveRun(tarball, tceVersion string) (*runRecord, error) {
+	results, err := readRunResults(tarball)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := resultsStoreDir()
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	absTarball, err := filepath.Abs(tarball)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	run := &runRecord{
+		ID:                now.Format(runIDFormat),
+		Retrieved:         now,
+		Tarball:           absTarball,
+		TCEVersion:        tceVersion,
+		KubernetesVersion: results.kubernetesVersion,
+		Tests:             results.tests,
+	}
+	for i := 2; runExists(dir, run.ID); i++ {
+		run.ID = fmt.Sprintf("%s-%d", now.Format(runIDFormat), i)
+	}
+	for _, test := range run.Tests {
+		switch test.Status {
+		case statusPassed:
+			run.Passed++
+		case statusFailed:
+			run.Failed++
+		case statusSkipped:
+			run.Skipped++
+		}
+	}
+
+	data, err := yaml.Marshal(run)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(filepath.Join(dir, run.ID+".yaml"), data, 0600); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func runExists(dir, id string) bool {
+	_, err := os.Stat(filepath.Join(dir, id+".yaml"))
+	return err == nil
+}
+
+// loadRun reads a run of the results store
+func loadRun(id string) (*runRecord, error) {
+	dir, err := resultsStoreDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id+".yaml"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("run %s not found: see tanzu conformance history", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	run := &runRecord{}
+	if err = yaml.Unmarshal(data, run); err != nil {
+		return nil, fmt.Errorf("cannot read run %s: %v", id, err)
+	}
+	return run, nil
+}
+
+// listRuns reads the runs of the results store, oldest first
+func listRuns() ([]*runRecord, error) {
+	dir, err := resultsStoreDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]*runRecord, 0, len(files))
+	for _, file := range files {
+		run, loadErr := loadRun(strings.TrimSuffix(filepath.Base(file), ".yaml"))
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Retrieved.Before(runs[j].Retrieved)
+	})
+	return runs, nil
+}
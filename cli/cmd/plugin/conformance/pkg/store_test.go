@@ -0,0 +1,47 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFlattenResults(t *testing.T) {
+	item := resultItem{
+		Name:   "e2e",
+		Status: statusFailed,
+		Items: []resultItem{
+			{
+				Name:   "global",
+				Status: statusFailed,
+				Items: []resultItem{
+					{Name: "passing", Status: statusPassed},
+					{Name: "failing", Status: statusFailed, Details: map[string]interface{}{"failure": "timeout"}},
+					{Name: "skipped", Status: statusSkipped, Details: map[string]interface{}{"failure": "not a failure"}},
+				},
+			},
+			{Name: "top-level", Status: statusPassed},
+		},
+	}
+
+	want := []testResult{
+		{Plugin: "e2e", Name: "passing", Status: statusPassed},
+		{Plugin: "e2e", Name: "failing", Status: statusFailed, Message: "timeout"},
+		{Plugin: "e2e", Name: "skipped", Status: statusSkipped},
+		{Plugin: "e2e", Name: "top-level", Status: statusPassed},
+	}
+	if got := flattenResults("e2e", item); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected tests %+v, got %+v", want, got)
+	}
+}
+
+func TestFlattenResultsLeaf(t *testing.T) {
+	item := resultItem{Name: "systemd-logs", Status: statusPassed}
+
+	want := []testResult{{Plugin: "systemd-logs", Name: "systemd-logs", Status: statusPassed}}
+	if got := flattenResults("systemd-logs", item); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected tests %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vmware-tanzu/sonobuoy/pkg/client"
+	sonodynamic "github.com/vmware-tanzu/sonobuoy/pkg/dynamic"
+	"github.com/vmware-tanzu/sonobuoy/pkg/plugin/aggregation"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/cli/component"
+)
+
+const (
+	// statusPollInterval is the interval of the status checks of a run
+	statusPollInterval = 15 * time.Second
+	// deleteTimeout is how long the deletion of the resources of a run waits
+	// for the Sonobuoy namespace to be removed
+	deleteTimeout = 5 * time.Minute
+	// defaultWaitMinutes is how long a run waits for its completion when
+	// --wait is not set, as Sonobuoy does for --wait without a value
+	defaultWaitMinutes = 1440
+	// interruptedExitCode is the exit code of runs interrupted by a signal
+	interruptedExitCode = 130
+)
+
+type workflowOptions struct {
+	retrieveDir string
+	cleanup     bool
+	tceVersion  string
+}
+
+// workflow waits for the completion of a run started by the Sonobuoy run
+// command, then retrieves its results and deletes its resources
+type workflow struct {
+	options   *workflowOptions
+	client    *client.SonobuoyClient
+	namespace string
+	wait      time.Duration
+}
+
+// withWorkflow adds the --retrieve and --cleanup flags to a Sonobuoy run
+// command, for a run to be followed to its completion
+func withWorkflow(cmd *cobra.Command) *cobra.Command {
+	options := &workflowOptions{}
+	cmd.Flags().StringVar(&options.retrieveDir, "retrieve", "", "Retrieve the results of the run to a directory when it completes, e.g. --retrieve . for the current directory")
+	cmd.Flags().BoolVar(&options.cleanup, "cleanup", false, "Delete the resources of the run when it completes or is interrupted")
+	addTCEVersionFlag(cmd, &options.tceVersion)
+
+	var w *workflow
+	preRunE, preRun := cmd.PreRunE, cmd.PreRun
+	postRunE, postRun := cmd.PostRunE, cmd.PostRun
+
+	cmd.PreRun = nil
+	cmd.PreRunE = func(c *cobra.Command, args []string) error {
+		if options.retrieveDir != "" || options.cleanup {
+			var err error
+			w, err = newWorkflow(c, options)
+			if err != nil {
+				return err
+			}
+		}
+		if preRunE != nil {
+			return preRunE(c, args)
+		}
+		if preRun != nil {
+			preRun(c, args)
+		}
+		return nil
+	}
+
+	cmd.PostRun = nil
+	cmd.PostRunE = func(c *cobra.Command, args []string) error {
+		if postRunE != nil {
+			if err := postRunE(c, args); err != nil {
+				return err
+			}
+		} else if postRun != nil {
+			postRun(c, args)
+		}
+		if w == nil {
+			return nil
+		}
+		// the run failing is reported by the exit code, not by the usage
+		c.SilenceUsage = true
+		return w.run(c.OutOrStdout())
+	}
+	return cmd
+}
+
+// newWorkflow sets up the workflow of a run. The Sonobuoy run command stops
+// waiting for the run, for the workflow to report its progress. With
+// --cleanup, the resources of the run are deleted when the command is
+// interrupted.
+func newWorkflow(cmd *cobra.Command, options *workflowOptions) (*workflow, error) {
+	waitFlag := cmd.Flags().Lookup("wait")
+	if waitFlag == nil {
+		return nil, fmt.Errorf("flag --wait is not supported by this version of Sonobuoy")
+	}
+	waitMinutes := defaultWaitMinutes
+	if waitFlag.Changed {
+		var err error
+		waitMinutes, err = strconv.Atoi(waitFlag.Value.String())
+		if err != nil {
+			return nil, err
+		}
+		if waitMinutes <= 0 {
+			return nil, fmt.Errorf("--retrieve and --cleanup wait for the run to complete, --wait must be positive")
+		}
+	}
+	if err := cmd.Flags().Set("wait", "0"); err != nil {
+		return nil, err
+	}
+
+	restConfig, err := newRestConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	apiHelper, err := sonodynamic.NewAPIHelperFromRESTConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	sonobuoyClient, err := client.NewSonobuoyClient(restConfig, apiHelper)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &workflow{
+		options:   options,
+		client:    sonobuoyClient,
+		namespace: cmd.Flags().Lookup("namespace").Value.String(),
+		wait:      time.Duration(waitMinutes) * time.Minute,
+	}
+	if options.cleanup {
+		w.deleteOnInterrupt()
+	}
+	return w, nil
+}
+
+// deleteOnInterrupt deletes the resources of the run when the command is
+// interrupted, then exits
+func (w *workflow) deleteOnInterrupt() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Fprintln(os.Stderr, "\nInterrupted")
+		if err := w.deleteResources(); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot delete the resources of the run: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(interruptedExitCode)
+	}()
+}
+
+// run waits for the run to complete, retrieves its results and deletes its
+// resources. It fails if the run or any of its plugins failed.
+func (w *workflow) run(out io.Writer) (err error) {
+	if w.options.cleanup {
+		defer func() {
+			if deleteErr := w.deleteResources(); deleteErr != nil && err == nil {
+				err = deleteErr
+			}
+		}()
+	}
+
+	status, err := w.waitForCompletion()
+	if err != nil {
+		return err
+	}
+	if status.Status == aggregation.FailedStatus {
+		// the results are retrieved for the diagnosis of the failure, before
+		// the resources of the run are deleted
+		if w.options.retrieveDir != "" {
+			if tarball, retrieveErr := w.retrieve(); retrieveErr != nil {
+				fmt.Fprintf(os.Stderr, "Cannot retrieve the results of the failed run: %v\n", retrieveErr)
+			} else {
+				fmt.Fprintf(os.Stderr, "Retrieved results to %s\n", tarball)
+			}
+		}
+		return fmt.Errorf("the Sonobuoy run failed: see tanzu conformance logs -n %s", w.namespace)
+	}
+
+	if w.options.retrieveDir != "" {
+		tarball, retrieveErr := w.retrieve()
+		if retrieveErr != nil {
+			return retrieveErr
+		}
+		fmt.Fprintf(os.Stderr, "Retrieved results to %s\n", tarball)
+		if summaryErr := printTestSummary(out, tarball); summaryErr != nil {
+			return summaryErr
+		}
+	} else {
+		printPluginSummary(out, status)
+	}
+
+	var failed []string
+	for _, p := range status.Plugins {
+		if p.ResultStatus == statusFailed {
+			failed = append(failed, pluginStatusName(p))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("conformance tests failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// waitForCompletion polls the status of the run, printing the progress of its
+// plugins, until the run completes or fails
+func (w *workflow) waitForCompletion() (*aggregation.Status, error) {
+	fmt.Fprintf(os.Stderr, "Waiting up to %s for the run to complete\n", w.wait)
+	deadline := time.Now().Add(w.wait)
+	progress := map[string]string{}
+	var lastErr error
+
+	for {
+		status, err := w.client.GetStatus(&client.StatusConfig{Namespace: w.namespace})
+		if err != nil {
+			// the aggregator reports no status until it is running
+			lastErr = err
+		} else {
+			printProgress(status, progress)
+			switch status.Status {
+			case aggregation.CompleteStatus, aggregation.FailedStatus:
+				return status, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			if lastErr != nil {
+				return nil, fmt.Errorf("the run did not complete in %s: %v", w.wait, lastErr)
+			}
+			return nil, fmt.Errorf("the run did not complete in %s", w.wait)
+		}
+		time.Sleep(statusPollInterval)
+	}
+}
+
+// printProgress prints the progress of the plugins of a run which changed
+// since it was last printed
+func printProgress(status *aggregation.Status, printed map[string]string) {
+	for _, p := range status.Plugins {
+		line := p.Status
+		if p.Progress != nil && p.Progress.Total > 0 {
+			line += fmt.Sprintf(", %d/%d tests", p.Progress.Completed, p.Progress.Total)
+			if failures := len(p.Progress.Failures); failures > 0 {
+				line += fmt.Sprintf(", %d failed", failures)
+			}
+		}
+		if p.ResultStatus != "" {
+			line += ", " + p.ResultStatus
+		}
+
+		name := pluginStatusName(p)
+		if printed[name] != line {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, line)
+			printed[name] = line
+		}
+	}
+}
+
+func pluginStatusName(p aggregation.PluginStatus) string {
+	if p.Node == "" || p.Node == "global" {
+		return p.Plugin
+	}
+	return fmt.Sprintf("%s (%s)", p.Plugin, p.Node)
+}
+
+// retrieve writes the tarball of the results of the run to the retrieve
+// directory and records it in the results history
+func (w *workflow) retrieve() (string, error) {
+	if err := os.MkdirAll(w.options.retrieveDir, 0755); err != nil {
+		return "", err
+	}
+	reader, errc, err := w.client.RetrieveResults(&client.RetrieveConfig{
+		Namespace: w.namespace,
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot retrieve the results of the run: %v", err)
+	}
+
+	var files []string
+	var untarErr error
+	untarred := make(chan struct{})
+	go func() {
+		files, untarErr = client.UntarAll(reader, w.options.retrieveDir, "")
+		close(untarred)
+	}()
+	if retrieveErr := <-errc; retrieveErr != nil {
+		return "", fmt.Errorf("cannot retrieve the results of the run: %v", retrieveErr)
+	}
+	<-untarred
+	if untarErr != nil {
+		return "", fmt.Errorf("cannot write the results of the run: %v", untarErr)
+	}
+
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".tar.gz") {
+			continue
+		}
+		if run, saveErr := saveRun(file, w.options.tceVersion); saveErr != nil {
+			fmt.Fprintf(os.Stderr, "Cannot record %s in the results history: %v\n", file, saveErr)
+		} else {
+			fmt.Fprintf(os.Stderr, "Recorded results as run %s\n", run.ID)
+		}
+		return file, nil
+	}
+	return "", fmt.Errorf("no results tarball retrieved from the run")
+}
+
+// printTestSummary prints the test counts of every plugin of a run
+func printTestSummary(out io.Writer, tarball string) error {
+	results, err := readRunResults(tarball)
+	if err != nil {
+		return err
+	}
+	data := newReportData(tarball, results)
+
+	t := component.NewOutputWriter(out, string(component.TableOutputType), "PLUGIN", "PASSED", "FAILED", "SKIPPED")
+	for _, p := range data.Plugins {
+		t.AddRow(p.Name, p.Passed, p.Failed, p.Skipped)
+	}
+	t.AddRow("total", data.Passed, data.Failed, data.Skipped)
+	t.Render()
+	return nil
+}
+
+// printPluginSummary prints the result of every plugin of a run, when its
+// results are not retrieved
+func printPluginSummary(out io.Writer, status *aggregation.Status) {
+	plugins := append([]aggregation.PluginStatus{}, status.Plugins...)
+	sort.Slice(plugins, func(i, j int) bool {
+		return pluginStatusName(plugins[i]) < pluginStatusName(plugins[j])
+	})
+
+	t := component.NewOutputWriter(out, string(component.TableOutputType), "PLUGIN", "STATUS", "RESULT")
+	for _, p := range plugins {
+		t.AddRow(pluginStatusName(p), p.Status, p.ResultStatus)
+	}
+	t.Render()
+}
+
+// deleteResources deletes the namespace and cluster resources of the run
+func (w *workflow) deleteResources() error {
+	fmt.Fprintf(os.Stderr, "Deleting the Sonobuoy resources in namespace %s\n", w.namespace)
+	return w.client.Delete(&client.DeleteConfig{
+		Namespace:  w.namespace,
+		EnableRBAC: true,
+		Wait:       deleteTimeout,
+	})
+}
@@ -6,6 +6,10 @@ require (
 	github.com/spf13/cobra v1.2.1
 	github.com/vmware-tanzu/crash-diagnostics v0.3.4
 	github.com/vmware-tanzu/tanzu-framework v0.10.0
+	k8s.io/api v0.21.2
+	k8s.io/apimachinery v0.21.2
+	k8s.io/client-go v0.21.2
 	sigs.k8s.io/controller-runtime v0.9.0 // indirect
 	sigs.k8s.io/kind v0.11.1
+	sigs.k8s.io/yaml v1.2.0
 )
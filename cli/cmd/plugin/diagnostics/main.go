@@ -5,6 +5,7 @@ package main
 
 import (
 	"embed"
+	"errors"
 	"log"
 	"os"
 
@@ -37,8 +38,15 @@ func main() {
 		log.Fatal(err)
 	}
 
-	p.AddCommands(pkg.CollectCmd(scriptFS))
+	p.AddCommands(
+		pkg.CollectCmd(scriptFS),
+		pkg.AnalyzeCmd(),
+	)
 	if err := p.Execute(); err != nil {
+		var collectErr *pkg.CollectError
+		if errors.As(err, &collectErr) {
+			os.Exit(collectErr.ExitCode())
+		}
 		os.Exit(1)
 	}
 }
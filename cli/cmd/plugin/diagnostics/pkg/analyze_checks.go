@@ -0,0 +1,200 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type severity string
+
+const (
+	severityCritical severity = "critical"
+	severityWarning  severity = "warning"
+
+	// certificates expiring within this window are reported
+	certExpiryWarningWindow = 30 * 24 * time.Hour
+)
+
+var severityRank = map[severity]int{
+	severityCritical: 0,
+	severityWarning:  1,
+}
+
+// finding is a problem detected by a check in a diagnostics bundle
+type finding struct {
+	Severity severity `json:"severity"`
+	Check    string   `json:"check"`
+	Object   string   `json:"object"`
+	Message  string   `json:"message"`
+	Source   string   `json:"source"`
+}
+
+// analyzerCheck inspects one API object and returns the problems found
+type analyzerCheck struct {
+	name string
+	run  func(obj *bundleObject, now time.Time) []finding
+}
+
+var analyzerChecks = []analyzerCheck{
+	{name: "pod-crashloop", run: checkPodCrashLoop},
+	{name: "pod-image-pull", run: checkPodImagePull},
+	{name: "app-reconcile-failed", run: checkAppReconcileFailed},
+	{name: "machine-without-node", run: checkMachineNodeRef},
+	{name: "certificate-expiry", run: checkCertificateExpiry},
+}
+
+// runChecks runs all checks against the objects and returns the ranked findings
+func runChecks(objects []bundleObject, now time.Time) []finding {
+	findings := []finding{}
+	for i := range objects {
+		for _, check := range analyzerChecks {
+			for _, f := range check.run(&objects[i], now) {
+				f.Check = check.name
+				f.Object = objects[i].ref()
+				f.Source = objects[i].source
+				findings = append(findings, f)
+			}
+		}
+	}
+	sortFindings(findings)
+	return findings
+}
+
+// waitingContainers returns the containers of a pod waiting for the provided reasons
+func waitingContainers(obj *bundleObject, reasons ...string) map[string]string {
+	result := make(map[string]string)
+	if obj.kind() != "Pod" {
+		return result
+	}
+
+	statuses := nestedMaps(obj.obj, "status", "containerStatuses")
+	statuses = append(statuses, nestedMaps(obj.obj, "status", "initContainerStatuses")...)
+	for _, status := range statuses {
+		reason := nestedString(status, "state", "waiting", "reason")
+		for _, r := range reasons {
+			if reason == r {
+				result[nestedString(status, "name")] = reason
+			}
+		}
+	}
+	return result
+}
+
+// checkPodCrashLoop reports pods in CrashLoopBackOff. Crashing Cluster API
+// controllers (capi-* namespaces) prevent any cluster operation and are
+// reported as critical.
+func checkPodCrashLoop(obj *bundleObject, _ time.Time) []finding {
+	sev := severityWarning
+	if strings.HasPrefix(obj.namespace(), "capi-") {
+		sev = severityCritical
+	}
+
+	var findings []finding
+	for container := range waitingContainers(obj, "CrashLoopBackOff") {
+		findings = append(findings, finding{
+			Severity: sev,
+			Message:  fmt.Sprintf("container %s is in CrashLoopBackOff", container),
+		})
+	}
+	return findings
+}
+
+func checkPodImagePull(obj *bundleObject, _ time.Time) []finding {
+	var findings []finding
+	for container, reason := range waitingContainers(obj, "ImagePullBackOff", "ErrImagePull") {
+		findings = append(findings, finding{
+			Severity: severityWarning,
+			Message:  fmt.Sprintf("container %s cannot pull its image: %s", container, reason),
+		})
+	}
+	return findings
+}
+
+// checkAppReconcileFailed reports kapp-controller Apps which failed to reconcile.
+// Failures in tkg-system affect core cluster packages and are reported as critical.
+func checkAppReconcileFailed(obj *bundleObject, _ time.Time) []finding {
+	if obj.kind() != "App" || obj.group() != "kappctrl.k14s.io" {
+		return nil
+	}
+
+	for _, cond := range nestedMaps(obj.obj, "status", "conditions") {
+		if nestedString(cond, "type") != "ReconcileFailed" || nestedString(cond, "status") != "True" {
+			continue
+		}
+
+		sev := severityWarning
+		if obj.namespace() == "tkg-system" {
+			sev = severityCritical
+		}
+
+		msg := nestedString(obj.obj, "status", "usefulErrorMessage")
+		if msg == "" {
+			msg = nestedString(cond, "message")
+		}
+		return []finding{{
+			Severity: sev,
+			Message:  strings.TrimSpace(fmt.Sprintf("app reconcile failed: %s", firstLine(msg))),
+		}}
+	}
+	return nil
+}
+
+// checkMachineNodeRef reports Cluster API machines not backed by a node
+func checkMachineNodeRef(obj *bundleObject, _ time.Time) []finding {
+	if obj.kind() != "Machine" || obj.group() != "cluster.x-k8s.io" {
+		return nil
+	}
+	if _, ok := nestedField(obj.obj, "status", "nodeRef"); ok {
+		return nil
+	}
+
+	phase := nestedString(obj.obj, "status", "phase")
+	sev := severityWarning
+	if phase == "Failed" {
+		sev = severityCritical
+	}
+
+	msg := fmt.Sprintf("machine has no nodeRef (phase: %s)", phase)
+	if reason := nestedString(obj.obj, "status", "failureMessage"); reason != "" {
+		msg = fmt.Sprintf("%s: %s", msg, firstLine(reason))
+	}
+	return []finding{{Severity: sev, Message: msg}}
+}
+
+// checkCertificateExpiry reports cert-manager certificates that are expired
+// or about to expire
+func checkCertificateExpiry(obj *bundleObject, now time.Time) []finding {
+	if obj.kind() != "Certificate" || obj.group() != "cert-manager.io" {
+		return nil
+	}
+
+	notAfter, err := time.Parse(time.RFC3339, nestedString(obj.obj, "status", "notAfter"))
+	if err != nil {
+		return nil
+	}
+
+	switch {
+	case notAfter.Before(now):
+		return []finding{{
+			Severity: severityCritical,
+			Message:  fmt.Sprintf("certificate expired on %s", notAfter.Format(time.RFC3339)),
+		}}
+	case notAfter.Before(now.Add(certExpiryWarningWindow)):
+		return []finding{{
+			Severity: severityWarning,
+			Message:  fmt.Sprintf("certificate expires on %s", notAfter.Format(time.RFC3339)),
+		}}
+	}
+	return nil
+}
+
+func firstLine(s string) string {
+	if i := strings.Index(s, "\n"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,131 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func newBundleObject(t *testing.T, doc string) bundleObject {
+	t.Helper()
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(doc), &obj); err != nil {
+		t.Fatal(err)
+	}
+	return bundleObject{source: "objects.json", obj: obj}
+}
+
+func TestAnalyzerChecks(t *testing.T) {
+	now := time.Date(2021, 10, 18, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		object   string
+		check    string
+		severity severity
+	}{
+		{
+			name:     "crashing pod",
+			object:   `{"kind": "Pod", "apiVersion": "v1", "metadata": {"namespace": "default", "name": "app"}, "status": {"containerStatuses": [{"name": "app", "state": {"waiting": {"reason": "CrashLoopBackOff"}}}]}}`,
+			check:    "pod-crashloop",
+			severity: severityWarning,
+		},
+		{
+			name:     "crashing Cluster API controller",
+			object:   `{"kind": "Pod", "apiVersion": "v1", "metadata": {"namespace": "capi-system", "name": "capi-controller-manager"}, "status": {"containerStatuses": [{"name": "manager", "state": {"waiting": {"reason": "CrashLoopBackOff"}}}]}}`,
+			check:    "pod-crashloop",
+			severity: severityCritical,
+		},
+		{
+			name:     "pod pulling its image",
+			object:   `{"kind": "Pod", "apiVersion": "v1", "metadata": {"namespace": "default", "name": "app"}, "status": {"initContainerStatuses": [{"name": "init", "state": {"waiting": {"reason": "ErrImagePull"}}}]}}`,
+			check:    "pod-image-pull",
+			severity: severityWarning,
+		},
+		{
+			name:     "failed app",
+			object:   `{"kind": "App", "apiVersion": "kappctrl.k14s.io/v1alpha1", "metadata": {"namespace": "default", "name": "app"}, "status": {"conditions": [{"type": "ReconcileFailed", "status": "True", "message": "failed"}]}}`,
+			check:    "app-reconcile-failed",
+			severity: severityWarning,
+		},
+		{
+			name:     "failed core package app",
+			object:   `{"kind": "App", "apiVersion": "kappctrl.k14s.io/v1alpha1", "metadata": {"namespace": "tkg-system", "name": "antrea"}, "status": {"usefulErrorMessage": "kapp: Error\nmore", "conditions": [{"type": "ReconcileFailed", "status": "True"}]}}`,
+			check:    "app-reconcile-failed",
+			severity: severityCritical,
+		},
+		{
+			name:     "provisioning machine",
+			object:   `{"kind": "Machine", "apiVersion": "cluster.x-k8s.io/v1alpha3", "metadata": {"namespace": "default", "name": "md-0"}, "status": {"phase": "Provisioning"}}`,
+			check:    "machine-without-node",
+			severity: severityWarning,
+		},
+		{
+			name:     "failed machine",
+			object:   `{"kind": "Machine", "apiVersion": "cluster.x-k8s.io/v1alpha3", "metadata": {"namespace": "default", "name": "md-0"}, "status": {"phase": "Failed", "failureMessage": "no capacity"}}`,
+			check:    "machine-without-node",
+			severity: severityCritical,
+		},
+		{
+			name:     "expired certificate",
+			object:   `{"kind": "Certificate", "apiVersion": "cert-manager.io/v1", "metadata": {"namespace": "default", "name": "cert"}, "status": {"notAfter": "2021-10-01T00:00:00Z"}}`,
+			check:    "certificate-expiry",
+			severity: severityCritical,
+		},
+		{
+			name:     "expiring certificate",
+			object:   `{"kind": "Certificate", "apiVersion": "cert-manager.io/v1", "metadata": {"namespace": "default", "name": "cert"}, "status": {"notAfter": "2021-11-01T00:00:00Z"}}`,
+			check:    "certificate-expiry",
+			severity: severityWarning,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			findings := runChecks([]bundleObject{newBundleObject(t, test.object)}, now)
+			if len(findings) != 1 {
+				t.Fatalf("expected 1 finding, got %+v", findings)
+			}
+			if findings[0].Check != test.check || findings[0].Severity != test.severity {
+				t.Errorf("expected a %s finding of check %s, got %+v", test.severity, test.check, findings[0])
+			}
+			if findings[0].Source != "objects.json" {
+				t.Errorf("expected the source of the object, got %q", findings[0].Source)
+			}
+		})
+	}
+}
+
+func TestAnalyzerChecksHealthyObjects(t *testing.T) {
+	now := time.Date(2021, 10, 18, 0, 0, 0, 0, time.UTC)
+	objects := []bundleObject{
+		newBundleObject(t, `{"kind": "Pod", "apiVersion": "v1", "metadata": {"name": "app"}, "status": {"containerStatuses": [{"name": "app", "state": {"running": {}}}]}}`),
+		newBundleObject(t, `{"kind": "App", "apiVersion": "kappctrl.k14s.io/v1alpha1", "metadata": {"name": "app"}, "status": {"conditions": [{"type": "ReconcileSucceeded", "status": "True"}]}}`),
+		newBundleObject(t, `{"kind": "Machine", "apiVersion": "cluster.x-k8s.io/v1alpha3", "metadata": {"name": "md-0"}, "status": {"phase": "Running", "nodeRef": {"name": "node"}}}`),
+		newBundleObject(t, `{"kind": "Certificate", "apiVersion": "cert-manager.io/v1", "metadata": {"name": "cert"}, "status": {"notAfter": "2022-10-01T00:00:00Z"}}`),
+		// a kind of another group is not checked
+		newBundleObject(t, `{"kind": "Machine", "apiVersion": "example.com/v1", "metadata": {"name": "other"}}`),
+	}
+
+	if findings := runChecks(objects, now); len(findings) != 0 {
+		t.Errorf("expected no finding, got %+v", findings)
+	}
+}
+
+func TestRunChecksRanksFindings(t *testing.T) {
+	now := time.Date(2021, 10, 18, 0, 0, 0, 0, time.UTC)
+	objects := []bundleObject{
+		newBundleObject(t, `{"kind": "Machine", "apiVersion": "cluster.x-k8s.io/v1alpha3", "metadata": {"namespace": "default", "name": "md-0"}, "status": {"phase": "Provisioning"}}`),
+		newBundleObject(t, `{"kind": "Certificate", "apiVersion": "cert-manager.io/v1", "metadata": {"namespace": "default", "name": "cert"}, "status": {"notAfter": "2021-10-01T00:00:00Z"}}`),
+	}
+
+	findings := runChecks(objects, now)
+	if len(findings) != 2 || findings[0].Severity != severityCritical || findings[1].Severity != severityWarning {
+		t.Errorf("expected the critical finding first, got %+v", findings)
+	}
+	if findings[0].Object != "Certificate/default/cert" {
+		t.Errorf("expected the reference of the object, got %q", findings[0].Object)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+type analyzeArgs struct {
+	output string
+}
+
+var analyzeOpts = analyzeArgs{
+	output: outputText,
+}
+
+// analysisReport is the result of analyzing a diagnostics bundle
+type analysisReport struct {
+	Bundle   string    `json:"bundle"`
+	Objects  int       `json:"objects"`
+	Findings []finding `json:"findings"`
+}
+
+// bundleObject is an API object found in a diagnostics bundle
+type bundleObject struct {
+	source string
+	obj    map[string]interface{}
+}
+
+func AnalyzeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "analyze <bundle.tar.gz>",
+		Short: "Analyze a collected diagnostics bundle",
+		Long:  `Analyze a diagnostics bundle, collected with the collect command, and report known problems ranked by severity`,
+		Args:  cobra.ExactArgs(1),
+		RunE:  analyzeFunc,
+	}
+
+	cmd.Flags().StringVarP(&analyzeOpts.output, "output", "o", analyzeOpts.output, "Output format (text|json)")
+
+	return cmd
+}
+
+func analyzeFunc(cmd *cobra.Command, args []string) error {
+	if analyzeOpts.output != outputText && analyzeOpts.output != outputJSON {
+		return fmt.Errorf("analyze: unsupported output format: %s", analyzeOpts.output)
+	}
+	cmd.SilenceUsage = true
+
+	objects, err := readBundleObjects(args[0])
+	if err != nil {
+		return fmt.Errorf("analyze: %w", err)
+	}
+
+	report := analysisReport{
+		Bundle:   args[0],
+		Objects:  len(objects),
+		Findings: runChecks(objects, time.Now()),
+	}
+
+	if analyzeOpts.output == outputJSON {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return printAnalysisReport(cmd.OutOrStdout(), &report)
+}
+
+func printAnalysisReport(out io.Writer, report *analysisReport) error {
+	fmt.Fprintf(out, "Analyzed %d object(s) in %s: %d finding(s)\n\n", report.Objects, report.Bundle, len(report.Findings))
+	if len(report.Findings) == 0 {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SEVERITY\tCHECK\tOBJECT\tMESSAGE")
+	for _, f := range report.Findings {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Severity, f.Check, f.Object, f.Message)
+	}
+	return w.Flush()
+}
+
+// readBundleObjects returns the API objects stored as JSON in a diagnostics
+// archive, whether it was created for a single cluster or as a single bundle
+func readBundleObjects(bundleFile string) ([]bundleObject, error) {
+	file, err := os.Open(bundleFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gzReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", bundleFile, err)
+	}
+	defer gzReader.Close()
+
+	var objects []bundleObject
+	tarReader := tar.NewReader(gzReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", bundleFile, err)
+		}
+
+		name := path.Base(header.Name)
+		if header.Typeflag != tar.TypeReg || path.Ext(name) != ".json" || name == manifestFile || name == redactionReportFile {
+			continue
+		}
+
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", bundleFile, header.Name, err)
+		}
+
+		var doc map[string]interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			// not an API object
+			continue
+		}
+		objects = append(objects, flattenObjects(header.Name, doc)...)
+	}
+
+	return objects, nil
+}
+
+// flattenObjects returns the items of an object list or the object itself
+func flattenObjects(source string, doc map[string]interface{}) []bundleObject {
+	items, ok := doc["items"].([]interface{})
+	if !ok {
+		if _, ok := doc["kind"].(string); !ok {
+			return nil
+		}
+		return []bundleObject{{source: source, obj: doc}}
+	}
+
+	var objects []bundleObject
+	for _, item := range items {
+		if obj, ok := item.(map[string]interface{}); ok {
+			objects = append(objects, flattenObjects(source, obj)...)
+		}
+	}
+	return objects
+}
+
+func (o *bundleObject) kind() string {
+	return nestedString(o.obj, "kind")
+}
+
+func (o *bundleObject) group() string {
+	apiVersion := nestedString(o.obj, "apiVersion")
+	if i := strings.Index(apiVersion, "/"); i >= 0 {
+		return apiVersion[:i]
+	}
+	return ""
+}
+
+func (o *bundleObject) namespace() string {
+	return nestedString(o.obj, "metadata", "namespace")
+}
+
+func (o *bundleObject) name() string {
+	return nestedString(o.obj, "metadata", "name")
+}
+
+// ref returns a kind/namespace/name reference to the object
+func (o *bundleObject) ref() string {
+	if o.namespace() == "" {
+		return fmt.Sprintf("%s/%s", o.kind(), o.name())
+	}
+	return fmt.Sprintf("%s/%s/%s", o.kind(), o.namespace(), o.name())
+}
+
+func nestedField(obj map[string]interface{}, fields ...string) (interface{}, bool) {
+	var value interface{} = obj
+	for _, field := range fields {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[field]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func nestedString(obj map[string]interface{}, fields ...string) string {
+	value, _ := nestedField(obj, fields...)
+	s, _ := value.(string)
+	return s
+}
+
+func nestedMaps(obj map[string]interface{}, fields ...string) []map[string]interface{} {
+	value, _ := nestedField(obj, fields...)
+	items, _ := value.([]interface{})
+
+	var result []map[string]interface{}
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// sortFindings ranks findings by severity, then by check and object
+func sortFindings(findings []finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Severity != findings[j].Severity {
+			return severityRank[findings[i].Severity] < severityRank[findings[j].Severity]
+		}
+		if findings[i].Check != findings[j].Check {
+			return findings[i].Check < findings[j].Check
+		}
+		return findings[i].Object < findings[j].Object
+	})
+}
@@ -0,0 +1,99 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// archiveSource is a file or directory that is added to an archive.
+// Its content is stored under name, or at the root of the archive when
+// name is empty.
+type archiveSource struct {
+	path string
+	name string
+}
+
+// writeArchive writes the provided sources into a gzipped tarball at outputFile
+func writeArchive(outputFile string, sources ...archiveSource) (err error) {
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0744); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("archive: %w", err)
+	}
+
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	gzWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzWriter)
+
+	for _, src := range sources {
+		if err := addToArchive(tarWriter, src); err != nil {
+			return fmt.Errorf("archive: %s: %w", src.path, err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	return gzWriter.Close()
+}
+
+func addToArchive(tarWriter *tar.Writer, src archiveSource) error {
+	return filepath.Walk(src.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// only directories and regular files are archived
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src.path, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join(src.name, rel))
+		if name == "." {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tarWriter, file)
+		return err
+	})
+}
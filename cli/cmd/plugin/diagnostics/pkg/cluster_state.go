@@ -0,0 +1,260 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	eventsDir  = "events"
+	nodesDir   = "nodes"
+	metricsDir = "metrics"
+
+	mebibyte = 1024 * 1024
+)
+
+var (
+	nodeMetricsGVR = schema.GroupVersionResource{
+		Group:    "metrics.k8s.io",
+		Version:  "v1beta1",
+		Resource: "nodes",
+	}
+
+	podMetricsGVR = schema.GroupVersionResource{
+		Group:    "metrics.k8s.io",
+		Version:  "v1beta1",
+		Resource: "pods",
+	}
+)
+
+// captureClusterState writes the events of the phase namespaces as a single
+// timeline, the node conditions and, when metrics-server is installed, the
+// resource usage of nodes and pods into the phase workdir
+func captureClusterState(result *phaseResult, kubeconfig, kubecontext string) {
+	log.Printf("Capturing events, nodes and metrics: cluster=%s; context=%s", result.Cluster, kubecontext)
+
+	cfg, err := newRestConfig(kubeconfig, kubecontext)
+	if err != nil {
+		log.Printf("Warn: cluster state not collected: cluster %s: %s", result.Cluster, err)
+		return
+	}
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		log.Printf("Warn: cluster state not collected: cluster %s: %s", result.Cluster, err)
+		return
+	}
+	dynClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		log.Printf("Warn: cluster state not collected: cluster %s: %s", result.Cluster, err)
+		return
+	}
+
+	if err := captureEvents(client, result.Namespaces, filepath.Join(result.workdir, eventsDir)); err != nil {
+		log.Printf("Warn: events not collected: cluster %s: %s", result.Cluster, err)
+	}
+	if err := captureNodes(client, filepath.Join(result.workdir, nodesDir)); err != nil {
+		log.Printf("Warn: nodes not collected: cluster %s: %s", result.Cluster, err)
+	}
+
+	captured, err := captureMetrics(dynClient, result.Namespaces, filepath.Join(result.workdir, metricsDir))
+	switch {
+	case err != nil:
+		log.Printf("Warn: metrics not collected: cluster %s: %s", result.Cluster, err)
+	case !captured:
+		log.Printf("metrics-server not found: metrics not collected: cluster %s", result.Cluster)
+	}
+	result.Metrics = captured
+}
+
+// captureEvents writes the events of the namespaces, sorted by time, as
+// events.json and as a human readable timeline.txt
+func captureEvents(client kubernetes.Interface, namespaces []string, dir string) error {
+	events := &corev1.EventList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"}}
+	for _, ns := range namespaces {
+		list, err := client.CoreV1().Events(ns).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			log.Printf("Warn: events not collected: namespace %s: %s", ns, err)
+			continue
+		}
+		events.Items = append(events.Items, list.Items...)
+	}
+
+	sort.SliceStable(events.Items, func(i, j int) bool {
+		return eventTime(&events.Items[i]).Before(eventTime(&events.Items[j]))
+	})
+
+	if err := writeJSON(filepath.Join(dir, "events.json"), events); err != nil {
+		return err
+	}
+	return writeTable(filepath.Join(dir, "timeline.txt"), func(w io.Writer) {
+		fmt.Fprintln(w, "TIME\tNAMESPACE\tTYPE\tREASON\tOBJECT\tCOUNT\tMESSAGE")
+		for i := range events.Items {
+			ev := &events.Items[i]
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s/%s\t%d\t%s\n",
+				eventTime(ev).UTC().Format(time.RFC3339), ev.Namespace, ev.Type, ev.Reason,
+				strings.ToLower(ev.InvolvedObject.Kind), ev.InvolvedObject.Name, ev.Count,
+				strings.TrimSpace(firstLine(ev.Message)))
+		}
+	})
+}
+
+// eventTime returns the last time an event occurred
+func eventTime(ev *corev1.Event) time.Time {
+	switch {
+	case !ev.LastTimestamp.IsZero():
+		return ev.LastTimestamp.Time
+	case !ev.EventTime.IsZero():
+		return ev.EventTime.Time
+	case !ev.FirstTimestamp.IsZero():
+		return ev.FirstTimestamp.Time
+	}
+	return ev.CreationTimestamp.Time
+}
+
+// captureNodes writes the nodes as nodes.json and their conditions as conditions.txt
+func captureNodes(client kubernetes.Interface, dir string) error {
+	nodes, err := client.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	nodes.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "List"}
+
+	if err := writeJSON(filepath.Join(dir, "nodes.json"), nodes); err != nil {
+		return err
+	}
+	return writeTable(filepath.Join(dir, "conditions.txt"), func(w io.Writer) {
+		fmt.Fprintln(w, "NODE\tTYPE\tSTATUS\tREASON\tLAST TRANSITION\tMESSAGE")
+		for i := range nodes.Items {
+			for _, cond := range nodes.Items[i].Status.Conditions {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+					nodes.Items[i].Name, cond.Type, cond.Status, cond.Reason,
+					cond.LastTransitionTime.UTC().Format(time.RFC3339), strings.TrimSpace(firstLine(cond.Message)))
+			}
+		}
+	})
+}
+
+// captureMetrics writes the resource usage of the nodes, and of the pods of
+// the namespaces, as reported by metrics-server. It returns false when the
+// metrics API is not available.
+func captureMetrics(dynClient dynamic.Interface, namespaces []string, dir string) (bool, error) {
+	nodes, err := dynClient.Resource(nodeMetricsGVR).List(context.TODO(), metav1.ListOptions{})
+	if apierrors.IsNotFound(err) || apierrors.IsServiceUnavailable(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	err = writeTable(filepath.Join(dir, "top-nodes.txt"), func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tCPU(cores)\tMEMORY(bytes)")
+		for i := range nodes.Items {
+			usage, _, _ := unstructured.NestedStringMap(nodes.Items[i].Object, "usage")
+			fmt.Fprintf(w, "%s\t%s\t%s\n", nodes.Items[i].GetName(), formatCPU(usage["cpu"]), formatMemory(usage["memory"]))
+		}
+	})
+	if err != nil {
+		return true, err
+	}
+
+	var pods []unstructured.Unstructured
+	for _, ns := range namespaces {
+		list, err := dynClient.Resource(podMetricsGVR).Namespace(ns).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			log.Printf("Warn: pod metrics not collected: namespace %s: %s", ns, err)
+			continue
+		}
+		pods = append(pods, list.Items...)
+	}
+
+	return true, writeTable(filepath.Join(dir, "top-pods.txt"), func(w io.Writer) {
+		fmt.Fprintln(w, "NAMESPACE\tNAME\tCPU(cores)\tMEMORY(bytes)")
+		for i := range pods {
+			cpu, memory := podUsage(&pods[i])
+			fmt.Fprintf(w, "%s\t%s\t%dm\t%dMi\n", pods[i].GetNamespace(), pods[i].GetName(), cpu.MilliValue(), memory.Value()/mebibyte)
+		}
+	})
+}
+
+// podUsage sums the resource usage of the containers of a pod
+func podUsage(pod *unstructured.Unstructured) (cpu, memory resource.Quantity) {
+	containers, _, _ := unstructured.NestedSlice(pod.Object, "containers")
+	for _, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		usage, _, _ := unstructured.NestedStringMap(container, "usage")
+		if q, err := resource.ParseQuantity(usage["cpu"]); err == nil {
+			cpu.Add(q)
+		}
+		if q, err := resource.ParseQuantity(usage["memory"]); err == nil {
+			memory.Add(q)
+		}
+	}
+	return cpu, memory
+}
+
+func formatCPU(value string) string {
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return value
+	}
+	return fmt.Sprintf("%dm", q.MilliValue())
+}
+
+func formatMemory(value string) string {
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return value
+	}
+	return fmt.Sprintf("%dMi", q.Value()/mebibyte)
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0744); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// writeTable writes the rows printed by printRows, aligned in columns, into path
+func writeTable(path string, printRows func(w io.Writer)) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0744); err != nil && !os.IsExist(err) {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := tabwriter.NewWriter(file, 0, 0, 2, ' ', 0)
+	printRows(w)
+	return w.Flush()
+}
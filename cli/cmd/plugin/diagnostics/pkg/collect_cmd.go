@@ -10,7 +10,10 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
 	"sigs.k8s.io/kind/pkg/cluster"
@@ -25,12 +28,40 @@ var (
 	bootScriptPath = "scripts/bootstrap_cluster.star"
 	mgmtScriptPath = "scripts/management_cluster.star"
 	wcScriptPath   = "scripts/workload_cluster.star"
+
+	packagesScriptPath = "scripts/packages.star"
+)
+
+var (
+	capiNamespaces = []string{
+		"capi-kubeadm-bootstrap-system",
+		"capi-kubeadm-control-plane-system",
+		"capi-system",
+		"capi-webhook-system",
+	}
+
+	bootstrapNamespaces = append(append([]string{}, capiNamespaces...),
+		"capv-system",
+		"capa-system",
+		"cert-manager",
+		"tkg-system",
+	)
+
+	clusterNamespaces = append(append([]string{}, capiNamespaces...),
+		"cert-manager",
+		"tkg-system",
+		"kube-system",
+		"tkr-system",
+	)
 )
 
 var (
 	commonArgs = collectCommonArgs{
 		workDir:   getDefaultWorkdir(),
 		outputDir: getDefaultOutputDir(),
+		redact:    true,
+		scriptDir: getDefaultScriptDir(),
+		output:    outputText,
 	}
 
 	bootstrapArgs = collectBootsrapArgs{
@@ -42,8 +73,19 @@ var (
 	}
 
 	workloadArgs = collectWorkloadArgs{
-		standalone: false,
-		infra:      "docker",
+		standalone:  false,
+		infra:       "docker",
+		concurrency: 4,
+	}
+
+	packageArgs = collectPackageArgs{
+		skip: false,
+	}
+
+	logArgs = collectLogArgs{}
+
+	sshArgs = collectSSHArgs{
+		port: 22,
 	}
 )
 
@@ -69,6 +111,16 @@ func CollectCmd(fs embed.FS) *cobra.Command {
 	// common args
 	cmd.Flags().StringVar(&commonArgs.workDir, "work-dir", commonArgs.workDir, "Working directory for collected data")
 	cmd.Flags().StringVar(&commonArgs.outputDir, "output-dir", commonArgs.outputDir, "Output directory for collected bundle")
+	cmd.Flags().BoolVar(&commonArgs.singleBundle, "single-bundle", commonArgs.singleBundle, "If true, archives all collected diagnostics, along with a manifest.json, into a single bundle")
+	cmd.Flags().BoolVar(&commonArgs.redact, "redact", commonArgs.redact, "If true, redacts secrets and credentials from collected data before archiving")
+	cmd.Flags().StringVar(&commonArgs.redactionRules, "redaction-rules", commonArgs.redactionRules, "A YAML file with additional regex redaction rules")
+	cmd.Flags().StringVarP(&commonArgs.output, "output", "o", commonArgs.output, "Output format of the collection report (text|json)")
+	cmd.Flags().StringVar(&commonArgs.scriptDir, "script-dir", commonArgs.scriptDir, "A directory of additional Starlark collectors (*.star) run for each diagnosed cluster")
+
+	// log args
+	cmd.Flags().DurationVar(&logArgs.since, "since", logArgs.since, "Only collect pod logs newer than a relative duration (i.e. 5s, 2m, 3h)")
+	cmd.Flags().Int64Var(&logArgs.tailLines, "tail-lines", logArgs.tailLines, "The number of most recent lines collected from each pod log (0 for all lines)")
+	cmd.Flags().StringVar(&logArgs.maxBundleSize, "max-bundle-size", logArgs.maxBundleSize, "The maximum size of the data collected for each cluster (i.e. 500Mi, 2Gi); the largest logs are truncated to fit")
 
 	// bootstrap args
 	cmd.Flags().BoolVar(&bootstrapArgs.skip, "bootstrap-cluster-skip", bootstrapArgs.skip, "If true, skips bootstrap cluster diagnostics")
@@ -85,105 +137,261 @@ func CollectCmd(fs embed.FS) *cobra.Command {
 	cmd.Flags().StringVar(&workloadArgs.infra, "workload-cluster-infra", workloadArgs.infra, "Overrides the infrastructure type for the managed cluster (i.e. aws, azure, vsphere, etc)")
 	cmd.Flags().StringVar(&workloadArgs.clusterName, "workload-cluster-name", workloadArgs.clusterName, "The name of the managed cluster for which to collect diagnostics (required)")
 	cmd.Flags().StringVar(&workloadArgs.namespace, "workload-cluster-namespace", workloadArgs.namespace, "The namespace where managed workload resources are stored (required)")
+	cmd.Flags().StringSliceVar(&workloadArgs.clusterNames, "workload-cluster-names", workloadArgs.clusterNames, "A comma-separated list of managed clusters for which to collect diagnostics")
+	cmd.Flags().StringVar(&workloadArgs.selector, "workload-cluster-selector", workloadArgs.selector, "A label selector used to select managed clusters from the Cluster objects of the management cluster")
+	cmd.Flags().BoolVar(&workloadArgs.all, "all-workload-clusters", workloadArgs.all, "If true, collects diagnostics for all managed clusters of the management cluster")
+	cmd.Flags().IntVar(&workloadArgs.concurrency, "workload-cluster-concurrency", workloadArgs.concurrency, "The maximum number of managed clusters diagnosed concurrently")
+
+	// packages
+	cmd.Flags().BoolVar(&packageArgs.skip, "packages-skip", packageArgs.skip, "If true, skips the diagnostics of the packages installed in the management and workload clusters")
+
+	// node diagnostics over ssh
+	cmd.Flags().StringVar(&sshArgs.user, "ssh-user", sshArgs.user, "The user used to collect workload cluster node diagnostics over SSH (i.e. capv, ubuntu, ec2-user)")
+	cmd.Flags().StringVar(&sshArgs.privateKey, "ssh-private-key", sshArgs.privateKey, "The private key file used to collect workload cluster node diagnostics over SSH")
+	cmd.Flags().IntVar(&sshArgs.port, "ssh-port", sshArgs.port, "The SSH port of the workload cluster nodes")
+	cmd.Flags().StringVar(&sshArgs.jumpHost, "ssh-jump-host", sshArgs.jumpHost, "An optional jump host (bastion) used to reach the workload cluster nodes")
+	cmd.Flags().StringVar(&sshArgs.jumpUser, "ssh-jump-user", sshArgs.jumpUser, "The user for the jump host (defaults to --ssh-user)")
 
 	cmd.RunE = collectFunc
 	return cmd
 }
 
-func collectFunc(_ *cobra.Command, _ []string) error {
-	defer os.RemoveAll(commonArgs.workDir)
+func collectFunc(cmd *cobra.Command, _ []string) error {
+	if commonArgs.output != outputText && commonArgs.output != outputJSON {
+		return fmt.Errorf("collect: unsupported output format: %s", commonArgs.output)
+	}
+	if (sshArgs.user == "") != (sshArgs.privateKey == "") {
+		return fmt.Errorf("both --ssh-user and --ssh-private-key are required to collect node diagnostics")
+	}
+	cmd.SilenceUsage = true
 
-	if err := collectBoostrapDiags(); err != nil {
-		log.Printf("Warn: skipping bootstrap cluster diagnostics: %s", err)
+	maxBundleBytes, err := parseMaxBundleSize()
+	if err != nil {
+		return err
 	}
+	logArgs.maxBundleBytes = maxBundleBytes
 
-	if err := collectManagementDiags(); err != nil {
-		log.Printf("Warn: skipping management cluster diagnostics: %s", err)
+	collectors, err := findCollectors(commonArgs.scriptDir)
+	if err != nil {
+		return err
 	}
+	collectorScripts = collectors
 
-	if err := collectWorkloadDiags(); err != nil {
-		log.Printf("Warn: skipping workload cluster diagnostics: %s", err)
+	runDir, err := makeRunDir(commonArgs.workDir)
+	if err != nil {
+		return err
 	}
+	defer os.RemoveAll(runDir)
+	commonArgs.workDir = runDir
 
-	return nil
+	var red *redactor
+	if commonArgs.redact {
+		r, err := newRedactor(commonArgs.redactionRules)
+		if err != nil {
+			return err
+		}
+		red = r
+	} else {
+		log.Println("Warn: redaction disabled: collected data may contain secrets and credentials")
+	}
+
+	manifest := &collectManifest{StartTime: time.Now().UTC()}
+
+	manifest.Phases = append(manifest.Phases, collectBoostrapDiags(red)...)
+	manifest.Phases = append(manifest.Phases, collectManagementDiags(red))
+	manifest.Phases = append(manifest.Phases, collectWorkloadDiags(red)...)
+	manifest.Phases = append(manifest.Phases, collectPackageDiags(red, manifest.Phases)...)
+
+	for i := range manifest.Phases {
+		if manifest.Phases[i].Status == phaseFailed {
+			log.Printf("Warn: skipping %s cluster diagnostics: %s", manifest.Phases[i].Phase, manifest.Phases[i].Error)
+		}
+	}
+	manifest.EndTime = time.Now().UTC()
+
+	var bundleFile string
+	if commonArgs.singleBundle {
+		if bundleFile, err = writeBundle(manifest); err != nil {
+			return fmt.Errorf("diagnostics bundle: %w", err)
+		}
+	}
+
+	report := newCollectReport(manifest, bundleFile)
+	if err := printCollectReport(cmd.OutOrStdout(), report, commonArgs.output); err != nil {
+		return err
+	}
+	return report.err()
 }
 
-func collectBoostrapDiags() error {
-	if bootstrapArgs.skip {
-		log.Println("bootstrap cluster: skip=true: diagnostics will not be collected")
-		return nil
+// makeRunDir creates a directory of its own for the collection, so that the
+// content of the work directory (i.e. collectors.d) is left untouched
+func makeRunDir(workDir string) (string, error) {
+	if err := os.MkdirAll(workDir, 0744); err != nil && !os.IsExist(err) {
+		return "", fmt.Errorf("work dir: %w", err)
+	}
+	runDir, err := os.MkdirTemp(workDir, "collect-")
+	if err != nil {
+		return "", fmt.Errorf("work dir: %w", err)
 	}
+	return runDir, nil
+}
 
-	libScript := libScriptPath
-	libData, err := scriptFS.ReadFile(libScript)
+// archiveFileName returns the path of the diagnostics archive for a cluster
+func archiveFileName(prefix, clusterName string) string {
+	return filepath.Join(commonArgs.outputDir, fmt.Sprintf("%s.%s.diagnostics.tar.gz", prefix, clusterName))
+}
+
+// runScript executes an embedded script with the lib.star module loaded
+func runScript(scriptName string, argsMap crashdexec.ArgMap) error {
+	libData, err := scriptFS.ReadFile(libScriptPath)
 	if err != nil {
 		return err
 	}
 
-	scriptName := bootScriptPath
 	scriptData, err := scriptFS.ReadFile(scriptName)
 	if err != nil {
 		return err
 	}
 
-	// setup workdir
-	if err := os.MkdirAll(commonArgs.workDir, 0744); err != nil && !os.IsExist(err) {
-		return fmt.Errorf("bootstrap cluster: %w", err)
+	return crashdexec.ExecuteWithModules(
+		scriptName,
+		bytes.NewReader(scriptData),
+		argsMap,
+		crashdexec.StarlarkModule{Name: libScriptPath, Source: bytes.NewReader(libData)},
+	)
+}
+
+// collectorArgs returns the args of a phase script extended with the phase,
+// kubeconfig and context of the diagnosed cluster, so that collectors work
+// the same way whatever the phase
+func collectorArgs(result *phaseResult, argsMap crashdexec.ArgMap, kubeconfig string) crashdexec.ArgMap {
+	args := crashdexec.ArgMap{
+		"phase":        result.Phase,
+		"cluster_name": result.Cluster,
+		"kubeconfig":   kubeconfig,
+		"kube_context": result.Context,
+	}
+	for k, v := range argsMap {
+		args[k] = v
+	}
+	return args
+}
+
+// archiveDiags limits the size of the data collected in the phase workdir,
+// redacts it when a redactor is provided, then archives it into archiveFile and removes the
+// workdir. When a single bundle is requested, the workdir is kept to be
+// archived with the other phases.
+func archiveDiags(red *redactor, result *phaseResult, archiveFile string) error {
+	if logArgs.maxBundleBytes > 0 {
+		truncated, err := limitDirSize(result.workdir, logArgs.maxBundleBytes)
+		if err != nil {
+			return err
+		}
+		if len(truncated) > 0 && result.Logs != nil {
+			result.Logs.Truncated = true
+			result.Logs.TruncatedFiles = truncated
+		}
+	}
+
+	if red != nil {
+		report, err := red.redactDir(result.workdir)
+		if err != nil {
+			return err
+		}
+		log.Printf("Redacted %d value(s) in %d file(s): %s", report.TotalRedactions, len(report.Files), result.workdir)
+	}
+
+	if commonArgs.singleBundle {
+		result.Archive = filepath.Base(result.workdir)
+		return nil
+	}
+
+	defer func() {
+		if err := os.RemoveAll(result.workdir); err != nil {
+			log.Printf("Warn: failed to remove work directory: %s: %s", result.workdir, err)
+		}
+	}()
+
+	log.Printf("Archiving: %s", archiveFile)
+	if err := writeArchive(archiveFile, archiveSource{path: result.workdir}); err != nil {
+		return err
+	}
+	result.Archive = archiveFile
+	return nil
+}
+
+func collectBoostrapDiags(red *redactor) []phaseResult {
+	result := newPhaseResult(phaseBootstrap, bootstrapArgs.clusterName)
+	if bootstrapArgs.skip {
+		log.Println("bootstrap cluster: skip=true: diagnostics will not be collected")
+		return []phaseResult{result.skip("skip requested")}
 	}
 
 	// loop through and collect diags from each cluster
 	prov := cluster.NewProvider(cluster.ProviderWithLogger(kindcmd.NewLogger()))
 	clusterList, err := prov.List()
 	if err != nil {
-		return err
+		return []phaseResult{result.done(err)}
 	}
 
 	clusters := getTanzuKindClusters(clusterList, bootstrapArgs.clusterName)
+	if len(clusters) == 0 && bootstrapArgs.clusterName == "" {
+		// bootstrap clusters only exist while management clusters are created
+		log.Println("bootstrap cluster: no kind cluster found: diagnostics will not be collected")
+		return []phaseResult{result.skip("no bootstrap cluster found")}
+	}
 	if len(clusters) == 0 {
-		return fmt.Errorf("bootstrap cluster: no kind cluster found")
+		return []phaseResult{result.done(fmt.Errorf("bootstrap cluster: kind cluster not found: %s", bootstrapArgs.clusterName))}
 	}
 
-	argsMap := crashdexec.ArgMap{
-		"workdir":                commonArgs.workDir,
-		"infra":                  "docker",
-		"bootstrap_cluster_name": bootstrapArgs.clusterName,
-		"outputdir":              commonArgs.outputDir,
+	var results []phaseResult
+	for _, cluster := range clusters {
+		results = append(results, collectBootstrapClusterDiags(red, prov, cluster))
 	}
+	return results
+}
 
-	for _, cluster := range clusters {
-		cfg, err := prov.KubeConfig(cluster, false)
-		if err != nil {
-			log.Printf("Warn: failed to get cluster kubeconfig, K8s object not collected: %s: %s", cluster, err)
-		}
+func collectBootstrapClusterDiags(red *redactor, prov *cluster.Provider, cluster string) phaseResult {
+	result := newPhaseResult(phaseBootstrap, cluster)
+	result.Context = fmt.Sprintf("kind-%s", cluster)
+	result.Namespaces = bootstrapNamespaces
+	result.Kinds = capturedKinds
+	result.workdir = filepath.Join(commonArgs.workDir, fmt.Sprintf("bootstrap.%s", cluster))
 
-		path := filepath.Join(commonArgs.workDir, fmt.Sprintf("%s.config", cluster))
-		if err := os.WriteFile(path, []byte(cfg), 0644); err != nil {
-			return fmt.Errorf("bootstrap diagnostics kubeconfig: %w", err)
-		}
+	cfg, err := prov.KubeConfig(cluster, false)
+	if err != nil {
+		log.Printf("Warn: failed to get cluster kubeconfig, K8s object not collected: %s: %s", cluster, err)
+	}
 
-		defer func(p string) {
-			if err := os.RemoveAll(p); err != nil {
-				log.Printf("Warn: bootstrap cluster: failed to remove kubeconfig file: %s", err)
-			}
-		}(path)
+	path := filepath.Join(commonArgs.workDir, fmt.Sprintf("%s.config", cluster))
+	if err := os.WriteFile(path, []byte(cfg), 0644); err != nil {
+		return result.done(fmt.Errorf("bootstrap diagnostics kubeconfig: %w", err))
+	}
 
-		log.Printf("Collecting bootstrap diagnostics: cluster: %s", cluster)
+	defer func() {
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("Warn: bootstrap cluster: failed to remove kubeconfig file: %s", err)
+		}
+	}()
 
-		argsMap["bootstrap_cluster_name"] = cluster
-		argsMap["bootstrap_kubeconfig"] = path
+	log.Printf("Collecting bootstrap diagnostics: cluster: %s", cluster)
 
-		err = crashdexec.ExecuteWithModules(
-			scriptName,
-			bytes.NewReader(scriptData),
-			argsMap,
-			crashdexec.StarlarkModule{Name: libScript, Source: bytes.NewReader(libData)},
-		)
-		if err != nil {
-			log.Printf("Warn: bootstrap script failed, skipping: cluster%s: %s: ", cluster, err)
-			continue
-		}
+	argsMap := crashdexec.ArgMap{
+		"workdir":                result.workdir,
+		"infra":                  "docker",
+		"bootstrap_cluster_name": cluster,
+		"bootstrap_kubeconfig":   path,
+		"namespaces":             strings.Join(result.Namespaces, ","),
 	}
-	return nil
+
+	if err := runScript(bootScriptPath, argsMap); err != nil {
+		return result.done(fmt.Errorf("bootstrap script failed: cluster %s: %w", cluster, err))
+	}
+	runCollectors(&result, collectorArgs(&result, argsMap, path))
+	captureLogs(&result, path, "")
+	captureClusterState(&result, path, "")
+
+	return result.done(archiveDiags(red, &result, archiveFileName("bootstrap", cluster)))
 }
 
 func getTanzuKindClusters(clusters []string, clusterName string) []string {
@@ -201,89 +409,146 @@ func getTanzuKindClusters(clusters []string, clusterName string) []string {
 	return result
 }
 
-func collectManagementDiags() error {
+func collectManagementDiags(red *redactor) phaseResult {
+	result := newPhaseResult(phaseManagement, mgmtArgs.clusterName)
 	if mgmtArgs.skip {
 		log.Println("management cluster: skip=true: diagnostics will not be collected")
-		return nil
+		return result.skip("skip requested")
 	}
 
+	if mgmtArgs.clusterName == "" && workloadArgs.standalone {
+		log.Println("management cluster: no management cluster for standalone workload cluster: diagnostics will not be collected")
+		return result.skip("no management cluster")
+	}
 	if mgmtArgs.clusterName == "" {
-		return fmt.Errorf("management cluster: name not set")
+		return result.done(fmt.Errorf("management cluster: name not set"))
 	}
 	if mgmtArgs.kubeconfig == "" {
-		return fmt.Errorf("management cluster: kubeconfig is required")
+		return result.done(fmt.Errorf("management cluster: kubeconfig is required"))
 	}
 	if mgmtArgs.contextName == "" {
 		mgmtArgs.contextName = getDefaultClusterContext(mgmtArgs.clusterName)
 	}
 
+	result.Context = mgmtArgs.contextName
+	result.Namespaces = clusterNamespaces
+	result.Kinds = capturedKinds
+	result.workdir = filepath.Join(commonArgs.workDir, fmt.Sprintf("management-cluster.%s", mgmtArgs.clusterName))
+	result.kubeconfig = mgmtArgs.kubeconfig
+
 	argsMap := crashdexec.ArgMap{
-		"workdir":                 commonArgs.workDir,
+		"workdir":                 result.workdir,
 		"management_cluster_name": mgmtArgs.clusterName,
 		"management_kubeconfig":   mgmtArgs.kubeconfig,
 		"management_context":      mgmtArgs.contextName,
-		"outputdir":               commonArgs.outputDir,
+		"namespaces":              strings.Join(result.Namespaces, ","),
 	}
 
-	libScript := libScriptPath
-	libData, err := scriptFS.ReadFile(libScript)
-	if err != nil {
-		return err
+	if err := runScript(mgmtScriptPath, argsMap); err != nil {
+		return result.done(err)
 	}
+	runCollectors(&result, collectorArgs(&result, argsMap, mgmtArgs.kubeconfig))
+	captureLogs(&result, mgmtArgs.kubeconfig, mgmtArgs.contextName)
+	captureClusterState(&result, mgmtArgs.kubeconfig, mgmtArgs.contextName)
 
-	scriptName := mgmtScriptPath
-	scriptData, err := scriptFS.ReadFile(scriptName)
+	return result.done(archiveDiags(red, &result, archiveFileName("management-cluster", mgmtArgs.clusterName)))
+}
+
+// collectWorkloadDiags collects diagnostics for every selected workload cluster,
+// running at most workloadArgs.concurrency collections at a time
+func collectWorkloadDiags(red *redactor) []phaseResult {
+	result := newPhaseResult(phaseWorkload, "")
+	clusters, err := getWorkloadClusters()
 	if err != nil {
-		return err
+		return []phaseResult{result.done(err)}
+	}
+	if len(clusters) == 0 {
+		log.Println("workload cluster: no workload cluster selected: diagnostics will not be collected")
+		return []phaseResult{result.skip("no workload cluster selected")}
 	}
 
-	return crashdexec.ExecuteWithModules(
-		scriptName,
-		bytes.NewReader(scriptData),
-		argsMap,
-		crashdexec.StarlarkModule{Name: libScript, Source: bytes.NewReader(libData)},
-	)
+	concurrency := workloadArgs.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]phaseResult, len(clusters))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range clusters {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = collectWorkloadClusterDiags(red, clusters[i])
+		}(i)
+	}
+	wg.Wait()
+
+	if len(results) > 1 {
+		for i := range results {
+			log.Printf("workload cluster: %s: %s", results[i].Cluster, results[i].Status)
+		}
+	}
+	return results
 }
 
-func collectWorkloadDiags() error {
-	if workloadArgs.clusterName == "" {
-		return fmt.Errorf("workload cluster: name not set")
+func collectWorkloadClusterDiags(red *redactor, wc workloadCluster) phaseResult {
+	result := newPhaseResult(phaseWorkload, wc.name)
+
+	infraNamespace := "capv-system"
+	if workloadArgs.infra == "aws" {
+		infraNamespace = "capa-system"
+	}
+
+	result.Context = getDefaultClusterContext(wc.name)
+	result.Namespaces = append(append([]string{}, clusterNamespaces...), infraNamespace)
+	result.Kinds = capturedKinds
+	result.workdir = filepath.Join(commonArgs.workDir, fmt.Sprintf("workload-cluster.%s", wc.name))
+	// non-standalone workload cluster credentials are exported by the workload
+	// script to a kubeconfig file of their own, outside of the phase workdir so
+	// that they are not archived. Clusters are collected concurrently, merging
+	// their credentials in the default kubeconfig would race. The file is kept
+	// for the package diagnostics of the cluster, and removed along with the
+	// run directory at the end of the collection.
+	result.kubeconfig = filepath.Join(commonArgs.workDir, fmt.Sprintf("workload-cluster.%s.kubeconfig", wc.name))
+	if workloadArgs.standalone {
+		result.kubeconfig = getDefaultKubeconfig()
 	}
 
 	argsMap := crashdexec.ArgMap{
-		"workdir":                 commonArgs.workDir,
+		"workdir":                 result.workdir,
 		"management_cluster_name": mgmtArgs.clusterName,
 		"management_kubeconfig":   mgmtArgs.kubeconfig,
 
 		"workload_infra":        workloadArgs.infra,
-		"workload_kubeconfig":   workloadArgs.kubeconfig,
-		"workload_cluster_name": workloadArgs.clusterName,
-		"workload_namespace":    workloadArgs.namespace,
+		"workload_kubeconfig":   result.kubeconfig,
+		"workload_cluster_name": wc.name,
+		"workload_namespace":    wc.namespace,
 
-		"outputdir": commonArgs.outputDir,
+		"namespaces": strings.Join(result.Namespaces, ","),
 	}
 
-	scriptName := wcScriptPath
 	if workloadArgs.standalone {
-		argsMap["workload_kubeconfig"] = getDefaultKubeconfig()
-		argsMap["workload_context"] = getDefaultClusterContext(workloadArgs.clusterName)
+		argsMap["workload_context"] = result.Context
 	}
 
-	libScript := libScriptPath
-	libData, err := scriptFS.ReadFile(libScript)
-	if err != nil {
-		return err
+	if sshArgs.user != "" {
+		argsMap["ssh_user"] = sshArgs.user
+		argsMap["ssh_pk_file"] = sshArgs.privateKey
+		argsMap["ssh_port"] = strconv.Itoa(sshArgs.port)
+		argsMap["ssh_jump_user"] = sshArgs.jumpUser
+		argsMap["ssh_jump_host"] = sshArgs.jumpHost
+		result.NodeDiagnostics = true
 	}
 
-	scriptData, err := scriptFS.ReadFile(scriptName)
-	if err != nil {
-		return err
+	if err := runScript(wcScriptPath, argsMap); err != nil {
+		return result.done(err)
 	}
+	runCollectors(&result, collectorArgs(&result, argsMap, result.kubeconfig))
+	captureLogs(&result, result.kubeconfig, result.Context)
+	captureClusterState(&result, result.kubeconfig, result.Context)
 
-	return crashdexec.ExecuteWithModules(
-		scriptName,
-		bytes.NewReader(scriptData),
-		argsMap,
-		crashdexec.StarlarkModule{Name: libScript, Source: bytes.NewReader(libData)},
-	)
+	return result.done(archiveDiags(red, &result, archiveFileName("workload-cluster", wc.name)))
 }
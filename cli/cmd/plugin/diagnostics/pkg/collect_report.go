@@ -0,0 +1,141 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+type collectStatus string
+
+const (
+	collectComplete collectStatus = "complete"
+	collectPartial  collectStatus = "partial"
+	collectNone     collectStatus = "none"
+)
+
+// Exit codes of the collect command, distinguishing collections where some
+// phases failed from collections where nothing was collected
+const (
+	ExitCodePartialCollection = 2
+	ExitCodeNothingCollected  = 3
+)
+
+// collectReport is the result of the collect command
+type collectReport struct {
+	Status    collectStatus `json:"status"`
+	Archives  []string      `json:"archives"`
+	StartTime time.Time     `json:"startTime"`
+	EndTime   time.Time     `json:"endTime"`
+	Phases    []phaseResult `json:"phases"`
+}
+
+// CollectError is returned by the collect command when diagnostics were not
+// collected for every cluster
+type CollectError struct {
+	status collectStatus
+	failed int
+}
+
+func (e *CollectError) Error() string {
+	if e.status == collectNone {
+		return "no diagnostics collected"
+	}
+	return fmt.Sprintf("partial diagnostics collected: %d phase(s) failed", e.failed)
+}
+
+// ExitCode returns the exit code of the collect command
+func (e *CollectError) ExitCode() int {
+	if e.status == collectNone {
+		return ExitCodeNothingCollected
+	}
+	return ExitCodePartialCollection
+}
+
+// newCollectReport summarizes the phases of the manifest, along with the
+// single bundle file when one was written
+func newCollectReport(manifest *collectManifest, bundleFile string) *collectReport {
+	report := &collectReport{
+		Archives:  []string{},
+		StartTime: manifest.StartTime,
+		EndTime:   manifest.EndTime,
+		Phases:    manifest.Phases,
+	}
+	if bundleFile != "" {
+		report.Archives = append(report.Archives, bundleFile)
+	}
+
+	var collected int
+	for i := range manifest.Phases {
+		if manifest.Phases[i].Status != phaseCollected {
+			continue
+		}
+		collected++
+		if bundleFile == "" {
+			report.Archives = append(report.Archives, manifest.Phases[i].Archive)
+		}
+	}
+
+	switch {
+	case collected == 0:
+		report.Status = collectNone
+	case report.failed() > 0:
+		report.Status = collectPartial
+	default:
+		report.Status = collectComplete
+	}
+	return report
+}
+
+func (r *collectReport) failed() int {
+	var failed int
+	for i := range r.Phases {
+		if r.Phases[i].Status == phaseFailed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// err returns the error matching the status of the collection
+func (r *collectReport) err() error {
+	if r.Status == collectComplete {
+		return nil
+	}
+	return &CollectError{status: r.Status, failed: r.failed()}
+}
+
+func printCollectReport(out io.Writer, report *collectReport, output string) error {
+	if output == outputJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PHASE\tCLUSTER\tSTATUS\tDETAILS")
+	for i := range report.Phases {
+		phase := &report.Phases[i]
+		details := phase.Archive
+		switch phase.Status {
+		case phaseFailed:
+			details = phase.Error
+		case phaseSkipped:
+			details = phase.Reason
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", phase.Phase, phase.Cluster, phase.Status, firstLine(details))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, archive := range report.Archives {
+		fmt.Fprintf(out, "Diagnostics archive: %s\n", archive)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCollectReport(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []phaseStatus
+		status   collectStatus
+		exitCode int
+	}{
+		{"all collected", []phaseStatus{phaseCollected, phaseSkipped, phaseCollected}, collectComplete, 0},
+		{"some failed", []phaseStatus{phaseCollected, phaseFailed}, collectPartial, ExitCodePartialCollection},
+		{"all failed", []phaseStatus{phaseFailed, phaseSkipped}, collectNone, ExitCodeNothingCollected},
+		{"all skipped", []phaseStatus{phaseSkipped}, collectNone, ExitCodeNothingCollected},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manifest := &collectManifest{}
+			for i, status := range test.statuses {
+				manifest.Phases = append(manifest.Phases, phaseResult{Phase: phaseWorkload, Status: status, Archive: string(rune('a' + i))})
+			}
+
+			report := newCollectReport(manifest, "")
+			if report.Status != test.status {
+				t.Errorf("expected status %s, got %s", test.status, report.Status)
+			}
+
+			err := report.err()
+			if test.exitCode == 0 {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			var collectErr *CollectError
+			if !errors.As(err, &collectErr) {
+				t.Fatalf("expected a collect error, got %v", err)
+			}
+			if collectErr.ExitCode() != test.exitCode {
+				t.Errorf("expected exit code %d, got %d", test.exitCode, collectErr.ExitCode())
+			}
+		})
+	}
+}
+
+func TestCollectReportArchives(t *testing.T) {
+	manifest := &collectManifest{Phases: []phaseResult{
+		{Phase: phaseManagement, Status: phaseCollected, Archive: "management.tar.gz"},
+		{Phase: phaseWorkload, Status: phaseFailed},
+	}}
+
+	if report := newCollectReport(manifest, ""); len(report.Archives) != 1 || report.Archives[0] != "management.tar.gz" {
+		t.Errorf("expected the archives of the collected phases, got %v", report.Archives)
+	}
+	if report := newCollectReport(manifest, "bundle.tar.gz"); len(report.Archives) != 1 || report.Archives[0] != "bundle.tar.gz" {
+		t.Errorf("expected the single bundle, got %v", report.Archives)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	crashdexec "github.com/vmware-tanzu/crash-diagnostics/exec"
+)
+
+// collectorScripts lists the user-provided collectors found in the script directory
+var collectorScripts []string
+
+// findCollectors returns the user-provided Starlark collectors (*.star) of
+// the script directory, in lexical order. A missing directory is not an error.
+func findCollectors(dir string) ([]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("script dir: %w", err)
+	}
+
+	scripts, err := filepath.Glob(filepath.Join(dir, "*.star"))
+	if err != nil {
+		return nil, fmt.Errorf("script dir: %w", err)
+	}
+	sort.Strings(scripts)
+	return scripts, nil
+}
+
+// runCollectors runs the user-provided collectors with the args of a phase
+// and the lib.star module loaded, so that their output is stored in the phase
+// workdir and archived with it. A failing collector does not fail the phase.
+func runCollectors(result *phaseResult, argsMap crashdexec.ArgMap) {
+	if len(collectorScripts) == 0 {
+		return
+	}
+
+	libData, err := scriptFS.ReadFile(libScriptPath)
+	if err != nil {
+		log.Printf("Warn: collectors not run: %s", err)
+		return
+	}
+
+	for _, script := range collectorScripts {
+		log.Printf("Running collector: %s: cluster=%s", script, result.Cluster)
+
+		scriptData, err := os.ReadFile(script)
+		if err != nil {
+			log.Printf("Warn: collector failed: %s: %s", script, err)
+			continue
+		}
+
+		err = crashdexec.ExecuteWithModules(
+			script,
+			bytes.NewReader(scriptData),
+			argsMap,
+			crashdexec.StarlarkModule{Name: libScriptPath, Source: bytes.NewReader(libData)},
+		)
+		if err != nil {
+			log.Printf("Warn: collector failed: %s: %s", script, err)
+			continue
+		}
+		result.Collectors = append(result.Collectors, filepath.Base(script))
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const logsDir = "logs"
+
+// logCapture records how pod logs were captured for a cluster
+type logCapture struct {
+	Since          string   `json:"since,omitempty"`
+	TailLines      int64    `json:"tailLines,omitempty"`
+	MaxSize        string   `json:"maxSize,omitempty"`
+	Truncated      bool     `json:"truncated"`
+	TruncatedFiles []string `json:"truncatedFiles,omitempty"`
+}
+
+// parseMaxBundleSize returns the size limit, in bytes, of the data collected
+// for a cluster; 0 means no limit
+func parseMaxBundleSize() (int64, error) {
+	if logArgs.maxBundleSize == "" {
+		return 0, nil
+	}
+	size, err := resource.ParseQuantity(logArgs.maxBundleSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --max-bundle-size: %w", err)
+	}
+	return size.Value(), nil
+}
+
+// captureLogs writes the logs of every container of the pods running in the
+// phase namespaces, along with the logs of the previous instance of restarted
+// containers, into the phase workdir
+func captureLogs(result *phaseResult, kubeconfig, kubecontext string) {
+	result.Logs = &logCapture{
+		TailLines: logArgs.tailLines,
+		MaxSize:   logArgs.maxBundleSize,
+	}
+	if logArgs.since > 0 {
+		result.Logs.Since = logArgs.since.String()
+	}
+
+	log.Printf("Capturing pod logs: cluster=%s; context=%s", result.Cluster, kubecontext)
+
+	cfg, err := newRestConfig(kubeconfig, kubecontext)
+	if err != nil {
+		log.Printf("Warn: pod logs not collected: cluster %s: %s", result.Cluster, err)
+		return
+	}
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		log.Printf("Warn: pod logs not collected: cluster %s: %s", result.Cluster, err)
+		return
+	}
+
+	for _, ns := range result.Namespaces {
+		pods, err := client.CoreV1().Pods(ns).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			log.Printf("Warn: pod logs not collected: cluster %s: namespace %s: %s", result.Cluster, ns, err)
+			continue
+		}
+		for i := range pods.Items {
+			capturePodLogs(client, &pods.Items[i], filepath.Join(result.workdir, logsDir, ns, pods.Items[i].Name))
+		}
+	}
+}
+
+func capturePodLogs(client kubernetes.Interface, pod *corev1.Pod, dir string) {
+	restarts := make(map[string]int32)
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		restarts[status.Name] = status.RestartCount
+	}
+
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for i := range containers {
+		name := containers[i].Name
+		if err := writeContainerLog(client, pod, name, false, filepath.Join(dir, name+".log")); err != nil {
+			log.Printf("Warn: failed to capture logs: pod %s/%s: container %s: %s", pod.Namespace, pod.Name, name, err)
+		}
+
+		if restarts[name] == 0 {
+			continue
+		}
+		if err := writeContainerLog(client, pod, name, true, filepath.Join(dir, name+".previous.log")); err != nil {
+			log.Printf("Warn: failed to capture previous logs: pod %s/%s: container %s: %s", pod.Namespace, pod.Name, name, err)
+		}
+	}
+}
+
+func writeContainerLog(client kubernetes.Interface, pod *corev1.Pod, container string, previous bool, path string) error {
+	opts := &corev1.PodLogOptions{
+		Container: container,
+		Previous:  previous,
+	}
+	if logArgs.since > 0 {
+		since := int64(logArgs.since.Seconds())
+		opts.SinceSeconds = &since
+	}
+	if logArgs.tailLines > 0 {
+		tailLines := logArgs.tailLines
+		opts.TailLines = &tailLines
+	}
+
+	stream, err := client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Stream(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0744); err != nil && !os.IsExist(err) {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, stream)
+	return err
+}
+
+type sizedFile struct {
+	path string
+	size int64
+}
+
+// limitDirSize truncates the largest log files of dir, keeping their most
+// recent lines, until the size of dir is below maxSize. It returns the
+// truncated files, relative to dir.
+func limitDirSize(dir string, maxSize int64) ([]string, error) {
+	var total int64
+	var logFiles []sizedFile
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		total += info.Size()
+		if strings.HasSuffix(path, ".log") {
+			logFiles = append(logFiles, sizedFile{path: path, size: info.Size()})
+		}
+		return nil
+	})
+	if err != nil || total <= maxSize {
+		return nil, err
+	}
+
+	sort.Slice(logFiles, func(i, j int) bool { return logFiles[i].size > logFiles[j].size })
+
+	var truncated []string
+	excess := total - maxSize
+	for _, file := range logFiles {
+		if excess <= 0 {
+			break
+		}
+		keep := file.size - excess
+		if keep < 0 {
+			keep = 0
+		}
+		if err := truncateHead(file.path, file.size, keep); err != nil {
+			return truncated, err
+		}
+		excess -= file.size - keep
+
+		rel, err := filepath.Rel(dir, file.path)
+		if err != nil {
+			return truncated, err
+		}
+		truncated = append(truncated, filepath.ToSlash(rel))
+	}
+
+	if excess > 0 {
+		log.Printf("Warn: collected data exceeds the maximum bundle size by %d bytes after truncating logs: %s", excess, dir)
+	}
+	return truncated, nil
+}
+
+// truncateHead rewrites the file with its last keep bytes
+func truncateHead(path string, size, keep int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	tail := make([]byte, keep)
+	_, err = file.ReadAt(tail, size-keep)
+	file.Close()
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	// start at the beginning of a line
+	if i := bytes.IndexByte(tail, '\n'); i >= 0 && i < len(tail)-1 {
+		tail = tail[i+1:]
+	}
+	return os.WriteFile(path, tail, 0644)
+}
@@ -0,0 +1,93 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLimitDirSize(t *testing.T) {
+	dir := t.TempDir()
+	large := strings.Repeat("old line\n", 100) + "recent line\n"
+	writeTestFile(t, filepath.Join(dir, "pods", "large.log"), large)
+	writeTestFile(t, filepath.Join(dir, "pods", "small.log"), "small\n")
+	writeTestFile(t, filepath.Join(dir, "objects.json"), strings.Repeat("x", 100))
+
+	truncated, err := limitDirSize(dir, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(truncated) != 1 || truncated[0] != "pods/large.log" {
+		t.Fatalf("expected the largest log to be truncated, got %v", truncated)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "pods", "large.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), "recent line\n") {
+		t.Errorf("expected the most recent lines to be kept, got %q", data)
+	}
+	if !strings.HasPrefix(string(data), "old line\n") && !strings.HasPrefix(string(data), "recent line\n") {
+		t.Errorf("expected the truncated log to start at a line, got %q", data)
+	}
+
+	var total int64
+	err = filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total > 300 {
+		t.Errorf("expected the directory to be at most 300 bytes, got %d", total)
+	}
+}
+
+func TestLimitDirSizeBelowLimit(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "pod.log"), "line\n")
+
+	truncated, err := limitDirSize(dir, 1024)
+	if err != nil || len(truncated) != 0 {
+		t.Errorf("expected nothing to be truncated, got %v, %v", truncated, err)
+	}
+}
+
+func TestLimitDirSizeOnlyLogs(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "pod.log"), strings.Repeat("line\n", 10))
+	writeTestFile(t, filepath.Join(dir, "objects.json"), strings.Repeat("x", 200))
+
+	truncated, err := limitDirSize(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(truncated) != 1 || truncated[0] != "pod.log" {
+		t.Fatalf("expected the log to be truncated, got %v", truncated)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "objects.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 200 {
+		t.Errorf("expected files other than logs to be kept, got %d bytes", len(data))
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	manifestFile = "manifest.json"
+
+	phaseBootstrap  = "bootstrap"
+	phaseManagement = "management"
+	phaseWorkload   = "workload"
+	phasePackages   = "packages"
+)
+
+type phaseStatus string
+
+const (
+	phaseCollected phaseStatus = "collected"
+	phaseSkipped   phaseStatus = "skipped"
+	phaseFailed    phaseStatus = "failed"
+)
+
+// capturedKinds lists the API objects captured by capture_k8s_objects
+// (see scripts/lib.star) and by captureClusterState
+var capturedKinds = []string{
+	"pods",
+	"pods/log",
+	"services",
+	"deployments.apps",
+	"replicasets.apps",
+	"apps.kappctrl.k14s.io",
+	"tanzukubernetesreleases.run.tanzu.vmware.com",
+	"configmaps",
+	"certificates.cert-manager.io",
+	"cluster-api (category)",
+	"events",
+	"nodes",
+	"nodes.metrics.k8s.io",
+	"pods.metrics.k8s.io",
+}
+
+// collectManifest describes the content of a diagnostics bundle
+type collectManifest struct {
+	StartTime time.Time     `json:"startTime"`
+	EndTime   time.Time     `json:"endTime"`
+	Phases    []phaseResult `json:"phases"`
+}
+
+// phaseResult records what was collected, or why nothing was collected,
+// for one cluster during a collection phase
+type phaseResult struct {
+	Phase           string      `json:"phase"`
+	Cluster         string      `json:"cluster,omitempty"`
+	Context         string      `json:"context,omitempty"`
+	Namespaces      []string    `json:"namespaces,omitempty"`
+	Kinds           []string    `json:"kinds,omitempty"`
+	Collectors      []string    `json:"collectors,omitempty"`
+	Packages        []string    `json:"packages,omitempty"`
+	NodeDiagnostics bool        `json:"nodeDiagnostics,omitempty"`
+	Metrics         bool        `json:"metrics,omitempty"`
+	Logs            *logCapture `json:"logs,omitempty"`
+	Archive         string      `json:"archive,omitempty"`
+	Status          phaseStatus `json:"status"`
+	Error           string      `json:"error,omitempty"`
+	Reason          string      `json:"reason,omitempty"`
+	StartTime       time.Time   `json:"startTime"`
+	EndTime         time.Time   `json:"endTime"`
+
+	workdir    string
+	kubeconfig string
+}
+
+func newPhaseResult(phase, cluster string) phaseResult {
+	return phaseResult{
+		Phase:     phase,
+		Cluster:   cluster,
+		StartTime: time.Now().UTC(),
+	}
+}
+
+// skip marks the phase as skipped, on request or because there is nothing
+// to collect
+func (r *phaseResult) skip(reason string) phaseResult {
+	r.Status = phaseSkipped
+	r.Reason = reason
+	r.EndTime = time.Now().UTC()
+	return *r
+}
+
+// done marks the phase as collected, or failed if err is not nil
+func (r *phaseResult) done(err error) phaseResult {
+	r.Status = phaseCollected
+	if err != nil {
+		r.Status = phaseFailed
+		r.Error = err.Error()
+	}
+	r.EndTime = time.Now().UTC()
+	return *r
+}
+
+// writeBundle archives the data collected by all phases, along with
+// the manifest, into a single archive in the output directory
+func writeBundle(manifest *collectManifest) (string, error) {
+	bundleFile := filepath.Join(
+		commonArgs.outputDir,
+		fmt.Sprintf("tanzu-diagnostics.%s.tar.gz", manifest.StartTime.Format("20060102150405")),
+	)
+
+	var sources []archiveSource
+	for i := range manifest.Phases {
+		phase := &manifest.Phases[i]
+		if phase.Status != phaseCollected {
+			continue
+		}
+		sources = append(sources, archiveSource{path: phase.workdir, name: phase.Archive})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("manifest: %w", err)
+	}
+	path := filepath.Join(commonArgs.workDir, manifestFile)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("manifest: %w", err)
+	}
+	sources = append(sources, archiveSource{path: path, name: manifestFile})
+
+	log.Printf("Archiving: %s", bundleFile)
+	if err := writeArchive(bundleFile, sources...); err != nil {
+		return "", err
+	}
+
+	for i := range manifest.Phases {
+		if err := os.RemoveAll(manifest.Phases[i].workdir); err != nil {
+			log.Printf("Warn: failed to remove work directory: %s: %s", manifest.Phases[i].workdir, err)
+		}
+	}
+	return bundleFile, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	crashdexec "github.com/vmware-tanzu/crash-diagnostics/exec"
+)
+
+// nodeDiagnosticsScript captures the node diagnostics of lib.star from a host
+// reached over SSH with the ssh_* arguments passed by the plugin
+const nodeDiagnosticsScript = `
+conf = crashd_config(workdir=args.workdir)
+nodes = resources(provider=host_list_provider(hosts=[args.ssh_host], ssh_config=get_ssh_config()))
+capture_node_diagnostics(nodes)
+`
+
+// TestNodeDiagnostics collects the node diagnostics of a host running sshd,
+// e.g. the container started by test/sshd-test.sh. It is skipped unless
+// DIAGNOSTICS_TEST_SSH_HOST is set.
+func TestNodeDiagnostics(t *testing.T) {
+	host := os.Getenv("DIAGNOSTICS_TEST_SSH_HOST")
+	if host == "" {
+		t.Skip("DIAGNOSTICS_TEST_SSH_HOST not set: run test/sshd-test.sh")
+	}
+
+	libData, err := os.ReadFile(filepath.Join("..", libScriptPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	workdir := t.TempDir()
+	args := crashdexec.ArgMap{
+		"workdir":     workdir,
+		"ssh_host":    host,
+		"ssh_port":    os.Getenv("DIAGNOSTICS_TEST_SSH_PORT"),
+		"ssh_user":    os.Getenv("DIAGNOSTICS_TEST_SSH_USER"),
+		"ssh_pk_file": os.Getenv("DIAGNOSTICS_TEST_SSH_PRIVATE_KEY"),
+	}
+
+	err = crashdexec.ExecuteWithModules(
+		"node_diagnostics.star",
+		strings.NewReader(nodeDiagnosticsScript),
+		args,
+		crashdexec.StarlarkModule{Name: libScriptPath, Source: bytes.NewReader(libData)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the disk usage of the node is captured, whatever the commands missing
+	// from the host (i.e. crictl)
+	var captured []string
+	var diskUsage bool
+	err = filepath.Walk(workdir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		captured = append(captured, path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(data), "Filesystem") {
+			diskUsage = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diskUsage {
+		t.Errorf("expected the disk usage of the node to be captured, got %v", captured)
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	crashdexec "github.com/vmware-tanzu/crash-diagnostics/exec"
+)
+
+const valuesDir = "values"
+
+var packageInstallGVR = schema.GroupVersionResource{
+	Group:    "packaging.carvel.dev",
+	Version:  "v1alpha1",
+	Resource: "packageinstalls",
+}
+
+// packageKinds lists the API objects captured by scripts/packages.star
+var packageKinds = []string{
+	"packageinstalls.packaging.carvel.dev",
+	"packagerepositories.packaging.carvel.dev",
+	"packagemetadatas.data.packaging.carvel.dev",
+	"apps.kappctrl.k14s.io",
+	"events",
+	"pods",
+	"pods/log",
+	"services",
+	"deployments.apps",
+	"daemonsets.apps",
+	"statefulsets.apps",
+	"secrets (values, redacted)",
+}
+
+// installedPackage is a PackageInstall followed to its App and the
+// namespaces where the App deployed resources
+type installedPackage struct {
+	name         string
+	namespace    string
+	valueSecrets []string
+	namespaces   []string
+}
+
+// collectPackageDiags collects the diagnostics of the packages installed
+// in every management and workload cluster collected by the previous phases
+func collectPackageDiags(red *redactor, phases []phaseResult) []phaseResult {
+	if packageArgs.skip {
+		log.Println("packages: skip=true: diagnostics will not be collected")
+		result := newPhaseResult(phasePackages, "")
+		return []phaseResult{result.skip("skip requested")}
+	}
+
+	var results []phaseResult
+	for i := range phases {
+		phase := &phases[i]
+		if phase.Status != phaseCollected || (phase.Phase != phaseManagement && phase.Phase != phaseWorkload) {
+			continue
+		}
+		results = append(results, collectClusterPackageDiags(red, phase.Cluster, phase.kubeconfig, phase.Context))
+	}
+	return results
+}
+
+func collectClusterPackageDiags(red *redactor, cluster, kubeconfig, kubecontext string) phaseResult {
+	result := newPhaseResult(phasePackages, cluster)
+	result.Context = kubecontext
+	result.Kinds = packageKinds
+	result.workdir = filepath.Join(commonArgs.workDir, fmt.Sprintf("packages.%s", cluster))
+
+	log.Printf("Collecting package diagnostics: cluster: %s", cluster)
+
+	cfg, err := newRestConfig(kubeconfig, kubecontext)
+	if err != nil {
+		return result.done(fmt.Errorf("packages: cluster %s: %w", cluster, err))
+	}
+	dynClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return result.done(fmt.Errorf("packages: cluster %s: %w", cluster, err))
+	}
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return result.done(fmt.Errorf("packages: cluster %s: %w", cluster, err))
+	}
+
+	packages, err := findInstalledPackages(dynClient, client)
+	if err != nil {
+		return result.done(fmt.Errorf("packages: cluster %s: %w", cluster, err))
+	}
+	if len(packages) == 0 {
+		log.Printf("packages: cluster %s: no PackageInstall found: diagnostics will not be collected", cluster)
+		return result.skip("no PackageInstall found")
+	}
+
+	var packageNamespaces []string
+	for i := range packages {
+		result.Packages = append(result.Packages, fmt.Sprintf("%s/%s", packages[i].namespace, packages[i].name))
+		packageNamespaces = append(packageNamespaces, packages[i].namespace)
+		result.Namespaces = append(result.Namespaces, packages[i].namespace)
+		result.Namespaces = append(result.Namespaces, packages[i].namespaces...)
+	}
+	packageNamespaces = uniqueStrings(packageNamespaces)
+	result.Namespaces = uniqueStrings(result.Namespaces)
+
+	if err := writeValueSecrets(client, packages, filepath.Join(result.workdir, valuesDir)); err != nil {
+		return result.done(fmt.Errorf("packages: cluster %s: %w", cluster, err))
+	}
+
+	argsMap := crashdexec.ArgMap{
+		"workdir":            result.workdir,
+		"cluster_name":       cluster,
+		"kubeconfig":         kubeconfig,
+		"kube_context":       kubecontext,
+		"package_namespaces": strings.Join(packageNamespaces, ","),
+		"namespaces":         strings.Join(result.Namespaces, ","),
+	}
+
+	if err := runScript(packagesScriptPath, argsMap); err != nil {
+		return result.done(fmt.Errorf("packages script failed: cluster %s: %w", cluster, err))
+	}
+	captureLogs(&result, kubeconfig, kubecontext)
+
+	return result.done(archiveDiags(red, &result, archiveFileName("packages", cluster)))
+}
+
+// findInstalledPackages lists the PackageInstalls of all namespaces and
+// follows each of them to the namespaces where its App deployed resources
+func findInstalledPackages(dynClient dynamic.Interface, client kubernetes.Interface) ([]installedPackage, error) {
+	list, err := dynClient.Resource(packageInstallGVR).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing packageinstalls: %w", err)
+	}
+
+	var packages []installedPackage
+	for i := range list.Items {
+		pkgi := &list.Items[i]
+		p := installedPackage{
+			name:         pkgi.GetName(),
+			namespace:    pkgi.GetNamespace(),
+			valueSecrets: packageValueSecrets(pkgi),
+		}
+
+		// a PackageInstall is reconciled by an App of the same name
+		p.namespaces, err = appNamespaces(client, p.namespace, p.name)
+		if err != nil {
+			log.Printf("Warn: packages: deployed namespaces not found: app %s/%s: %s", p.namespace, p.name, err)
+		}
+		packages = append(packages, p)
+	}
+	return packages, nil
+}
+
+// packageValueSecrets returns the name of the Secrets providing values to a PackageInstall
+func packageValueSecrets(pkgi *unstructured.Unstructured) []string {
+	values, _, _ := unstructured.NestedSlice(pkgi.Object, "spec", "values")
+
+	var secrets []string
+	for _, v := range values {
+		value, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, _, _ := unstructured.NestedString(value, "secretRef", "name"); name != "" {
+			secrets = append(secrets, name)
+		}
+	}
+	return secrets
+}
+
+// appNamespaces returns the namespaces where an App deployed resources, as
+// recorded by kapp in the <app>-ctrl ConfigMap of the App namespace
+func appNamespaces(client kubernetes.Interface, namespace, app string) ([]string, error) {
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), fmt.Sprintf("%s-ctrl", app), metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var spec struct {
+		Namespaces []string `json:"namespaces"`
+		LastChange struct {
+			Namespaces []string `json:"namespaces"`
+		} `json:"lastChange"`
+	}
+	if err := json.Unmarshal([]byte(cm.Data["spec"]), &spec); err != nil {
+		return nil, fmt.Errorf("configmap %s/%s: %w", namespace, cm.Name, err)
+	}
+
+	var result []string
+	for _, ns := range uniqueStrings(append(append([]string{}, spec.Namespaces...), spec.LastChange.Namespaces...)) {
+		// "(cluster)" stands for cluster-scoped resources
+		if ns != "" && !strings.HasPrefix(ns, "(") {
+			result = append(result, ns)
+		}
+	}
+	return result, nil
+}
+
+// writeValueSecrets stores the values Secrets of the packages, with their
+// data redacted, as <dir>/<namespace>/<secret>.json
+func writeValueSecrets(client kubernetes.Interface, packages []installedPackage, dir string) error {
+	for i := range packages {
+		for _, name := range packages[i].valueSecrets {
+			secret, err := client.CoreV1().Secrets(packages[i].namespace).Get(context.TODO(), name, metav1.GetOptions{})
+			if err != nil {
+				log.Printf("Warn: packages: values secret not collected: %s/%s: %s", packages[i].namespace, name, err)
+				continue
+			}
+
+			redactValuesSecret(secret)
+			if err := writeJSON(filepath.Join(dir, secret.Namespace, fmt.Sprintf("%s.json", secret.Name)), secret); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// redactValuesSecret replaces the values of a Secret, keeping its keys so that
+// the provided values files can be identified
+func redactValuesSecret(secret *corev1.Secret) {
+	secret.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"}
+	secret.ManagedFields = nil
+	delete(secret.Annotations, corev1.LastAppliedConfigAnnotation)
+
+	stringData := make(map[string]string, len(secret.Data)+len(secret.StringData))
+	for k := range secret.Data {
+		stringData[k] = redactedValue
+	}
+	for k := range secret.StringData {
+		stringData[k] = redactedValue
+	}
+	secret.Data = nil
+	secret.StringData = stringData
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, v := range values {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,260 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	redactedValue       = "REDACTED"
+	redactionReportFile = "redaction-report.json"
+	secretDataRuleName  = "secret-data"
+
+	// files with a NUL byte in their first binarySniffLen bytes are not redacted
+	binarySniffLen = 8000
+)
+
+// redactionRule replaces each match of Pattern with Replacement.
+// Replacement may reference capture groups (i.e. ${1}) and defaults to
+// redactedValue when empty.
+type redactionRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement,omitempty"`
+
+	regex *regexp.Regexp
+}
+
+// redactionRuleFile is the format of the user-provided rule file, i.e.
+//
+//	rules:
+//	- name: internal-hosts
+//	  pattern: '[a-z0-9-]+\.corp\.example\.com'
+//	  replacement: 'REDACTED-HOST'
+type redactionRuleFile struct {
+	Rules []redactionRule `json:"rules"`
+}
+
+// defaultRedactionRules are always applied when redaction is enabled.
+// Secret objects are handled separately (see redactSecretData).
+var defaultRedactionRules = []redactionRule{
+	{
+		Name:        "kubeconfig-credentials",
+		Pattern:     `((?:^|[\s"'{,])["']?(?:client-key-data|client-certificate-data|token|id-token|refresh-token|password)["']?\s*[:=]\s*["']?)[^\s"',}\\]+`,
+		Replacement: `${1}` + redactedValue,
+	},
+	{
+		Name:        "cloud-credentials",
+		Pattern:     `((?:AWS_ACCESS_KEY_ID|AWS_SECRET_ACCESS_KEY|AWS_SESSION_TOKEN|AWS_B64ENCODED_CREDENTIALS|aws_access_key_id|aws_secret_access_key|aws_session_token|accessKeyID|secretAccessKey|VSPHERE_USERNAME|VSPHERE_PASSWORD|AZURE_CLIENT_SECRET)["']?\s*[:=]\s*["']?)[^\s"',}\\]+`,
+		Replacement: `${1}` + redactedValue,
+	},
+	{
+		Name:    "aws-access-key-id",
+		Pattern: `(?:AKIA|ASIA)[0-9A-Z]{16}`,
+	},
+	{
+		Name:        "bearer-token",
+		Pattern:     `((?i:bearer)\s+)[A-Za-z0-9\-._~+/]+=*`,
+		Replacement: `${1}` + redactedValue,
+	},
+	{
+		Name:        "private-key",
+		Pattern:     `-----BEGIN ([A-Z ]*)PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+		Replacement: `-----BEGIN ${1}PRIVATE KEY-----` + redactedValue + `-----END ${1}PRIVATE KEY-----`,
+	},
+}
+
+// redactionReport records what was redacted from a collected bundle
+type redactionReport struct {
+	Rules           []string       `json:"rules"`
+	Files           []redactedFile `json:"files"`
+	TotalRedactions int            `json:"totalRedactions"`
+}
+
+type redactedFile struct {
+	Path       string         `json:"path"`
+	Redactions map[string]int `json:"redactions"`
+}
+
+type redactor struct {
+	rules []redactionRule
+}
+
+// newRedactor returns a redactor using the default rules and, if provided,
+// the rules found in rulesFile
+func newRedactor(rulesFile string) (*redactor, error) {
+	rules := append([]redactionRule{}, defaultRedactionRules...)
+
+	if rulesFile != "" {
+		data, err := os.ReadFile(rulesFile)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rules: %w", err)
+		}
+		var userRules redactionRuleFile
+		if err := yaml.UnmarshalStrict(data, &userRules); err != nil {
+			return nil, fmt.Errorf("redaction rules: %s: %w", rulesFile, err)
+		}
+		rules = append(rules, userRules.Rules...)
+	}
+
+	for i := range rules {
+		if rules[i].Name == "" {
+			rules[i].Name = fmt.Sprintf("rule-%d", i)
+		}
+		if rules[i].Replacement == "" {
+			rules[i].Replacement = redactedValue
+		}
+		regex, err := regexp.Compile(rules[i].Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %s: %w", rules[i].Name, err)
+		}
+		rules[i].regex = regex
+	}
+
+	return &redactor{rules: rules}, nil
+}
+
+// redactDir redacts, in place, every file found under dir and writes
+// a redaction report at the root of dir
+func (r *redactor) redactDir(dir string) (*redactionReport, error) {
+	report := &redactionReport{Rules: []string{secretDataRuleName}}
+	for _, rule := range r.rules {
+		report.Rules = append(report.Rules, rule.Name)
+	}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		redacted, counts := r.redact(path, data)
+		if len(counts) == 0 {
+			return nil
+		}
+		if err := os.WriteFile(path, redacted, info.Mode()); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		report.Files = append(report.Files, redactedFile{Path: filepath.ToSlash(rel), Redactions: counts})
+		for _, count := range counts {
+			report.TotalRedactions += count
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("redaction: %w", err)
+	}
+
+	sort.Slice(report.Files, func(i, j int) bool { return report.Files[i].Path < report.Files[j].Path })
+
+	reportData, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("redaction report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, redactionReportFile), reportData, 0644); err != nil {
+		return nil, fmt.Errorf("redaction report: %w", err)
+	}
+
+	return report, nil
+}
+
+// redact applies all rules to data and returns the redacted data along with
+// the number of redactions made by each rule
+func (r *redactor) redact(path string, data []byte) ([]byte, map[string]int) {
+	counts := make(map[string]int)
+
+	sniff := data
+	if len(sniff) > binarySniffLen {
+		sniff = sniff[:binarySniffLen]
+	}
+	if bytes.IndexByte(sniff, 0) >= 0 {
+		return data, counts
+	}
+
+	if filepath.Ext(path) == ".json" {
+		if redacted, count := redactSecretData(data); count > 0 {
+			data = redacted
+			counts[secretDataRuleName] = count
+		}
+	}
+
+	for _, rule := range r.rules {
+		matches := len(rule.regex.FindAllIndex(data, -1))
+		if matches == 0 {
+			continue
+		}
+		data = rule.regex.ReplaceAll(data, []byte(rule.Replacement))
+		counts[rule.Name] += matches
+	}
+
+	return data, counts
+}
+
+// redactSecretData replaces the values of the data and stringData fields
+// of every Secret found in a JSON document
+func redactSecretData(data []byte) ([]byte, int) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return data, 0
+	}
+
+	count := redactSecrets(doc)
+	if count == 0 {
+		return data, 0
+	}
+
+	redacted, err := json.MarshalIndent(doc, "", "    ")
+	if err != nil {
+		return data, 0
+	}
+	return redacted, count
+}
+
+func redactSecrets(node interface{}) int {
+	count := 0
+	switch obj := node.(type) {
+	case map[string]interface{}:
+		if kind, ok := obj["kind"].(string); ok && kind == "Secret" {
+			for _, field := range []string{"data", "stringData"} {
+				values, ok := obj[field].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				for key := range values {
+					values[key] = redactedValue
+					count++
+				}
+			}
+			return count
+		}
+		for _, value := range obj {
+			count += redactSecrets(value)
+		}
+	case []interface{}:
+		for _, value := range obj {
+			count += redactSecrets(value)
+		}
+	}
+	return count
+}
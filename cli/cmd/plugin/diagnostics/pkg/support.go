@@ -19,6 +19,14 @@ func getDefaultWorkdir() string {
 	return filepath.Join(tanzuConfigDir, "diagnostics")
 }
 
+func getDefaultScriptDir() string {
+	tanzuConfigDir, err := config.LocalDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(tanzuConfigDir, "diagnostics", "collectors.d")
+}
+
 func getDefaultOutputDir() string {
 	return "./"
 }
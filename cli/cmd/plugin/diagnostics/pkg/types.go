@@ -3,9 +3,16 @@
 
 package pkg
 
+import "time"
+
 type collectCommonArgs struct {
-	workDir   string
-	outputDir string
+	workDir        string
+	outputDir      string
+	singleBundle   bool
+	redact         bool
+	redactionRules string
+	scriptDir      string
+	output         string
 }
 
 type collectBootsrapArgs struct {
@@ -14,11 +21,34 @@ type collectBootsrapArgs struct {
 }
 
 type collectWorkloadArgs struct {
-	standalone  bool
-	kubeconfig  string
-	infra       string
-	clusterName string
-	namespace   string
+	standalone   bool
+	kubeconfig   string
+	infra        string
+	clusterName  string
+	namespace    string
+	clusterNames []string
+	selector     string
+	all          bool
+	concurrency  int
+}
+
+type collectLogArgs struct {
+	since          time.Duration
+	tailLines      int64
+	maxBundleSize  string
+	maxBundleBytes int64
+}
+
+type collectSSHArgs struct {
+	user       string
+	privateKey string
+	port       int
+	jumpUser   string
+	jumpHost   string
+}
+
+type collectPackageArgs struct {
+	skip bool
 }
 
 type collectMgmtArgs struct {
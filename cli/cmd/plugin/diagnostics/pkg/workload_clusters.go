@@ -0,0 +1,110 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const managementClusterRoleLabel = "cluster-role.tkg.tanzu.vmware.com/management"
+
+var capiClusterGVR = schema.GroupVersionResource{
+	Group:    "cluster.x-k8s.io",
+	Version:  "v1alpha3",
+	Resource: "clusters",
+}
+
+type workloadCluster struct {
+	name      string
+	namespace string
+}
+
+// newRestConfig returns a client configuration for the context of a kubeconfig file
+func newRestConfig(kubeconfig, kubecontext string) (*rest.Config, error) {
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: kubecontext},
+	).ClientConfig()
+}
+
+// getWorkloadClusters returns the workload clusters selected by name, or
+// selected from the Cluster objects of the management cluster by namespace,
+// label selector or all at once
+func getWorkloadClusters() ([]workloadCluster, error) {
+	names := workloadArgs.clusterNames
+	if workloadArgs.clusterName != "" {
+		names = append([]string{workloadArgs.clusterName}, names...)
+	}
+
+	var clusters []workloadCluster
+	for _, name := range names {
+		clusters = append(clusters, workloadCluster{name: name, namespace: workloadArgs.namespace})
+	}
+
+	selectByNamespace := len(names) == 0 && workloadArgs.namespace != ""
+	if workloadArgs.all || workloadArgs.selector != "" || selectByNamespace {
+		selected, err := listWorkloadClusters(workloadArgs.namespace, workloadArgs.selector)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, selected...)
+	}
+
+	return uniqueWorkloadClusters(clusters), nil
+}
+
+// listWorkloadClusters lists the workload clusters known by the management cluster
+func listWorkloadClusters(namespace, selector string) ([]workloadCluster, error) {
+	if workloadArgs.standalone || mgmtArgs.kubeconfig == "" {
+		return nil, fmt.Errorf("workload cluster: a management cluster is required to select workload clusters")
+	}
+
+	kubecontext := mgmtArgs.contextName
+	if kubecontext == "" && mgmtArgs.clusterName != "" {
+		kubecontext = getDefaultClusterContext(mgmtArgs.clusterName)
+	}
+
+	cfg, err := newRestConfig(mgmtArgs.kubeconfig, kubecontext)
+	if err != nil {
+		return nil, fmt.Errorf("workload cluster: management cluster config: %w", err)
+	}
+	client, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("workload cluster: management cluster client: %w", err)
+	}
+
+	list, err := client.Resource(capiClusterGVR).Namespace(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("workload cluster: listing clusters: %w", err)
+	}
+
+	var clusters []workloadCluster
+	for i := range list.Items {
+		if _, ok := list.Items[i].GetLabels()[managementClusterRoleLabel]; ok {
+			continue
+		}
+		clusters = append(clusters, workloadCluster{name: list.Items[i].GetName(), namespace: list.Items[i].GetNamespace()})
+	}
+	return clusters, nil
+}
+
+func uniqueWorkloadClusters(clusters []workloadCluster) []workloadCluster {
+	seen := make(map[workloadCluster]bool)
+	var result []workloadCluster
+	for _, c := range clusters {
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		result = append(result, c)
+	}
+	return result
+}
@@ -0,0 +1,48 @@
+#!/bin/bash
+
+# Copyright 2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+# SPDX-License-Identifier: Apache-2.0
+
+# Runs the node diagnostics tests of pkg against a local sshd container,
+# reached with a generated key by a user with passwordless sudo
+
+set -o errexit
+set -o nounset
+set -o pipefail
+
+MY_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+SSHD_CONTAINER="${SSHD_CONTAINER:-diagnostics-sshd-test}"
+SSHD_IMAGE="${SSHD_IMAGE:-lscr.io/linuxserver/openssh-server:latest}"
+SSHD_PORT="${SSHD_PORT:-2222}"
+SSH_USER="capv"
+
+KEY_DIR="$(mktemp -d)"
+cleanup() {
+    docker rm -f "${SSHD_CONTAINER}" > /dev/null 2>&1 || true
+    rm -rf "${KEY_DIR}"
+}
+trap cleanup EXIT
+
+ssh-keygen -q -t ed25519 -N "" -f "${KEY_DIR}/id_ed25519"
+docker run -d --name "${SSHD_CONTAINER}" \
+    -p "127.0.0.1:${SSHD_PORT}:2222" \
+    -e USER_NAME="${SSH_USER}" \
+    -e SUDO_ACCESS=true \
+    -e PUBLIC_KEY="$(cat "${KEY_DIR}/id_ed25519.pub")" \
+    "${SSHD_IMAGE}" > /dev/null
+
+echo "Waiting for sshd to accept connections"
+for _ in $(seq 1 30); do
+    if ssh -q -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -o BatchMode=yes \
+        -i "${KEY_DIR}/id_ed25519" -p "${SSHD_PORT}" "${SSH_USER}@127.0.0.1" true; then
+        break
+    fi
+    sleep 2
+done
+
+cd "${MY_DIR}/.."
+DIAGNOSTICS_TEST_SSH_HOST=127.0.0.1 \
+DIAGNOSTICS_TEST_SSH_PORT="${SSHD_PORT}" \
+DIAGNOSTICS_TEST_SSH_USER="${SSH_USER}" \
+DIAGNOSTICS_TEST_SSH_PRIVATE_KEY="${KEY_DIR}/id_ed25519" \
+    go test ./pkg/... -run TestNodeDiagnostics -v
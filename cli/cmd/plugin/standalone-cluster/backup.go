@@ -0,0 +1,359 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/clientcmd"
+	crtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+const (
+	// defaultVeleroNamespace is the namespace the Velero package is installed in
+	defaultVeleroNamespace = "velero"
+	defaultStorageLocation = "default"
+	defaultBackupTTL       = 30 * 24 * time.Hour
+	defaultBackupTimeout   = 30 * time.Minute
+	backupPollInterval     = 5 * time.Second
+
+	// the record of a cluster is saved in a secret of the cluster for Velero
+	// to back it up. Its state is saved without the secret values of its
+	// configuration, which are sealed along with its credentials.
+	clusterRecordNamespace    = "tanzu-standalone-cluster"
+	clusterRecordSecretPrefix = "standalone-cluster-"
+	clusterRecordStateKey     = "state"
+	clusterRecordSealedKey    = "sealed"
+
+	standaloneClusterLabel = "tanzu.vmware.com/standalone-cluster"
+
+	recordFilePermissions = 0600
+
+	// phases of Velero backups and restores
+	veleroPhaseCompleted       = "Completed"
+	veleroPhasePartiallyFailed = "PartiallyFailed"
+	veleroPhaseFailed          = "Failed"
+)
+
+// defaultExcludedNamespaces are the system namespaces not backed up by
+// default: the namespaces of Kubernetes, of the packages installed by Tanzu
+// Framework and of the Cluster API store of the cluster, which belong to the
+// cluster rather than to its workloads
+var defaultExcludedNamespaces = []string{
+	"kube-system",
+	"kube-public",
+	"kube-node-lease",
+	"tkg-system",
+	"tkg-system-public",
+	"tanzu-package-repo-global",
+	"cert-manager",
+	"capi-system",
+	"capi-webhook-system",
+	"capi-kubeadm-bootstrap-system",
+	"capi-kubeadm-control-plane-system",
+	"capa-system",
+	"capd-system",
+	"capv-system",
+	"capz-system",
+	defaultVeleroNamespace,
+}
+
+type backupStandaloneOptions struct {
+	backupName        string
+	storageLocation   string
+	includeNamespaces []string
+	excludeNamespaces []string
+	veleroNamespace   string
+	encryptionKeyFile string
+	recordFile        string
+	ttl               time.Duration
+	wait              bool
+	timeout           time.Duration
+}
+
+// BackupCmd backs up a standalone cluster with Velero.
+var BackupCmd = &cobra.Command{
+	Use:   "backup <cluster name>",
+	Short: "back up a standalone cluster and its workload namespaces with Velero",
+	Args:  cobra.ExactArgs(1),
+	RunE:  backup,
+}
+
+var bso = backupStandaloneOptions{}
+
+func init() {
+	BackupCmd.Flags().StringVarP(&bso.backupName, "backup-name", "", "", "Name of the Velero backup (default <cluster name>-<timestamp>)")
+	BackupCmd.Flags().StringVarP(&bso.storageLocation, "storage-location", "", defaultStorageLocation, "Velero backup storage location to store the backup in")
+	BackupCmd.Flags().StringSliceVarP(&bso.includeNamespaces, "include-namespaces", "", []string{"*"}, "Namespaces to back up")
+	BackupCmd.Flags().StringSliceVarP(&bso.excludeNamespaces, "exclude-namespaces", "", defaultExcludedNamespaces, "Namespaces not to back up")
+	BackupCmd.Flags().StringVarP(&bso.veleroNamespace, "velero-namespace", "", defaultVeleroNamespace, "Namespace Velero is installed in")
+	BackupCmd.Flags().StringVarP(&bso.encryptionKeyFile, "encryption-key-file", "", "", "File holding the key the credentials of the cluster are encrypted with in the backup, of at least 32 random bytes")
+	BackupCmd.Flags().StringVarP(&bso.recordFile, "record-file", "", "", "File to write the record of the cluster to, on this machine, along with the backup")
+	BackupCmd.Flags().DurationVarP(&bso.ttl, "ttl", "", defaultBackupTTL, "Time duration the backup is kept for")
+	BackupCmd.Flags().BoolVarP(&bso.wait, "wait", "", true, "Wait for the backup to complete")
+	BackupCmd.Flags().DurationVarP(&bso.timeout, "timeout", "t", defaultBackupTimeout, "Time duration to wait for the backup to complete")
+}
+
+func backup(cmd *cobra.Command, args []string) error {
+	clusterName := args[0]
+
+	state, err := loadStandaloneClusterState(clusterName)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to load standalone cluster %s", clusterName)
+	}
+	if !state.created() {
+		return fmt.Errorf("the creation of standalone cluster %s did not complete: resume it or clean it up before backing it up", clusterName)
+	}
+	if bso.encryptionKeyFile == "" {
+		return fmt.Errorf("no encryption key specified: set --encryption-key-file for the credentials of the cluster to be backed up")
+	}
+	key, err := readEncryptionKey(bso.encryptionKeyFile)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to back up standalone cluster %s", clusterName)
+	}
+
+	client, kubeconfig, err := newStandaloneClusterClient(clusterName)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to connect to standalone cluster %s", clusterName)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), bso.timeout)
+	defer cancel()
+
+	err = checkVeleroStorageLocation(ctx, client, bso.veleroNamespace, bso.storageLocation)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to back up standalone cluster %s", clusterName)
+	}
+
+	record, err := newClusterRecord(state, kubeconfig, key)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to save record of standalone cluster %s", clusterName)
+	}
+	if bso.recordFile != "" {
+		log.Infof("Writing record of standalone cluster %s to '%v'", clusterName, bso.recordFile)
+		err = writeClusterRecordFile(bso.recordFile, record)
+		if err != nil {
+			return NonUsageError(cmd, err, "unable to write record of standalone cluster %s", clusterName)
+		}
+	}
+	log.Infof("Saving record of standalone cluster %s in namespace %s", clusterName, clusterRecordNamespace)
+	err = saveClusterRecord(ctx, client, record)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to save record of standalone cluster %s", clusterName)
+	}
+
+	backupName := bso.backupName
+	if backupName == "" {
+		backupName = fmt.Sprintf("%s-%s", clusterName, time.Now().UTC().Format("20060102150405"))
+	}
+	veleroBackup := newVeleroBackup(backupName, clusterName)
+	log.Infof("Creating Velero backup %s of standalone cluster %s", backupName, clusterName)
+	err = client.Create(ctx, veleroBackup)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to create Velero backup %s", backupName)
+	}
+
+	if bso.wait {
+		err = waitForVeleroPhase(ctx, client, veleroBackup, bso.timeout)
+		if err != nil {
+			return NonUsageError(cmd, err, "Velero backup %s of standalone cluster %s did not complete", backupName, clusterName)
+		}
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Backup '%s' of standalone cluster '%s' created in storage location '%s'\n", backupName, clusterName, bso.storageLocation)
+	return nil
+}
+
+// newStandaloneClusterClient returns a client of a standalone cluster, along
+// with its admin kubeconfig
+func newStandaloneClusterClient(clusterName string) (crtclient.Client, []byte, error) {
+	config, err := loadAdminKubeconfig(clusterName)
+	if err != nil {
+		return nil, nil, err
+	}
+	kubeconfig, err := clientcmd.Write(*config)
+	if err != nil {
+		return nil, nil, err
+	}
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := crtclient.New(restConfig, crtclient.Options{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, kubeconfig, nil
+}
+
+func veleroGVK(kind string) schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: "velero.io", Version: "v1", Kind: kind}
+}
+
+// checkVeleroStorageLocation checks Velero is installed in the cluster, with
+// the backup storage location to store backups in
+func checkVeleroStorageLocation(ctx context.Context, client crtclient.Client, namespace, name string) error {
+	location := &unstructured.Unstructured{}
+	location.SetGroupVersionKind(veleroGVK("BackupStorageLocation"))
+	err := client.Get(ctx, crtclient.ObjectKey{Namespace: namespace, Name: name}, location)
+	switch {
+	case meta.IsNoMatchError(err):
+		return fmt.Errorf("velero is not installed: install the velero package with a backup storage location")
+	case apierrors.IsNotFound(err):
+		return fmt.Errorf("velero backup storage location %s/%s not found", namespace, name)
+	case err != nil:
+		return err
+	}
+
+	phase, _, _ := unstructured.NestedString(location.Object, "status", "phase")
+	if phase != "" && phase != "Available" {
+		return fmt.Errorf("velero backup storage location %s/%s is %s", namespace, name, phase)
+	}
+	return nil
+}
+
+// newClusterRecord returns the record of a cluster, the secret holding its
+// state and its sealed credentials: its state and admin kubeconfig, sealed
+// with the key of the user
+func newClusterRecord(state *standaloneClusterState, kubeconfig, encryptionKey []byte) (*corev1.Secret, error) {
+	sealed, err := sealClusterRecord(encryptionKey, state.Name, &sealedClusterRecord{State: state, Kubeconfig: kubeconfig})
+	if err != nil {
+		return nil, fmt.Errorf("cannot encrypt record: %v", err)
+	}
+
+	redactedState := *state
+	redactedState.Config = redactClusterConfig(state.Config)
+	stateData, err := yaml.Marshal(&redactedState)
+	if err != nil {
+		return nil, err
+	}
+
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: clusterRecordNamespace,
+			Name:      clusterRecordSecretPrefix + state.Name,
+			Labels:    map[string]string{standaloneClusterLabel: state.Name},
+		},
+		Data: map[string][]byte{
+			clusterRecordStateKey:  stateData,
+			clusterRecordSealedKey: sealed,
+		},
+	}, nil
+}
+
+// saveClusterRecord saves the record of a cluster in a secret of the cluster,
+// for it to be backed up along with the cluster
+func saveClusterRecord(ctx context.Context, client crtclient.Client, record *corev1.Secret) error {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: clusterRecordNamespace}}
+	err := client.Create(ctx, namespace)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("cannot create namespace %s: %v", clusterRecordNamespace, err)
+	}
+
+	secret := &corev1.Secret{}
+	key := crtclient.ObjectKey{Namespace: record.Namespace, Name: record.Name}
+	err = client.Get(ctx, key, secret)
+	notFound := apierrors.IsNotFound(err)
+	if err != nil && !notFound {
+		return fmt.Errorf("cannot get secret %s: %v", key, err)
+	}
+
+	secret.Namespace = record.Namespace
+	secret.Name = record.Name
+	secret.Labels = record.Labels
+	secret.Data = record.Data
+	if notFound {
+		return client.Create(ctx, secret)
+	}
+	return client.Update(ctx, secret)
+}
+
+// writeClusterRecordFile writes the record of a cluster to a file, for the
+// cluster to be restored without downloading its backup, see restoreFromFile.
+// It is only readable by the user.
+func writeClusterRecordFile(path string, record *corev1.Secret) error {
+	data, err := yaml.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, recordFilePermissions)
+}
+
+func newVeleroBackup(backupName, clusterName string) *unstructured.Unstructured {
+	includeNamespaces := bso.includeNamespaces
+	if !containsString(includeNamespaces, "*") && !containsString(includeNamespaces, clusterRecordNamespace) {
+		// the record of the cluster is needed to restore it
+		includeNamespaces = append(includeNamespaces, clusterRecordNamespace)
+	}
+
+	var excludeNamespaces []string
+	for _, namespace := range bso.excludeNamespaces {
+		if namespace != clusterRecordNamespace {
+			excludeNamespaces = append(excludeNamespaces, namespace)
+		}
+	}
+
+	spec := map[string]interface{}{
+		"includedNamespaces": toInterfaceSlice(includeNamespaces),
+		"storageLocation":    bso.storageLocation,
+		"ttl":                bso.ttl.String(),
+	}
+	if len(excludeNamespaces) > 0 {
+		spec["excludedNamespaces"] = toInterfaceSlice(excludeNamespaces)
+	}
+
+	veleroBackup := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	veleroBackup.SetGroupVersionKind(veleroGVK("Backup"))
+	veleroBackup.SetNamespace(bso.veleroNamespace)
+	veleroBackup.SetName(backupName)
+	veleroBackup.SetLabels(map[string]string{standaloneClusterLabel: clusterName})
+	return veleroBackup
+}
+
+func toInterfaceSlice(values []string) []interface{} {
+	result := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		result = append(result, v)
+	}
+	return result
+}
+
+// waitForVeleroPhase waits for a Velero backup or restore to complete. It
+// fails when Velero fails it, or only partially completes it.
+func waitForVeleroPhase(ctx context.Context, client crtclient.Client, obj *unstructured.Unstructured, timeout time.Duration) error {
+	key := crtclient.ObjectKey{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	var phase string
+	err := wait.PollImmediate(backupPollInterval, timeout, func() (bool, error) {
+		if getErr := client.Get(ctx, key, obj); getErr != nil {
+			log.Warningf("could not get %s %s: %v", obj.GetKind(), key, getErr)
+			return false, nil
+		}
+		phase, _, _ = unstructured.NestedString(obj.Object, "status", "phase")
+		log.V(3).Infof("%s %s is %s", obj.GetKind(), key, defaultIfEmpty(phase, "New"))
+		return phase == veleroPhaseCompleted || phase == veleroPhasePartiallyFailed || phase == veleroPhaseFailed, nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s %s did not complete: %v", obj.GetKind(), key, err)
+	}
+	if phase != veleroPhaseCompleted {
+		return fmt.Errorf("%s %s is %s: see 'velero %s describe %s --details'", obj.GetKind(), key, phase, strings.ToLower(obj.GetKind()), obj.GetName())
+	}
+	return nil
+}
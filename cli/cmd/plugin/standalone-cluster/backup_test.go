@@ -0,0 +1,142 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestClusterRecord(t *testing.T, key []byte) *corev1.Secret {
+	t.Helper()
+	state := &standaloneClusterState{
+		Name:                   "test",
+		InfrastructureProvider: "docker",
+		Config:                 map[string]interface{}{"CLUSTER_NAME": "test"},
+	}
+	record, err := newClusterRecord(state, []byte("kubeconfig"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestClusterRecordFile(t *testing.T) {
+	key := make([]byte, 32)
+	path := filepath.Join(t.TempDir(), "test.record")
+	if err := writeClusterRecordFile(path, newTestClusterRecord(t, key)); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != recordFilePermissions {
+		t.Errorf("expected the record file to be only readable by the user, got %v", info.Mode().Perm())
+	}
+
+	record, err := readSealedClusterRecord(path, "test", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.State.Name != "test" || string(record.Kubeconfig) != "kubeconfig" {
+		t.Errorf("expected the record of cluster test, got %+v", record)
+	}
+
+	if _, err = readClusterRecord(path, "other"); err == nil {
+		t.Error("expected an error for the record of another cluster")
+	}
+}
+
+func TestClusterRecordArchive(t *testing.T) {
+	key := make([]byte, 32)
+	secret := newTestClusterRecord(t, key)
+	data, err := json.Marshal(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "test-data.tar.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	name := "resources/secrets/namespaces/" + clusterRecordNamespace + "/" + secret.Name + ".json"
+	if err = tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tarWriter.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	tarWriter.Close()
+	gzipWriter.Close()
+	file.Close()
+
+	record, err := readSealedClusterRecord(path, "test", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.State.Name != "test" {
+		t.Errorf("expected the record of cluster test, got %+v", record)
+	}
+
+	if _, err = readClusterRecord(path, "other"); err == nil {
+		t.Error("expected an error for a backup without the record of the cluster")
+	}
+}
+
+func TestNewVeleroBackup(t *testing.T) {
+	defer func(options backupStandaloneOptions) {
+		bso = options
+	}(bso)
+
+	tests := []struct {
+		name        string
+		include     []string
+		exclude     []string
+		wantInclude []string
+		wantExclude []string
+	}{
+		{"system namespaces excluded by default", []string{"*"}, defaultExcludedNamespaces, []string{"*"}, defaultExcludedNamespaces},
+		{"record namespace included", []string{"apps"}, nil, []string{"apps", clusterRecordNamespace}, nil},
+		{"record namespace not excluded", []string{"*"}, []string{"apps", clusterRecordNamespace}, []string{"*"}, []string{"apps"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bso = backupStandaloneOptions{includeNamespaces: test.include, excludeNamespaces: test.exclude, veleroNamespace: defaultVeleroNamespace}
+			veleroBackup := newVeleroBackup("test-backup", "test")
+
+			include, _, _ := unstructured.NestedStringSlice(veleroBackup.Object, "spec", "includedNamespaces")
+			if !equalStrings(include, test.wantInclude) {
+				t.Errorf("expected included namespaces %v, got %v", test.wantInclude, include)
+			}
+			exclude, _, _ := unstructured.NestedStringSlice(veleroBackup.Object, "spec", "excludedNamespaces")
+			if !equalStrings(exclude, test.wantExclude) {
+				t.Errorf("expected excluded namespaces %v, got %v", test.wantExclude, exclude)
+			}
+		})
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	kindComponent       = "kubernetes-sigs_kind"
+	kindNodeImage       = "kindNodeImage"
+	kubernetesComponent = "kubernetes"
+)
+
+// bom is the part of a Tanzu Kubernetes Grid BoM or of a Tanzu Kubernetes
+// release BoM read by the plugin
+type bom struct {
+	ImageConfig struct {
+		ImageRepository string `json:"imageRepository"`
+	} `json:"imageConfig"`
+	Components map[string][]bomComponent `json:"components"`
+	// AMI are the Amazon machine images of the release, by region
+	AMI map[string][]struct {
+		ID string `json:"id"`
+	} `json:"ami"`
+}
+
+type bomComponent struct {
+	Version string              `json:"version"`
+	Images  map[string]bomImage `json:"images"`
+}
+
+type bomImage struct {
+	ImageRepository string `json:"imageRepository"`
+	ImagePath       string `json:"imagePath"`
+	Tag             string `json:"tag"`
+}
+
+func readBoM(path string) (*bom, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read BoM: %v", err)
+	}
+	content := &bom{}
+	if err := yaml.Unmarshal(data, content); err != nil {
+		return nil, fmt.Errorf("cannot parse BoM %s: %v", path, err)
+	}
+	return content, nil
+}
+
+// getTKRBoMPath returns the path of the BoM of a Tanzu Kubernetes release
+// downloaded by Tanzu Framework
+func getTKRBoMPath(tkr string) (string, error) {
+	configDir, err := getTKGConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "bom", "tkr-bom-"+tkr+".yaml"), nil
+}
+
+// componentVersion returns the version of the first release of a component,
+// or an empty string
+func (b *bom) componentVersion(component string) string {
+	if releases := b.Components[component]; len(releases) > 0 {
+		return releases[0].Version
+	}
+	return ""
+}
+
+// imageTag returns the tag of an image of the first release of a component,
+// or an empty string
+func (b *bom) imageTag(component, name string) string {
+	if releases := b.Components[component]; len(releases) > 0 {
+		return releases[0].Images[name].Tag
+	}
+	return ""
+}
+
+// image returns the reference of an image of the first release of a
+// component, or an empty string
+func (b *bom) image(component, name string) string {
+	releases := b.Components[component]
+	if len(releases) == 0 {
+		return ""
+	}
+	image, ok := releases[0].Images[name]
+	if !ok {
+		return ""
+	}
+	repository := defaultIfEmpty(image.ImageRepository, b.ImageConfig.ImageRepository)
+	return fmt.Sprintf("%s/%s:%s", strings.TrimSuffix(repository, "/"), image.ImagePath, image.Tag)
+}
+
+// latestBoM returns the Tanzu Kubernetes Grid BoM of a directory with the
+// highest version, named tkg-bom-<version>.yaml
+func latestBoM(dir string) string {
+	boms, err := filepath.Glob(filepath.Join(dir, "tkg-bom-*.yaml"))
+	if err != nil {
+		return ""
+	}
+
+	var latest string
+	var latestVersion *utilversion.Version
+	for _, bom := range boms {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(bom), "tkg-bom-"), ".yaml")
+		version, parseErr := utilversion.ParseSemantic(name)
+		if parseErr != nil {
+			continue
+		}
+		if latestVersion == nil || latestVersion.LessThan(version) {
+			latest, latestVersion = bom, version
+		}
+	}
+	return latest
+}
@@ -0,0 +1,42 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLatestBoM(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"no BoM", nil, ""},
+		{"single BoM", []string{"tkg-bom-v1.4.0.yaml"}, "tkg-bom-v1.4.0.yaml"},
+		{"semantic order", []string{"tkg-bom-v1.4.10.yaml", "tkg-bom-v1.4.9.yaml", "tkg-bom-v1.3.1.yaml"}, "tkg-bom-v1.4.10.yaml"},
+		{"pre-release", []string{"tkg-bom-v1.4.0.yaml", "tkg-bom-v1.4.0-zshippable.yaml"}, "tkg-bom-v1.4.0.yaml"},
+		{"invalid versions skipped", []string{"tkg-bom-latest.yaml", "tkg-bom-v1.4.0.yaml", "tkr-bom-v1.21.2.yaml"}, "tkg-bom-v1.4.0.yaml"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, file := range test.files {
+				if err := os.WriteFile(filepath.Join(dir, file), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want := ""
+			if test.want != "" {
+				want = filepath.Join(dir, test.want)
+			}
+			if got := latestBoM(dir); got != want {
+				t.Errorf("expected BoM %q, got %q", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,495 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/clientcmd"
+	crtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/kind/pkg/cluster"
+	kindcmd "sigs.k8s.io/kind/pkg/cmd"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/client"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/clusterclient"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/constants"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+const (
+	// bootstrapClusterPrefix is the prefix of the kind clusters bootstrapping
+	// clusters, created by Tanzu Framework or by the plugin
+	bootstrapClusterPrefix = "tkg-kind-"
+
+	bootstrapClusterReadyTimeout = 5 * time.Minute
+	// clusterAPIObjectsTimeout bounds the time spent installing the Cluster
+	// API store of a cluster, or reading its Cluster API objects
+	clusterAPIObjectsTimeout = 2 * time.Minute
+)
+
+var capiClusterListGVK = schema.GroupVersionKind{
+	Group:   "cluster.x-k8s.io",
+	Version: "v1alpha3",
+	Kind:    "ClusterList",
+}
+
+func newKindProvider() *cluster.Provider {
+	return cluster.NewProvider(cluster.ProviderWithLogger(kindcmd.NewLogger()))
+}
+
+// listBootstrapClusters returns the names of the bootstrap kind clusters
+func listBootstrapClusters(prov *cluster.Provider) ([]string, error) {
+	clusters, err := prov.List()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list kind clusters: %v", err)
+	}
+
+	var bootstrapClusters []string
+	for _, name := range clusters {
+		if strings.HasPrefix(name, bootstrapClusterPrefix) {
+			bootstrapClusters = append(bootstrapClusters, name)
+		}
+	}
+	return bootstrapClusters, nil
+}
+
+// bootstrapCluster is a kind cluster holding the Cluster API objects of a
+// standalone cluster, while the cluster is created, scaled or upgraded
+type bootstrapCluster interface {
+	Name() string
+	// UseContext makes the bootstrap cluster the current context of the
+	// default kubeconfig, see useBootstrapClusterContext
+	UseContext() (func(), error)
+	// InitializeProviders installs the Cluster API providers of a standalone
+	// cluster, as Tanzu Framework does while creating it
+	InitializeProviders(state *standaloneClusterState) error
+	// ClusterKubeconfig reads the admin kubeconfig of a standalone cluster
+	// from its Cluster API kubeconfig secret
+	ClusterKubeconfig(clusterName string) ([]byte, error)
+	// MoveToCluster moves the Cluster API objects of a standalone cluster to
+	// the Cluster API store of the cluster, see installClusterAPIStore, and
+	// MoveFromCluster moves them back to the bootstrap cluster
+	MoveToCluster(state *standaloneClusterState, kubeconfig []byte) error
+	MoveFromCluster(state *standaloneClusterState, kubeconfig []byte) error
+	Client() (crtclient.Client, error)
+	Delete() error
+}
+
+// newBootstrapCluster creates the bootstrap cluster of a standalone cluster.
+// It is replaced by a fake in the plugin built for the CLI tests, see
+// client_fake.go.
+var newBootstrapCluster = func(state *standaloneClusterState) (bootstrapCluster, error) {
+	b := &kindBootstrapCluster{
+		prov: newKindProvider(),
+		name: fmt.Sprintf("%s%d", bootstrapClusterPrefix, time.Now().Unix()),
+	}
+
+	kubeconfig, err := os.CreateTemp("", b.name+"-*.kubeconfig")
+	if err != nil {
+		return nil, err
+	}
+	kubeconfig.Close()
+	defer os.Remove(kubeconfig.Name())
+
+	options := []cluster.CreateOption{
+		cluster.CreateWithRawConfig([]byte(bootstrapClusterConfig(state.InfrastructureProvider))),
+		cluster.CreateWithKubeconfigPath(kubeconfig.Name()),
+		cluster.CreateWithWaitForReady(bootstrapClusterReadyTimeout),
+		cluster.CreateWithDisplayUsage(false),
+		cluster.CreateWithDisplaySalutation(false),
+	}
+	if image := bootstrapClusterNodeImage(); image != "" {
+		options = append(options, cluster.CreateWithNodeImage(image))
+	}
+
+	log.Infof("Creating bootstrap cluster %s", b.name)
+	if err := b.prov.Create(b.name, options...); err != nil {
+		return nil, fmt.Errorf("cannot create bootstrap cluster %s: %v", b.name, err)
+	}
+	return b, nil
+}
+
+// findBootstrapCluster returns a running bootstrap cluster, or nil when it is
+// gone. It is replaced by a fake in the plugin built for the CLI tests, see
+// client_fake.go.
+var findBootstrapCluster = func(name string) (bootstrapCluster, error) {
+	prov := newKindProvider()
+	bootstrapClusters, err := listBootstrapClusters(prov)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(bootstrapClusters, name) {
+		return nil, nil
+	}
+	return &kindBootstrapCluster{prov: prov, name: name}, nil
+}
+
+// bootstrapClusterConfig returns the kind configuration of a bootstrap
+// cluster. The Docker provider creates the nodes of the standalone cluster from
+// the bootstrap cluster, through the Docker socket of the host.
+func bootstrapClusterConfig(infrastructureProvider string) string {
+	config := `kind: Cluster
+apiVersion: kind.x-k8s.io/v1alpha4
+nodes:
+- role: control-plane
+`
+	if infrastructureProvider == "docker" {
+		config += `  extraMounts:
+  - hostPath: /var/run/docker.sock
+    containerPath: /var/run/docker.sock
+`
+	}
+	return config
+}
+
+// bootstrapClusterNodeImage returns the kind node image of the latest Tanzu
+// Kubernetes Grid BoM downloaded by Tanzu Framework, or an empty string for
+// kind to use its default image
+func bootstrapClusterNodeImage() string {
+	configDir, err := getTKGConfigDir()
+	if err != nil {
+		return ""
+	}
+	path := latestBoM(filepath.Join(configDir, "bom"))
+	if path == "" {
+		return ""
+	}
+	content, err := readBoM(path)
+	if err != nil {
+		return ""
+	}
+	return content.image(kindComponent, kindNodeImage)
+}
+
+// kindBootstrapCluster is a bootstrap cluster run by kind
+type kindBootstrapCluster struct {
+	prov *cluster.Provider
+	name string
+}
+
+func (b *kindBootstrapCluster) Name() string {
+	return b.name
+}
+
+func (b *kindBootstrapCluster) UseContext() (func(), error) {
+	return useBootstrapClusterContext(b.prov, b.name)
+}
+
+func (b *kindBootstrapCluster) InitializeProviders(state *standaloneClusterState) error {
+	kubeconfig, err := b.kubeconfig()
+	if err != nil {
+		return err
+	}
+	path, remove, err := writeTempKubeconfig(b.name, kubeconfig)
+	if err != nil {
+		return err
+	}
+	defer remove()
+
+	configDir, err := getTKGConfigDir()
+	if err != nil {
+		return err
+	}
+	c, err := newTKGClient(configDir, configValues(state.Config))
+	if err != nil {
+		return err
+	}
+	options := &client.InitRegionOptions{
+		ClusterName:            state.Name,
+		Plan:                   state.Plan,
+		InfrastructureProvider: state.InfrastructureProvider,
+		Edition:                BuildEdition,
+	}
+	// the providers are installed with the configuration the cluster was
+	// created with, which is only defaulted
+	if validationErr := c.ConfigureAndValidateManagementClusterConfiguration(options, true); validationErr != nil {
+		return validationErr
+	}
+	clusterClient, err := clusterclient.NewClient(path, "", clusterclient.Options{OperationTimeout: constants.DefaultOperationTimeout})
+	if err != nil {
+		return err
+	}
+	return c.InitializeProviders(options, clusterClient, path)
+}
+
+func (b *kindBootstrapCluster) ClusterKubeconfig(clusterName string) ([]byte, error) {
+	client, err := b.Client()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), clusterAPIObjectsTimeout)
+	defer cancel()
+	kubeconfig, err := readClusterKubeconfigSecret(ctx, client, clusterName)
+	if err == nil && kubeconfig == nil {
+		err = fmt.Errorf("bootstrap cluster %s holds no Cluster API cluster named %s", b.name, clusterName)
+	}
+	return kubeconfig, err
+}
+
+func (b *kindBootstrapCluster) MoveToCluster(state *standaloneClusterState, kubeconfig []byte) error {
+	bootstrapKubeconfig, err := b.kubeconfig()
+	if err != nil {
+		return err
+	}
+	from, err := b.Client()
+	if err != nil {
+		return err
+	}
+	to, err := newKubeconfigClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterAPIObjectsTimeout)
+	defer cancel()
+	namespace, err := clusterAPINamespace(ctx, from, state.Name)
+	if err != nil {
+		return err
+	}
+	if err = installClusterAPIStore(ctx, from, to); err != nil {
+		return fmt.Errorf("cannot install the Cluster API store of standalone cluster %s: %v", state.Name, err)
+	}
+	return moveClusterAPIObjects(state, bootstrapKubeconfig, kubeconfig, namespace)
+}
+
+func (b *kindBootstrapCluster) MoveFromCluster(state *standaloneClusterState, kubeconfig []byte) error {
+	bootstrapKubeconfig, err := b.kubeconfig()
+	if err != nil {
+		return err
+	}
+	from, err := newKubeconfigClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterAPIObjectsTimeout)
+	defer cancel()
+	clusters, err := findClusterAPIClusters(ctx, from, state.Name)
+	if err != nil {
+		return err
+	}
+	if len(clusters) != 1 {
+		return fmt.Errorf("%w: standalone cluster %s was created by a previous version of the plugin, or its objects are held by another bootstrap cluster", errClusterAPIStoreNotFound, state.Name)
+	}
+	return moveClusterAPIObjects(state, kubeconfig, bootstrapKubeconfig, clusters[0].GetNamespace())
+}
+
+func (b *kindBootstrapCluster) kubeconfig() ([]byte, error) {
+	kubeconfig, err := b.prov.KubeConfig(b.name, false)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get kubeconfig of bootstrap cluster %s: %v", b.name, err)
+	}
+	return []byte(kubeconfig), nil
+}
+
+func (b *kindBootstrapCluster) Client() (crtclient.Client, error) {
+	return newBootstrapClusterClient(b.prov, b.name)
+}
+
+func (b *kindBootstrapCluster) Delete() error {
+	return b.prov.Delete(b.name, "")
+}
+
+// restoreBootstrapCluster creates a bootstrap cluster holding the Cluster API
+// objects of a standalone cluster, moved from the Cluster API store of the
+// cluster, for Cluster API to manage the cluster again. A bootstrap cluster
+// kept by a previous operation, which still holds the objects, is used
+// instead. The returned function moves the objects back to the store, see
+// releaseBootstrapCluster.
+func restoreBootstrapCluster(state *standaloneClusterState) (bootstrapCluster, func(), error) {
+	release := func(bootstrap bootstrapCluster) func() {
+		return func() {
+			releaseBootstrapCluster(bootstrap, state)
+			if saveErr := saveStandaloneClusterState(state); saveErr != nil {
+				log.Warningf("could not save the state of standalone cluster %s: %v", state.Name, saveErr)
+			}
+		}
+	}
+
+	if state.BootstrapCluster != "" {
+		bootstrap, err := findBootstrapCluster(state.BootstrapCluster)
+		if err != nil {
+			return nil, nil, err
+		}
+		if bootstrap != nil {
+			log.Infof("Using bootstrap cluster %s, which holds the Cluster API objects of standalone cluster %s", bootstrap.Name(), state.Name)
+			return bootstrap, release(bootstrap), nil
+		}
+		log.Warningf("bootstrap cluster %s holding the Cluster API objects of standalone cluster %s is gone", state.BootstrapCluster, state.Name)
+		state.BootstrapCluster = ""
+	}
+
+	kubeconfig, err := loadClusterKubeconfig(state.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bootstrap, err := newBootstrapCluster(state)
+	if err != nil {
+		return nil, nil, err
+	}
+	deleteBootstrap := func() {
+		log.Infof("Deleting bootstrap cluster %s", bootstrap.Name())
+		if deleteErr := bootstrap.Delete(); deleteErr != nil {
+			log.Warningf("could not delete bootstrap cluster %s: %v", bootstrap.Name(), deleteErr)
+		}
+	}
+
+	log.Infof("Installing Cluster API providers in bootstrap cluster %s", bootstrap.Name())
+	if err = bootstrap.InitializeProviders(state); err != nil {
+		deleteBootstrap()
+		return nil, nil, fmt.Errorf("cannot install Cluster API providers in bootstrap cluster %s: %v", bootstrap.Name(), err)
+	}
+	log.Infof("Moving Cluster API objects of standalone cluster %s to bootstrap cluster %s", state.Name, bootstrap.Name())
+	if err = bootstrap.MoveFromCluster(state, kubeconfig); err != nil {
+		deleteBootstrap()
+		return nil, nil, fmt.Errorf("cannot move Cluster API objects to bootstrap cluster %s: %v", bootstrap.Name(), err)
+	}
+
+	return bootstrap, release(bootstrap), nil
+}
+
+// releaseBootstrapCluster moves the Cluster API objects of a standalone
+// cluster from its bootstrap cluster to the Cluster API store of the cluster,
+// then deletes the bootstrap cluster. When the objects cannot be moved, the
+// bootstrap cluster is kept and recorded in the state of the cluster, for the
+// next operation to manage the cluster from it.
+func releaseBootstrapCluster(bootstrap bootstrapCluster, state *standaloneClusterState) {
+	err := runPhase(phaseMove, func() error {
+		kubeconfig, err := loadClusterKubeconfig(state.Name)
+		if err != nil {
+			return err
+		}
+		log.Infof("Moving Cluster API objects of standalone cluster %s to the cluster", state.Name)
+		return bootstrap.MoveToCluster(state, kubeconfig)
+	})
+	if err != nil {
+		log.Warningf("could not move the Cluster API objects of standalone cluster %s to the cluster, bootstrap cluster %s holding them is kept to manage it: %v", state.Name, bootstrap.Name(), err)
+		state.BootstrapCluster = bootstrap.Name()
+		return
+	}
+
+	state.BootstrapCluster = ""
+	log.Infof("Deleting bootstrap cluster %s", bootstrap.Name())
+	if err = runPhase(phaseBootstrapClusterDeletion, bootstrap.Delete); err != nil {
+		log.Warningf("could not delete bootstrap cluster %s: %v", bootstrap.Name(), err)
+	}
+}
+
+// manageStandaloneCluster runs manage with a client of a bootstrap cluster
+// holding the Cluster API objects of a standalone cluster, see
+// restoreBootstrapCluster
+func manageStandaloneCluster(state *standaloneClusterState, timeout time.Duration, manage func(ctx context.Context, client crtclient.Client) error) error {
+	bootstrap, release, err := restoreBootstrapCluster(state)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	client, err := bootstrap.Client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return manage(ctx, client)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// newBootstrapClusterClient returns a client of a bootstrap kind cluster
+func newBootstrapClusterClient(prov *cluster.Provider, bootstrapCluster string) (crtclient.Client, error) {
+	kubeconfig, err := prov.KubeConfig(bootstrapCluster, false)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get kubeconfig of bootstrap cluster %s: %v", bootstrapCluster, err)
+	}
+	return newKubeconfigClient([]byte(kubeconfig))
+}
+
+// findClusterAPIClusters returns the Cluster API clusters of a bootstrap cluster,
+// or of the Cluster API store of a standalone cluster, which are named
+// clusterName
+func findClusterAPIClusters(ctx context.Context, client crtclient.Client, clusterName string) ([]unstructured.Unstructured, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(capiClusterListGVK)
+	if err := client.List(ctx, list); err != nil {
+		if meta.IsNoMatchError(err) {
+			// Cluster API is not installed yet
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var clusters []unstructured.Unstructured
+	for i := range list.Items {
+		if list.Items[i].GetName() == clusterName {
+			clusters = append(clusters, list.Items[i])
+		}
+	}
+	return clusters, nil
+}
+
+// useBootstrapClusterContext adds the context of a bootstrap kind cluster to
+// the default kubeconfig and makes it the current context, for Tanzu Framework
+// to use it as an existing bootstrap cluster. The returned function removes
+// the context of the bootstrap cluster.
+func useBootstrapClusterContext(prov *cluster.Provider, bootstrapCluster string) (func(), error) {
+	kubeconfig, err := prov.KubeConfig(bootstrapCluster, false)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get kubeconfig of bootstrap cluster %s: %v", bootstrapCluster, err)
+	}
+	bootstrapConfig, err := clientcmd.Load([]byte(kubeconfig))
+	if err != nil {
+		return nil, err
+	}
+
+	pathOptions := clientcmd.NewDefaultPathOptions()
+	config, err := pathOptions.GetStartingConfig()
+	if err != nil {
+		return nil, err
+	}
+	mergeKubeconfig(config, bootstrapConfig)
+	config.CurrentContext = bootstrapConfig.CurrentContext
+	if err := clientcmd.ModifyConfig(pathOptions, *config, true); err != nil {
+		return nil, fmt.Errorf("cannot add bootstrap cluster context to kubeconfig: %v", err)
+	}
+
+	return func() {
+		current, loadErr := pathOptions.GetStartingConfig()
+		if loadErr != nil {
+			log.Warningf("could not remove bootstrap cluster context from kubeconfig: %v", loadErr)
+			return
+		}
+		for name := range bootstrapConfig.Clusters {
+			delete(current.Clusters, name)
+		}
+		for name := range bootstrapConfig.AuthInfos {
+			delete(current.AuthInfos, name)
+		}
+		for name := range bootstrapConfig.Contexts {
+			delete(current.Contexts, name)
+		}
+		if _, ok := bootstrapConfig.Contexts[current.CurrentContext]; ok {
+			current.CurrentContext = ""
+		}
+		if modifyErr := clientcmd.ModifyConfig(pathOptions, *current, true); modifyErr != nil {
+			log.Warningf("could not remove bootstrap cluster context from kubeconfig: %v", modifyErr)
+		}
+	}, nil
+}
@@ -0,0 +1,442 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/clientcmd"
+	crtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+const (
+	// clusterctlLabel labels the CRDs of the Cluster API providers, whose
+	// objects are moved between clusters by clusterctl
+	clusterctlLabel = "clusterctl.cluster.x-k8s.io"
+	// clusterctlGroup is the group of the inventory of the providers
+	// installed by clusterctl
+	clusterctlGroup = "clusterctl.cluster.x-k8s.io"
+	// clusterNameLabel labels the objects of a Cluster API cluster
+	clusterNameLabel = "cluster.x-k8s.io/cluster-name"
+	// clusterAPIStoreLabel labels the CRDs of the Cluster API store of a
+	// standalone cluster
+	clusterAPIStoreLabel = "tanzu.vmware.com/cluster-api-store"
+
+	rolloutPollInterval = 10 * time.Second
+	crdPollInterval     = 2 * time.Second
+)
+
+var (
+	errClusterKubeconfigNotFound = errors.New("the kubeconfig of the cluster was not saved")
+	errClusterAPIStoreNotFound   = errors.New("the Cluster API objects of the cluster are not stored in it")
+
+	crdListGVK = schema.GroupVersionKind{
+		Group:   "apiextensions.k8s.io",
+		Version: "v1",
+		Kind:    "CustomResourceDefinitionList",
+	}
+	providerListGVK = schema.GroupVersionKind{
+		Group:   clusterctlGroup,
+		Version: "v1alpha3",
+		Kind:    "ProviderList",
+	}
+	machineDeploymentListGVK = schema.GroupVersionKind{
+		Group:   "cluster.x-k8s.io",
+		Version: "v1alpha3",
+		Kind:    "MachineDeploymentList",
+	}
+	kubeadmControlPlaneListGVK = schema.GroupVersionKind{
+		Group:   "controlplane.cluster.x-k8s.io",
+		Version: "v1alpha3",
+		Kind:    "KubeadmControlPlaneList",
+	}
+)
+
+// installClusterAPIStore installs the Cluster API store of a standalone
+// cluster: the CRDs and the inventory of the Cluster API providers of a
+// bootstrap cluster, without the providers. Once the cluster is created, its
+// Cluster API objects are moved to its store by clusterctl, as they are to a
+// management cluster, and moved back to a bootstrap cluster to scale or
+// upgrade it.
+func installClusterAPIStore(ctx context.Context, from, to crtclient.Client) error {
+	crds, err := applyStoreCRDs(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	if err = waitForCRDsEstablished(ctx, to, crds); err != nil {
+		return err
+	}
+	return copyProviderInventory(ctx, from, to)
+}
+
+// applyStoreCRDs creates or updates the CRDs of the store of a cluster from
+// the CRDs of the providers, and returns their names
+func applyStoreCRDs(ctx context.Context, from, to crtclient.Client) ([]string, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(crdListGVK)
+	if err := from.List(ctx, list); err != nil {
+		return nil, fmt.Errorf("cannot list CRDs: %v", err)
+	}
+
+	var names []string
+	for i := range list.Items {
+		if !isClusterAPIStoreCRD(&list.Items[i]) {
+			continue
+		}
+		crd, err := storeCRD(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		if err = applyStoreObject(ctx, to, crd); err != nil {
+			return nil, err
+		}
+		names = append(names, crd.GetName())
+	}
+	return names, nil
+}
+
+// isClusterAPIStoreCRD returns whether a CRD defines objects moved by
+// clusterctl, or the inventory of the providers clusterctl checks before
+// moving them
+func isClusterAPIStoreCRD(crd *unstructured.Unstructured) bool {
+	if _, ok := crd.GetLabels()[clusterctlLabel]; ok {
+		return true
+	}
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	return group == clusterctlGroup
+}
+
+// storeCRD returns the CRD of the store of a cluster for the CRD of a
+// provider. No provider reconciles the objects of the store: the CRD only
+// serves the storage version, without conversion webhook, and without status
+// subresource for the status of the objects to be stored along with them, as
+// clusterctl checks it before moving them back.
+func storeCRD(crd *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	spec, found, err := unstructured.NestedMap(crd.Object, "spec")
+	if err != nil || !found {
+		return nil, fmt.Errorf("CRD %s has no spec", crd.GetName())
+	}
+	versions, _, _ := unstructured.NestedSlice(spec, "versions")
+	var storageVersions []interface{}
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if !ok || version["storage"] != true {
+			continue
+		}
+		delete(version, "subresources")
+		version["served"] = true
+		storageVersions = append(storageVersions, version)
+	}
+	if len(storageVersions) != 1 {
+		return nil, fmt.Errorf("CRD %s has %d storage versions", crd.GetName(), len(storageVersions))
+	}
+	spec["versions"] = storageVersions
+	spec["conversion"] = map[string]interface{}{"strategy": "None"}
+
+	store := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	store.SetGroupVersionKind(crd.GroupVersionKind())
+	store.SetName(crd.GetName())
+	labels := map[string]string{clusterAPIStoreLabel: "true"}
+	for key, value := range crd.GetLabels() {
+		labels[key] = value
+	}
+	store.SetLabels(labels)
+	return store, nil
+}
+
+// copyProviderInventory copies the inventory of the providers of a bootstrap
+// cluster to the store of a cluster, for clusterctl to move objects between
+// them
+func copyProviderInventory(ctx context.Context, from, to crtclient.Client) error {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(providerListGVK)
+	if err := from.List(ctx, list); err != nil {
+		return fmt.Errorf("cannot list Cluster API providers: %v", err)
+	}
+
+	for i := range list.Items {
+		provider := list.Items[i].DeepCopy()
+		for _, field := range []string{"uid", "resourceVersion", "generation", "creationTimestamp", "selfLink", "managedFields", "ownerReferences"} {
+			unstructured.RemoveNestedField(provider.Object, "metadata", field)
+		}
+		if err := ensureNamespace(ctx, to, provider.GetNamespace()); err != nil {
+			return err
+		}
+		if err := applyStoreObject(ctx, to, provider); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyStoreObject creates an object of the store of a cluster, or updates it
+// when it exists
+func applyStoreObject(ctx context.Context, client crtclient.Client, object *unstructured.Unstructured) error {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(object.GroupVersionKind())
+	err := client.Get(ctx, crtclient.ObjectKey{Namespace: object.GetNamespace(), Name: object.GetName()}, existing)
+	switch {
+	case apierrors.IsNotFound(err):
+		err = client.Create(ctx, object)
+	case err == nil:
+		object.SetResourceVersion(existing.GetResourceVersion())
+		err = client.Update(ctx, object)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot apply %s %s: %v", object.GetKind(), object.GetName(), err)
+	}
+	return nil
+}
+
+// waitForCRDsEstablished waits for CRDs to be served by the API server
+func waitForCRDsEstablished(ctx context.Context, client crtclient.Client, names []string) error {
+	return wait.PollImmediate(crdPollInterval, clusterAPIObjectsTimeout, func() (bool, error) {
+		for _, name := range names {
+			crd := &unstructured.Unstructured{}
+			crd.SetGroupVersionKind(crdListGVK.GroupVersion().WithKind("CustomResourceDefinition"))
+			if err := client.Get(ctx, crtclient.ObjectKey{Name: name}, crd); err != nil {
+				log.V(3).Infof("could not check CRD %s is established: %v", name, err)
+				return false, nil
+			}
+			if !crdEstablished(crd) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+func crdEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Established" && condition["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+func ensureNamespace(ctx context.Context, client crtclient.Client, name string) error {
+	if name == "" {
+		return nil
+	}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if err := client.Create(ctx, namespace); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("cannot create namespace %s: %v", name, err)
+	}
+	return nil
+}
+
+// clusterAPINamespace returns the namespace of the Cluster API cluster of a
+// standalone cluster
+func clusterAPINamespace(ctx context.Context, client crtclient.Client, clusterName string) (string, error) {
+	clusters, err := findClusterAPIClusters(ctx, client, clusterName)
+	if err != nil {
+		return "", err
+	}
+	if len(clusters) != 1 {
+		return "", fmt.Errorf("found %d Cluster API clusters named %s", len(clusters), clusterName)
+	}
+	return clusters[0].GetNamespace(), nil
+}
+
+// moveClusterAPIObjects moves the Cluster API objects of a standalone cluster
+// between two clusters with clusterctl, as Tanzu Framework moves the objects
+// of a management cluster from its bootstrap cluster
+func moveClusterAPIObjects(state *standaloneClusterState, fromKubeconfig, toKubeconfig []byte, namespace string) error {
+	fromPath, removeFrom, err := writeTempKubeconfig(state.Name+"-from", fromKubeconfig)
+	if err != nil {
+		return err
+	}
+	defer removeFrom()
+	toPath, removeTo, err := writeTempKubeconfig(state.Name+"-to", toKubeconfig)
+	if err != nil {
+		return err
+	}
+	defer removeTo()
+
+	configDir, err := getTKGConfigDir()
+	if err != nil {
+		return err
+	}
+	c, err := newTKGClient(configDir, configValues(state.Config))
+	if err != nil {
+		return err
+	}
+	return c.MoveObjects(fromPath, toPath, namespace)
+}
+
+// readClusterKubeconfigSecret reads the Cluster API kubeconfig secret of a
+// cluster. It returns nil when the Cluster API cluster is not found.
+func readClusterKubeconfigSecret(ctx context.Context, client crtclient.Client, clusterName string) ([]byte, error) {
+	clusters, err := findClusterAPIClusters(ctx, client, clusterName)
+	if err != nil || len(clusters) == 0 {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{}
+	key := crtclient.ObjectKey{Namespace: clusters[0].GetNamespace(), Name: clusterName + "-kubeconfig"}
+	if err = client.Get(ctx, key, secret); err != nil {
+		return nil, fmt.Errorf("cannot get secret %s: %v", key, err)
+	}
+	return secret.Data["value"], nil
+}
+
+// updateClusterKubeconfigSecret updates the Cluster API kubeconfig secret of a
+// cluster in its Cluster API store. Nothing is updated when the store does not
+// hold the cluster, e.g. while a bootstrap cluster holds it.
+func updateClusterKubeconfigSecret(ctx context.Context, client crtclient.Client, clusterName string, kubeconfig []byte) error {
+	clusters, err := findClusterAPIClusters(ctx, client, clusterName)
+	if err != nil || len(clusters) == 0 {
+		return err
+	}
+
+	secret := &corev1.Secret{}
+	key := crtclient.ObjectKey{Namespace: clusters[0].GetNamespace(), Name: clusterName + "-kubeconfig"}
+	if err = client.Get(ctx, key, secret); err != nil {
+		return fmt.Errorf("cannot get secret %s: %v", key, err)
+	}
+	patch := crtclient.MergeFrom(secret.DeepCopy())
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	secret.Data["value"] = kubeconfig
+	if err = client.Patch(ctx, secret, patch); err != nil {
+		return fmt.Errorf("cannot update secret %s: %v", key, err)
+	}
+	return nil
+}
+
+// newKubeconfigClient returns a client of the cluster of a kubeconfig
+func newKubeconfigClient(kubeconfig []byte) (crtclient.Client, error) {
+	cfg, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Timeout = clusterStatusTimeout
+	return crtclient.New(cfg, crtclient.Options{})
+}
+
+// writeTempKubeconfig writes a kubeconfig to a temporary file, only readable
+// by the user. The returned function removes the file.
+func writeTempKubeconfig(prefix string, kubeconfig []byte) (string, func(), error) {
+	file, err := os.CreateTemp("", prefix+"-*.kubeconfig")
+	if err != nil {
+		return "", nil, err
+	}
+	remove := func() {
+		os.Remove(file.Name())
+	}
+	_, err = file.Write(kubeconfig)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		remove()
+		return "", nil, err
+	}
+	return file.Name(), remove, nil
+}
+
+// getClusterKubeconfigPath returns the path of the admin kubeconfig of a
+// standalone cluster, saved with its state
+func getClusterKubeconfigPath(clusterName string) (string, error) {
+	stateDir, err := getStateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, clusterName+".kubeconfig"), nil
+}
+
+// saveClusterKubeconfig saves the admin kubeconfig of a standalone cluster,
+// read from its Cluster API kubeconfig secret, for the plugin to reach the
+// Cluster API store of the cluster. It is only readable by the user.
+func saveClusterKubeconfig(clusterName string, kubeconfig []byte) error {
+	path, err := getClusterKubeconfigPath(clusterName)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	log.Infof("Saving kubeconfig of standalone cluster at '%v'", path)
+	return os.WriteFile(path, kubeconfig, 0600)
+}
+
+// loadClusterKubeconfig reads the saved admin kubeconfig of a standalone
+// cluster. The kubeconfig of clusters created by previous versions of the
+// plugin was not saved.
+func loadClusterKubeconfig(clusterName string) ([]byte, error) {
+	path, err := getClusterKubeconfigPath(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	kubeconfig, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: standalone cluster %s was created by a previous version of the plugin", errClusterKubeconfigNotFound, clusterName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read kubeconfig of standalone cluster: %v", err)
+	}
+	return kubeconfig, nil
+}
+
+// listClusterObjects returns the objects of a kind labelled with the name of a
+// Cluster API cluster
+func listClusterObjects(ctx context.Context, client crtclient.Client, listGVK schema.GroupVersionKind, clusterName string) ([]unstructured.Unstructured, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(listGVK)
+	if err := client.List(ctx, list, crtclient.MatchingLabels{clusterNameLabel: clusterName}); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// rolledOut returns whether the machines of a machine deployment or of a
+// control plane are all updated to its latest specification and ready
+func rolledOut(object *unstructured.Unstructured) bool {
+	replicas, _, _ := unstructured.NestedInt64(object.Object, "spec", "replicas")
+	observedGeneration, _, _ := unstructured.NestedInt64(object.Object, "status", "observedGeneration")
+	if observedGeneration < object.GetGeneration() {
+		return false
+	}
+	for _, field := range []string{"replicas", "updatedReplicas", "readyReplicas"} {
+		if value, _, _ := unstructured.NestedInt64(object.Object, "status", field); value != replicas {
+			return false
+		}
+	}
+	return true
+}
+
+// waitForRollout waits for the machines of the machine deployments or of the
+// control plane of a cluster to be rolled out
+func waitForRollout(ctx context.Context, client crtclient.Client, listGVK schema.GroupVersionKind, clusterName string, timeout time.Duration) error {
+	return wait.PollImmediate(rolloutPollInterval, timeout, func() (bool, error) {
+		objects, err := listClusterObjects(ctx, client, listGVK, clusterName)
+		if err != nil {
+			log.V(3).Infof("could not check the rollout of cluster %s: %v", clusterName, err)
+			return false, nil
+		}
+		for i := range objects {
+			if !rolledOut(&objects[i]) {
+				return false, nil
+			}
+		}
+		return len(objects) > 0, nil
+	})
+}
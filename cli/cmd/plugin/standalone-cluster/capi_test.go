@@ -0,0 +1,280 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	crtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newFakeClient returns a client of a fake API server holding objects. The
+// kinds of the objects of the Cluster API providers are served unstructured.
+func newFakeClient(t *testing.T, objects ...*unstructured.Unstructured) crtclient.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	for _, listGVK := range []schema.GroupVersionKind{
+		crdListGVK,
+		providerListGVK,
+		capiClusterListGVK,
+		machineDeploymentListGVK,
+		kubeadmControlPlaneListGVK,
+		schema.FromAPIVersionAndKind(dockerMachineTemplateAPIVersion, "DockerMachineTemplateList"),
+	} {
+		scheme.AddKnownTypeWithName(listGVK, &unstructured.UnstructuredList{})
+		scheme.AddKnownTypeWithName(listGVK.GroupVersion().WithKind(listGVK.Kind[:len(listGVK.Kind)-len("List")]), &unstructured.Unstructured{})
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme)
+	for _, object := range objects {
+		if err := client.Create(context.Background(), object.DeepCopy()); err != nil {
+			t.Fatalf("cannot create %s %s: %v", object.GetKind(), object.GetName(), err)
+		}
+	}
+	return client
+}
+
+func newObject(gvk schema.GroupVersionKind, namespace, name string, content map[string]interface{}) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{Object: content}
+	if object.Object == nil {
+		object.Object = map[string]interface{}{}
+	}
+	object.SetGroupVersionKind(gvk)
+	object.SetNamespace(namespace)
+	object.SetName(name)
+	return object
+}
+
+func newCRD(name, group string, labels map[string]string) *unstructured.Unstructured {
+	crd := newObject(crdListGVK.GroupVersion().WithKind("CustomResourceDefinition"), "", name, map[string]interface{}{
+		"spec": map[string]interface{}{
+			"group": group,
+			"scope": "Namespaced",
+			"names": map[string]interface{}{"kind": "Machine", "plural": "machines"},
+			"conversion": map[string]interface{}{
+				"strategy": "Webhook",
+			},
+			"versions": []interface{}{
+				map[string]interface{}{"name": "v1alpha2", "served": true, "storage": false},
+				map[string]interface{}{
+					"name":         "v1alpha3",
+					"served":       true,
+					"storage":      true,
+					"subresources": map[string]interface{}{"status": map[string]interface{}{}},
+					"schema":       map[string]interface{}{"openAPIV3Schema": map[string]interface{}{"type": "object"}},
+				},
+			},
+		},
+	})
+	crd.SetLabels(labels)
+	return crd
+}
+
+func TestStoreCRD(t *testing.T) {
+	crd := newCRD("machines.cluster.x-k8s.io", "cluster.x-k8s.io", map[string]string{clusterctlLabel: ""})
+
+	store, err := storeCRD(crd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, _, _ := unstructured.NestedSlice(store.Object, "spec", "versions")
+	if len(versions) != 1 {
+		t.Fatalf("expected the storage version only, got %v", versions)
+	}
+	version := versions[0].(map[string]interface{})
+	if version["name"] != "v1alpha3" {
+		t.Errorf("expected version v1alpha3, got %v", version["name"])
+	}
+	if _, found := version["subresources"]; found {
+		t.Errorf("expected no subresources, got %v", version["subresources"])
+	}
+	if _, found := version["schema"]; !found {
+		t.Errorf("expected the schema of the version to be kept")
+	}
+	if strategy, _, _ := unstructured.NestedString(store.Object, "spec", "conversion", "strategy"); strategy != "None" {
+		t.Errorf("expected no conversion, got %q", strategy)
+	}
+	labels := store.GetLabels()
+	if _, ok := labels[clusterctlLabel]; !ok || labels[clusterAPIStoreLabel] != "true" {
+		t.Errorf("expected the clusterctl and store labels, got %v", labels)
+	}
+
+	// the CRD of the provider is left as it is
+	if versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions"); len(versions) != 2 {
+		t.Errorf("expected the CRD of the provider to be unchanged, got %v", versions)
+	}
+}
+
+func TestStoreCRDWithoutStorageVersion(t *testing.T) {
+	crd := newCRD("machines.cluster.x-k8s.io", "cluster.x-k8s.io", nil)
+	unstructured.RemoveNestedField(crd.Object, "spec", "versions")
+
+	if _, err := storeCRD(crd); err == nil {
+		t.Fatal("expected an error for a CRD without storage version")
+	}
+}
+
+func TestApplyStoreCRDs(t *testing.T) {
+	from := newFakeClient(t,
+		newCRD("machines.cluster.x-k8s.io", "cluster.x-k8s.io", map[string]string{clusterctlLabel: ""}),
+		newCRD("providers.clusterctl.cluster.x-k8s.io", clusterctlGroup, map[string]string{clusterctlLabel + "/core": "inventory"}),
+		newCRD("certificates.cert-manager.io", "cert-manager.io", nil),
+	)
+	to := newFakeClient(t)
+
+	names, err := applyStoreCRDs(context.Background(), from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] == "certificates.cert-manager.io" || names[1] == "certificates.cert-manager.io" {
+		t.Fatalf("expected the CRDs of the providers and their inventory, got %v", names)
+	}
+
+	// applying the store again updates it
+	if _, err = applyStoreCRDs(context.Background(), from, to); err != nil {
+		t.Fatal(err)
+	}
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(crdListGVK)
+	if err = to.List(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 2 {
+		t.Fatalf("expected 2 CRDs in the store, got %d", len(list.Items))
+	}
+	for i := range list.Items {
+		if list.Items[i].GetLabels()[clusterAPIStoreLabel] != "true" {
+			t.Errorf("expected CRD %s to be labelled as part of the store", list.Items[i].GetName())
+		}
+	}
+}
+
+func TestCopyProviderInventory(t *testing.T) {
+	provider := newObject(providerListGVK.GroupVersion().WithKind("Provider"), "capi-system", "cluster-api", map[string]interface{}{
+		"providerName": "cluster-api",
+		"type":         "CoreProvider",
+		"version":      "v0.3.23",
+	})
+	from := newFakeClient(t, provider)
+	to := newFakeClient(t)
+
+	if err := copyProviderInventory(context.Background(), from, to); err != nil {
+		t.Fatal(err)
+	}
+	// copying the inventory again updates it
+	if err := copyProviderInventory(context.Background(), from, to); err != nil {
+		t.Fatal(err)
+	}
+
+	copied := &unstructured.Unstructured{}
+	copied.SetGroupVersionKind(provider.GroupVersionKind())
+	if err := to.Get(context.Background(), crtclient.ObjectKey{Namespace: "capi-system", Name: "cluster-api"}, copied); err != nil {
+		t.Fatal(err)
+	}
+	if version, _, _ := unstructured.NestedString(copied.Object, "version"); version != "v0.3.23" {
+		t.Errorf("expected provider version v0.3.23, got %q", version)
+	}
+}
+
+func TestCRDEstablished(t *testing.T) {
+	crd := newCRD("machines.cluster.x-k8s.io", "cluster.x-k8s.io", nil)
+	if crdEstablished(crd) {
+		t.Error("expected a CRD without status not to be established")
+	}
+
+	err := unstructured.SetNestedSlice(crd.Object, []interface{}{
+		map[string]interface{}{"type": "NamesAccepted", "status": "True"},
+		map[string]interface{}{"type": "Established", "status": "True"},
+	}, "status", "conditions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !crdEstablished(crd) {
+		t.Error("expected the CRD to be established")
+	}
+}
+
+func TestRolledOut(t *testing.T) {
+	tests := []struct {
+		name   string
+		status map[string]interface{}
+		want   bool
+	}{
+		{"updated and ready", map[string]interface{}{"replicas": int64(3), "updatedReplicas": int64(3), "readyReplicas": int64(3), "observedGeneration": int64(2)}, true},
+		{"not ready", map[string]interface{}{"replicas": int64(3), "updatedReplicas": int64(3), "readyReplicas": int64(2), "observedGeneration": int64(2)}, false},
+		{"not updated", map[string]interface{}{"replicas": int64(3), "updatedReplicas": int64(1), "readyReplicas": int64(3), "observedGeneration": int64(2)}, false},
+		{"not observed", map[string]interface{}{"replicas": int64(3), "updatedReplicas": int64(3), "readyReplicas": int64(3), "observedGeneration": int64(1)}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			object := newObject(machineDeploymentListGVK.GroupVersion().WithKind("MachineDeployment"), "default", "md-0", map[string]interface{}{
+				"spec":   map[string]interface{}{"replicas": int64(3)},
+				"status": test.status,
+			})
+			object.SetGeneration(2)
+			if got := rolledOut(object); got != test.want {
+				t.Errorf("expected rolled out %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestClusterKubeconfigLifecycle(t *testing.T) {
+	setTestHome(t)
+
+	if _, err := loadClusterKubeconfig("test"); err == nil {
+		t.Fatal("expected an error for a cluster without saved kubeconfig")
+	}
+
+	if err := saveClusterKubeconfig("test", []byte("kubeconfig")); err != nil {
+		t.Fatal(err)
+	}
+	kubeconfig, err := loadClusterKubeconfig("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(kubeconfig) != "kubeconfig" {
+		t.Errorf("expected the saved kubeconfig, got %q", kubeconfig)
+	}
+
+	path, err := getClusterKubeconfigPath("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected the kubeconfig to be only readable by the user, got %v", info.Mode().Perm())
+	}
+}
+
+// setTestHome sets the home directory, holding the Tanzu configuration
+// directory, to a temporary directory for the duration of a test
+func setTestHome(t *testing.T) {
+	t.Helper()
+	home, ok := os.LookupEnv("HOME")
+	if err := os.Setenv("HOME", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv("HOME", home)
+		} else {
+			os.Unsetenv("HOME")
+		}
+	})
+}
@@ -0,0 +1,164 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/kind/pkg/cluster"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+const (
+	defaultCleanupTimeout = 30 * time.Minute
+
+	// cleanupPollInterval is the interval between checks of the deletion of
+	// the Cluster API clusters of a bootstrap cluster
+	cleanupPollInterval = 10 * time.Second
+)
+
+type cleanupStandaloneOptions struct {
+	timeout time.Duration
+}
+
+// CleanupCmd cleans up the failed creation of a standalone cluster.
+var CleanupCmd = &cobra.Command{
+	Use:   "cleanup <cluster name>",
+	Short: "clean up the bootstrap cluster and partial infrastructure left by a failed standalone cluster creation",
+	Args:  cobra.ExactArgs(1),
+	RunE:  cleanup,
+}
+
+var cso = cleanupStandaloneOptions{}
+
+func init() {
+	CleanupCmd.Flags().DurationVarP(&cso.timeout, "timeout", "t", defaultCleanupTimeout, "Time duration to wait for the partial infrastructure of the cluster to be deleted")
+}
+
+func cleanup(cmd *cobra.Command, args []string) error {
+	clusterName := args[0]
+
+	state, err := loadStandaloneClusterState(clusterName)
+	switch {
+	case errors.Is(err, errStandaloneClusterNotFound):
+		// the creation may have failed before its state was saved
+		state = nil
+	case err != nil:
+		return NonUsageError(cmd, err, "unable to load standalone cluster %s", clusterName)
+	case state.created():
+		return fmt.Errorf("standalone cluster %s was created: use 'tanzu standalone-cluster delete %s' to delete it", clusterName, clusterName)
+	}
+
+	prov := newKindProvider()
+	bootstrapClusters, err := findOrphanedBootstrapClusters(prov, clusterName, state)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to find bootstrap clusters of standalone cluster %s", clusterName)
+	}
+
+	for _, bootstrapCluster := range bootstrapClusters {
+		err = cleanupBootstrapCluster(prov, bootstrapCluster, clusterName)
+		if err != nil {
+			return NonUsageError(cmd, err, "unable to clean up bootstrap cluster %s", bootstrapCluster)
+		}
+	}
+
+	if len(bootstrapClusters) == 0 {
+		log.Warningf("no bootstrap cluster found for standalone cluster %s: infrastructure created by a failed creation, if any, must be removed from the infrastructure provider", clusterName)
+	}
+
+	err = removeStandaloneClusterConfig(clusterName)
+	if err != nil {
+		return Error(err, "could not remove temorary standalone cluster config")
+	}
+
+	err = removeStandaloneClusterState(clusterName)
+	if err != nil {
+		return Error(err, "could not remove standalone cluster state")
+	}
+
+	return nil
+}
+
+// findOrphanedBootstrapClusters returns the bootstrap cluster recorded by the
+// state of a failed creation, and the bootstrap clusters holding a Cluster API
+// cluster of the same name
+func findOrphanedBootstrapClusters(prov *cluster.Provider, clusterName string, state *standaloneClusterState) ([]string, error) {
+	bootstrapClusters, err := listBootstrapClusters(prov)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphaned []string
+	for _, bootstrapCluster := range bootstrapClusters {
+		if state != nil && state.BootstrapCluster == bootstrapCluster {
+			orphaned = append(orphaned, bootstrapCluster)
+			continue
+		}
+
+		client, err := newBootstrapClusterClient(prov, bootstrapCluster)
+		if err != nil {
+			log.Warningf("skipping bootstrap cluster %s: %v", bootstrapCluster, err)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), clusterStatusTimeout)
+		clusters, err := findClusterAPIClusters(ctx, client, clusterName)
+		cancel()
+		if err != nil {
+			log.Warningf("skipping bootstrap cluster %s: %v", bootstrapCluster, err)
+			continue
+		}
+		if len(clusters) > 0 {
+			orphaned = append(orphaned, bootstrapCluster)
+		}
+	}
+	return orphaned, nil
+}
+
+// cleanupBootstrapCluster deletes the Cluster API clusters of a bootstrap
+// cluster named clusterName, for Cluster API to delete their infrastructure,
+// then deletes the bootstrap cluster. The bootstrap cluster is kept when its
+// Cluster API clusters are not deleted in time.
+func cleanupBootstrapCluster(prov *cluster.Provider, bootstrapCluster, clusterName string) error {
+	client, err := newBootstrapClusterClient(prov, bootstrapCluster)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cso.timeout)
+	defer cancel()
+
+	clusters, err := findClusterAPIClusters(ctx, client, clusterName)
+	if err != nil {
+		return err
+	}
+	for i := range clusters {
+		log.Infof("Deleting cluster %s/%s and its infrastructure from bootstrap cluster %s", clusters[i].GetNamespace(), clusters[i].GetName(), bootstrapCluster)
+		if err := client.Delete(ctx, &clusters[i]); err != nil {
+			return fmt.Errorf("cannot delete cluster %s/%s: %v", clusters[i].GetNamespace(), clusters[i].GetName(), err)
+		}
+	}
+
+	if len(clusters) > 0 {
+		err = wait.PollImmediate(cleanupPollInterval, cso.timeout, func() (bool, error) {
+			remaining, findErr := findClusterAPIClusters(ctx, client, clusterName)
+			if findErr != nil {
+				log.Warningf("could not check the deletion of cluster %s: %v", clusterName, findErr)
+				return false, nil
+			}
+			return len(remaining) == 0, nil
+		})
+		if err != nil {
+			return fmt.Errorf("cluster %s was not deleted: bootstrap cluster %s is kept to complete the deletion: %v", clusterName, bootstrapCluster, err)
+		}
+	}
+
+	log.Infof("Deleting bootstrap cluster %s", bootstrapCluster)
+	return prov.Delete(bootstrapCluster, "")
+}
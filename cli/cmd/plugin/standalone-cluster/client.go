@@ -0,0 +1,67 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/client"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/clientcreator"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/clusterclient"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/constants"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/tkgctl"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/types"
+)
+
+// standaloneClient is the part of the Tanzu Framework client creating and
+// deleting standalone clusters.
+type standaloneClient interface {
+	InitStandalone(options tkgctl.InitRegionOptions) error
+	DeleteStandalone(options tkgctl.DeleteRegionOptions) error
+}
+
+// newStandaloneClient returns a Tanzu Framework client. It is replaced by a
+// fake in the plugin built for the CLI tests, see client_fake.go.
+var newStandaloneClient = func(options tkgctl.Options) (standaloneClient, error) {
+	return tkgctl.New(options)
+}
+
+// tkgClient is the part of the Tanzu Framework client preparing the bootstrap
+// cluster of a management or standalone cluster: it renders the Cluster API
+// manifests of the cluster, installs the Cluster API providers and moves the
+// Cluster API objects of the cluster with clusterctl.
+type tkgClient interface {
+	ConfigureAndValidateManagementClusterConfiguration(options *client.InitRegionOptions, skipValidation bool) *client.ValidationError
+	BuildRegionalClusterConfiguration(options *client.InitRegionOptions) ([]byte, string, error)
+	InitializeProviders(options *client.InitRegionOptions, clusterClient clusterclient.Client, kubeconfigPath string) error
+	MoveObjects(fromKubeconfigPath, toKubeconfigPath, namespace string) error
+}
+
+// newTKGClient returns a Tanzu Framework client reading the
+// configuration of the cluster from values, on top of the configuration of
+// the Tanzu config directory. It is replaced by a fake in the plugin built
+// for the CLI tests, see client_fake.go.
+var newTKGClient = func(configDir string, values map[string]string) (tkgClient, error) {
+	allClients, err := clientcreator.CreateAllClients(types.AppConfig{TKGConfigDir: configDir}, nil)
+	if err != nil {
+		return nil, err
+	}
+	readerWriter := allClients.ConfigClient.TKGConfigReaderWriter()
+	for key, value := range values {
+		readerWriter.Set(key, value)
+	}
+
+	return client.New(client.Options{
+		ClusterCtlClient:         allClients.ClusterCtlClient,
+		ReaderWriterConfigClient: allClients.ConfigClient,
+		RegionManager:            allClients.RegionManager,
+		TKGConfigDir:             configDir,
+		Timeout:                  constants.DefaultOperationTimeout,
+		FeaturesClient:           allClients.FeaturesClient,
+		TKGConfigProvidersClient: allClients.TKGConfigProvidersClient,
+		TKGBomClient:             allClients.TKGBomClient,
+		TKGConfigUpdater:         allClients.TKGConfigUpdaterClient,
+		TKGPathsClient:           allClients.TKGConfigPathsClient,
+		ClusterClientFactory:     clusterclient.NewClusterClientFactory(),
+		FeatureFlagClient:        allClients.FeatureFlagClient,
+	})
+}
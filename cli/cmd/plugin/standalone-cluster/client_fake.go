@@ -0,0 +1,196 @@
+//go:build clitest
+// +build clitest
+
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	crtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/client"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/clusterclient"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/constants"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/tkgctl"
+)
+
+// fakeFailureEnv is the environment variable holding the error the fake
+// client fails its operations with
+const fakeFailureEnv = "STANDALONE_CLUSTER_FAKE_FAILURE"
+
+func init() {
+	newStandaloneClient = func(options tkgctl.Options) (standaloneClient, error) {
+		return &fakeStandaloneClient{}, nil
+	}
+	newTKGClient = func(configDir string, values map[string]string) (tkgClient, error) {
+		return &fakeTKGClient{values: values}, nil
+	}
+	newBootstrapCluster = func(state *standaloneClusterState) (bootstrapCluster, error) {
+		log.Infof("Creating bootstrap cluster %s", fakeBootstrapClusterName)
+		return &fakeBootstrapCluster{}, nil
+	}
+	findBootstrapCluster = func(name string) (bootstrapCluster, error) {
+		return &fakeBootstrapCluster{}, nil
+	}
+}
+
+// fakeStandaloneClient creates and deletes standalone clusters without any
+// infrastructure, for the CLI tests to run without Docker.
+type fakeStandaloneClient struct{}
+
+// InitStandalone writes the cluster configuration Tanzu Framework generates
+// while creating a cluster.
+func (c *fakeStandaloneClient) InitStandalone(options tkgctl.InitRegionOptions) error {
+	if message := os.Getenv(fakeFailureEnv); message != "" {
+		return errors.New(message)
+	}
+	log.Infof("Setting up bootstrapper...")
+
+	data := []byte{}
+	if options.ClusterConfigFile != "" {
+		var err error
+		data, err = os.ReadFile(options.ClusterConfigFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	path, err := getGeneratedClusterConfigPath(options.ClusterName)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, constants.ConfigFilePermissions)
+}
+
+// DeleteStandalone checks the cluster configuration passed by the plugin
+// exists, as Tanzu Framework reads it to delete the cluster.
+func (c *fakeStandaloneClient) DeleteStandalone(options tkgctl.DeleteRegionOptions) error {
+	if message := os.Getenv(fakeFailureEnv); message != "" {
+		return errors.New(message)
+	}
+	log.Infof("Deleting standalone cluster...")
+
+	if options.ClusterConfig == "" {
+		return nil
+	}
+	if _, err := os.Stat(options.ClusterConfig); err != nil {
+		return fmt.Errorf("cannot read cluster config of standalone cluster %s: %v", options.ClusterName, err)
+	}
+	return nil
+}
+
+// fakeTKGClient renders a minimal cluster template, for the CLI tests to run
+// without the providers downloaded by Tanzu Framework.
+type fakeTKGClient struct {
+	values map[string]string
+}
+
+// ConfigureAndValidateManagementClusterConfiguration accepts any configuration.
+func (c *fakeTKGClient) ConfigureAndValidateManagementClusterConfiguration(options *client.InitRegionOptions, skipValidation bool) *client.ValidationError {
+	return nil
+}
+
+// BuildRegionalClusterConfiguration renders a cluster and a secret holding the
+// password of the configuration, when there is one.
+func (c *fakeTKGClient) BuildRegionalClusterConfiguration(options *client.InitRegionOptions) ([]byte, string, error) {
+	if message := os.Getenv(fakeFailureEnv); message != "" {
+		return nil, "", errors.New(message)
+	}
+	manifests := fmt.Sprintf(`apiVersion: cluster.x-k8s.io/v1alpha3
+kind: Cluster
+metadata:
+  name: %s
+  namespace: tkg-system
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: %s
+  namespace: tkg-system
+stringData:
+  password: %q
+`, options.ClusterName, options.ClusterName, c.values["VSPHERE_PASSWORD"])
+	return []byte(manifests), "", nil
+}
+
+// InitializeProviders installs no provider.
+func (c *fakeTKGClient) InitializeProviders(options *client.InitRegionOptions, clusterClient clusterclient.Client, kubeconfigPath string) error {
+	return nil
+}
+
+// MoveObjects moves no object.
+func (c *fakeTKGClient) MoveObjects(fromKubeconfigPath, toKubeconfigPath, namespace string) error {
+	return nil
+}
+
+// fakeBootstrapClusterName is the name of the fake bootstrap clusters
+const fakeBootstrapClusterName = bootstrapClusterPrefix + "fake"
+
+// fakeBootstrapCluster is a bootstrap cluster without kind, holding no
+// Cluster API object.
+type fakeBootstrapCluster struct{}
+
+func (b *fakeBootstrapCluster) Name() string {
+	return fakeBootstrapClusterName
+}
+
+func (b *fakeBootstrapCluster) UseContext() (func(), error) {
+	return func() {}, nil
+}
+
+func (b *fakeBootstrapCluster) InitializeProviders(state *standaloneClusterState) error {
+	log.Infof("Installing providers on bootstrapper...")
+	return nil
+}
+
+// ClusterKubeconfig returns a kubeconfig of a cluster without API server.
+func (b *fakeBootstrapCluster) ClusterKubeconfig(clusterName string) ([]byte, error) {
+	return []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: %[1]s
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: %[1]s-admin@%[1]s
+  context:
+    cluster: %[1]s
+    user: %[1]s-admin
+current-context: %[1]s-admin@%[1]s
+users:
+- name: %[1]s-admin
+  user:
+    token: fake
+`, clusterName)), nil
+}
+
+func (b *fakeBootstrapCluster) MoveToCluster(state *standaloneClusterState, kubeconfig []byte) error {
+	log.Infof("Moving Cluster API objects to the cluster...")
+	return nil
+}
+
+func (b *fakeBootstrapCluster) MoveFromCluster(state *standaloneClusterState, kubeconfig []byte) error {
+	log.Infof("Moving Cluster API objects to the bootstrap cluster...")
+	return nil
+}
+
+// Client fails: the Cluster API providers do not reconcile the objects of the
+// fake bootstrap cluster.
+func (b *fakeBootstrapCluster) Client() (crtclient.Client, error) {
+	return nil, errors.New("the fake bootstrap cluster has no API server")
+}
+
+func (b *fakeBootstrapCluster) Delete() error {
+	return nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	crtclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	clusterConfigsDirName = "clusterconfigs"
+
+	clusterStatusRunning      = "running"
+	clusterStatusDegraded     = "degraded"
+	clusterStatusUnreachable  = "unreachable"
+	clusterStatusCreating     = "creating"
+	clusterStatusCreateFailed = "create-failed"
+
+	nodeRoleControlPlane = "control-plane"
+	nodeRoleWorker       = "worker"
+
+	// clusterStatusTimeout bounds the time spent querying a cluster for its status
+	clusterStatusTimeout = 10 * time.Second
+)
+
+// standaloneCluster describes a standalone cluster created from this machine,
+// as recorded by its state file, along with its current status.
+type standaloneCluster struct {
+	Name              string        `json:"name"`
+	Infrastructure    string        `json:"infrastructure"`
+	Plan              string        `json:"plan,omitempty"`
+	Context           string        `json:"context"`
+	KubernetesVersion string        `json:"kubernetesVersion,omitempty"`
+	ControlPlane      string        `json:"controlPlane"`
+	Workers           string        `json:"workers"`
+	Status            string        `json:"status"`
+	CreationTime      time.Time     `json:"creationTime"`
+	PluginVersion     string        `json:"pluginVersion,omitempty"`
+	StateFile         string        `json:"stateFile"`
+	Nodes             []clusterNode `json:"nodes,omitempty"`
+
+	config map[string]interface{}
+	// createStatus is the status of the creation of the cluster
+	createStatus string
+}
+
+// clusterNode is the status of a node of a standalone cluster
+type clusterNode struct {
+	Name    string `json:"name"`
+	Role    string `json:"role"`
+	Ready   bool   `json:"ready"`
+	Version string `json:"version"`
+}
+
+func getClusterConfigsDir() (string, error) {
+	configDir, err := getTKGConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, clusterConfigsDirName), nil
+}
+
+// loadStandaloneCluster reads the state of a standalone cluster
+func loadStandaloneCluster(clusterName string) (*standaloneCluster, error) {
+	state, err := loadStandaloneClusterState(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &standaloneCluster{
+		Name:              clusterName,
+		Infrastructure:    state.InfrastructureProvider,
+		Plan:              state.Plan,
+		Context:           fmt.Sprintf("%s-admin@%s", clusterName, clusterName),
+		KubernetesVersion: configValue(state.Config, "KUBERNETES_VERSION"),
+		CreationTime:      state.CreationTime,
+		PluginVersion:     state.PluginVersion,
+		StateFile:         state.path,
+		config:            state.Config,
+		createStatus:      state.Status,
+	}, nil
+}
+
+// configValue returns a value of a cluster configuration as a string
+func configValue(config map[string]interface{}, key string) string {
+	value, ok := config[key]
+	if !ok || value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// configValues returns the values of a cluster configuration as strings
+func configValues(config map[string]interface{}) map[string]string {
+	values := make(map[string]string, len(config))
+	for key := range config {
+		values[key] = configValue(config, key)
+	}
+	return values
+}
+
+// refreshStatus queries the nodes of the cluster, using its admin context of
+// the default kubeconfig, to compute its status
+func (c *standaloneCluster) refreshStatus() {
+	c.ControlPlane = fmt.Sprintf("-/%s", defaultIfEmpty(configValue(c.config, "CONTROL_PLANE_MACHINE_COUNT"), "1"))
+	c.Workers = fmt.Sprintf("-/%s", defaultIfEmpty(configValue(c.config, "WORKER_MACHINE_COUNT"), "1"))
+
+	switch c.createStatus {
+	case createStatusCreating:
+		c.Status = clusterStatusCreating
+		return
+	case createStatusFailed:
+		c.Status = clusterStatusCreateFailed
+		return
+	}
+
+	nodes, err := getClusterNodes(c.Context)
+	if err != nil {
+		c.Status = clusterStatusUnreachable
+		return
+	}
+	c.Nodes = nodes
+
+	var controlPlane, controlPlaneReady, workers, workersReady int
+	c.Status = clusterStatusRunning
+	for _, node := range nodes {
+		if !node.Ready {
+			c.Status = clusterStatusDegraded
+		}
+		if node.Role == nodeRoleControlPlane {
+			controlPlane++
+			if node.Ready {
+				controlPlaneReady++
+			}
+			c.KubernetesVersion = node.Version
+			continue
+		}
+		workers++
+		if node.Ready {
+			workersReady++
+		}
+	}
+
+	c.ControlPlane = fmt.Sprintf("%d/%d", controlPlaneReady, controlPlane)
+	c.Workers = fmt.Sprintf("%d/%d", workersReady, workers)
+}
+
+// getClusterNodes lists the nodes of the cluster of a context of the default kubeconfig
+func getClusterNodes(kubeContext string) ([]clusterNode, error) {
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+	).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Timeout = clusterStatusTimeout
+
+	client, err := crtclient.New(cfg, crtclient.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterStatusTimeout)
+	defer cancel()
+
+	nodeList := &corev1.NodeList{}
+	if err := client.List(ctx, nodeList); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]clusterNode, 0, len(nodeList.Items))
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		nodes = append(nodes, clusterNode{
+			Name:    node.Name,
+			Role:    nodeRole(node),
+			Ready:   nodeReady(node),
+			Version: node.Status.NodeInfo.KubeletVersion,
+		})
+	}
+	return nodes, nil
+}
+
+func nodeRole(node *corev1.Node) string {
+	for _, label := range []string{"node-role.kubernetes.io/control-plane", "node-role.kubernetes.io/master"} {
+		if _, ok := node.Labels[label]; ok {
+			return nodeRoleControlPlane
+		}
+	}
+	return nodeRoleWorker
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func defaultIfEmpty(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -26,6 +26,11 @@ type initStandaloneOptions struct {
 	bind                   string
 	browser                string
 	timeout                time.Duration
+	dryRun                 bool
+	outputFormat           string
+	resume                 string
+	outputEvents           string
+	skipPreflight          bool
 }
 
 // CreateCmd creates a standalone workload cluster.
@@ -45,16 +50,34 @@ func init() {
 	CreateCmd.Flags().StringVarP(&iso.infrastructureProvider, "infrastructure", "i", "", "Infrastructure to deploy the standalone cluster on. Only needed when using -i docker.")
 	CreateCmd.Flags().StringVarP(&iso.bind, "bind", "b", "127.0.0.1:8080", "Specify the IP and port to bind the Kickstart UI against (e.g. 127.0.0.1:8080).")
 	CreateCmd.Flags().StringVarP(&iso.browser, "browser", "", "", "Specify the browser to open the Kickstart UI on. Use 'none' for no browser. Defaults to OS default browser. Supported: ['chrome', 'firefox', 'safari', 'ie', 'edge', 'none']")
+	CreateCmd.Flags().BoolVarP(&iso.dryRun, "dry-run", "", false, "Validate the configuration and print the resolved standalone cluster specification without creating the cluster")
+	CreateCmd.Flags().StringVarP(&iso.outputFormat, "output", "o", "", "Output format of --dry-run (yaml|json)")
+	CreateCmd.Flags().StringVarP(&iso.outputEvents, "output-events", "", "", "Write the progress of the creation to stdout as newline-delimited events (json)")
+	CreateCmd.Flags().StringVarP(&iso.resume, "resume", "", "", "Resume the failed creation of a standalone cluster from its last completed phase")
+	CreateCmd.Flags().BoolVarP(&iso.skipPreflight, "skip-preflight", "", false, "Skip the checks of the resources of this machine before creating the cluster")
 	CreateCmd.Flags().DurationVarP(&iso.timeout, "timeout", "t", constants.DefaultLongRunningOperationTimeout, "Time duration to wait for an operation before timeout. Timeout duration in hours(h)/minutes(m)/seconds(s) units or as some combination of them (e.g. 2h, 30m, 2h30m10s)")
 }
 
 func create(cmd *cobra.Command, args []string) error {
-	fmt.Print("\n!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n")
-	fmt.Print("Warning - Standalone clusters will be deprecated in a future release of Tanzu Community Edition\n")
-	fmt.Print("                                   Use at your own Risk\n")
-	fmt.Print("           Checkout the proposal for the standalone cluster replacement:\n")
-	fmt.Print("           https://github.com/vmware-tanzu/community-edition/issues/2266\n")
-	fmt.Print("!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n\n")
+	// keep the output of a dry run and the progress events parsable
+	warningOut := os.Stdout
+	if iso.dryRun || iso.outputEvents != "" {
+		warningOut = os.Stderr
+	}
+	fmt.Fprint(warningOut, "\n!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n")
+	fmt.Fprint(warningOut, "Warning - Standalone clusters will be deprecated in a future release of Tanzu Community Edition\n")
+	fmt.Fprint(warningOut, "                                   Use at your own Risk\n")
+	fmt.Fprint(warningOut, "           Checkout the proposal for the standalone cluster replacement:\n")
+	fmt.Fprint(warningOut, "           https://github.com/vmware-tanzu/community-edition/issues/2266\n")
+	fmt.Fprint(warningOut, "!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n\n")
+
+	if err := validateEventsFormat(iso.outputEvents); err != nil {
+		return err
+	}
+
+	if iso.resume != "" {
+		return resume(cmd, iso.resume)
+	}
 
 	var clusterName string
 
@@ -65,10 +88,25 @@ func create(cmd *cobra.Command, args []string) error {
 		clusterName = args[0]
 	}
 
-	// create new client
-	c, err := newTKGCtlClient(false)
-	if err != nil {
-		return NonUsageError(cmd, err, "unable to create Tanzu Standalone Cluster client")
+	if iso.dryRun {
+		return dryRun(cmd, clusterName)
+	}
+
+	// check this machine before the bootstrap cluster is started
+	if clusterName != "" && !iso.skipPreflight {
+		if err := preflightCreate(cmd, clusterName); err != nil {
+			return err
+		}
+	}
+
+	// checkpoint the creation, for it to be resumed or cleaned up on failure
+	var state *standaloneClusterState
+	if clusterName != "" {
+		var err error
+		state, err = startStandaloneClusterCreation(clusterName, time.Now())
+		if err != nil {
+			return NonUsageError(cmd, err, "unable to create standalone cluster %s", clusterName)
+		}
 	}
 
 	// create a new standlone cluster
@@ -91,26 +129,155 @@ func create(cmd *cobra.Command, args []string) error {
 		initRegionOpts.InfrastructureProvider = iso.infrastructureProvider
 	}
 
-	err = c.InitStandalone(initRegionOpts)
+	return runWithEvents(cmd.OutOrStdout(), iso.outputEvents, operationCreate, clusterName, func() error {
+		// create new client
+		c, err := newTKGCtlClient(false)
+		if err != nil {
+			return NonUsageError(cmd, err, "unable to create Tanzu Standalone Cluster client")
+		}
+
+		err = initStandalone(c, initRegionOpts, state, nil)
+		if err != nil {
+			return Error(err, "failed to initialize standalone cluster.")
+		}
+
+		if state == nil {
+			log.Warningf("standalone cluster name unknown: the state of the cluster is not saved")
+			return nil
+		}
+
+		return runPhase(phaseSaveState, func() error {
+			if err := completeStandaloneClusterCreation(state); err != nil {
+				return Error(err, "failed to store standalone cluster state")
+			}
+			return nil
+		})
+	})
+}
+
+// startStandaloneClusterCreation saves the state of a cluster about to be
+// created. The creation of a cluster is refused when the cluster already
+// exists, or while a previous creation of the same cluster did not complete.
+func startStandaloneClusterCreation(clusterName string, creationTime time.Time) (*standaloneClusterState, error) {
+	previous, err := loadStandaloneClusterState(clusterName)
+	if err == nil && previous.created() {
+		return nil, fmt.Errorf("standalone cluster %s already exists: delete it with 'tanzu standalone-cluster delete %s' before creating it again",
+			clusterName, clusterName)
+	}
+	if err == nil {
+		return nil, fmt.Errorf("a previous creation of standalone cluster %s did not complete: resume it with 'tanzu standalone-cluster create --resume %s' or clean it up with 'tanzu standalone-cluster cleanup %s'",
+			clusterName, clusterName, clusterName)
+	}
+
+	state, err := newStandaloneClusterState(clusterName, &iso, creationTime)
 	if err != nil {
-		return Error(err, "failed to initialize standalone cluster.")
+		return nil, err
 	}
+	state.Status = createStatusCreating
+	state.Phase = createPhaseConfigured
 
-	err = saveStandaloneClusterConfig(clusterName, iso.clusterConfigFile)
+	err = saveStandaloneClusterState(state)
 	if err != nil {
-		return Error(err, "failed to store standalone bootstrap cluster config")
+		return nil, err
 	}
+	return state, nil
+}
 
+// initStandalone creates a standalone cluster. The bootstrap cluster is
+// created by the plugin, unless an existing one is passed, for Tanzu Framework
+// to leave it running: the Cluster API objects of the cluster are moved to the
+// cluster before it is deleted, to scale, upgrade or restore the cluster. When
+// the creation fails, the failure and the bootstrap cluster are recorded in
+// the state.
+func initStandalone(c standaloneClient, options tkgctl.InitRegionOptions, state *standaloneClusterState, bootstrap bootstrapCluster) error {
+	// the name of a cluster created from the UI is unknown
+	if state == nil {
+		return runPhase(phaseClusterCreation, func() error {
+			return c.InitStandalone(options)
+		})
+	}
+
+	if bootstrap == nil {
+		err := runPhase(phaseBootstrapCluster, func() error {
+			var err error
+			bootstrap, err = newBootstrapCluster(state)
+			return err
+		})
+		if err != nil {
+			return recordCreationFailure(state, err)
+		}
+		state.BootstrapCluster = bootstrap.Name()
+		state.Phase = createPhaseBootstrapCreated
+		if err = saveStandaloneClusterState(state); err != nil {
+			return err
+		}
+	}
+
+	removeContext, err := bootstrap.UseContext()
+	if err != nil {
+		return recordCreationFailure(state, err)
+	}
+	defer removeContext()
+	options.UseExistingCluster = true
+
+	err = runPhase(phaseClusterCreation, func() error {
+		return c.InitStandalone(options)
+	})
+	if err != nil {
+		return recordCreationFailure(state, err)
+	}
+
+	kubeconfig, err := bootstrap.ClusterKubeconfig(state.Name)
+	if err == nil {
+		err = saveClusterKubeconfig(state.Name, kubeconfig)
+	}
+	if err != nil {
+		log.Warningf("could not save the kubeconfig of standalone cluster %s: %v", state.Name, err)
+	}
+	releaseBootstrapCluster(bootstrap, state)
 	return nil
 }
 
-func newTKGCtlClient(forceUpdateTKGCompatibilityImage bool) (tkgctl.TKGClient, error) {
+// recordCreationFailure records the failure of the creation of a cluster in
+// its state, for the creation to be resumed or cleaned up
+func recordCreationFailure(state *standaloneClusterState, err error) error {
+	state.Status = createStatusFailed
+	state.Error = err.Error()
+	if saveErr := saveStandaloneClusterState(state); saveErr != nil {
+		log.Warningf("could not record the failure of the standalone cluster creation: %v", saveErr)
+		return err
+	}
+	log.Infof("Resume the creation with 'tanzu standalone-cluster create --resume %s', or clean it up with 'tanzu standalone-cluster cleanup %s'", state.Name, state.Name)
+	return err
+}
+
+// completeStandaloneClusterCreation records the creation of a cluster, along
+// with the configuration generated by Tanzu Framework while creating it
+func completeStandaloneClusterCreation(state *standaloneClusterState) error {
+	generatedConfigFile, err := getGeneratedClusterConfigPath(state.Name)
+	if err != nil {
+		return err
+	}
+	if _, statErr := os.Stat(generatedConfigFile); statErr == nil {
+		err = readClusterConfig(generatedConfigFile, state.Config)
+		if err != nil {
+			return err
+		}
+	}
+
+	state.Status = createStatusCreated
+	state.Phase = createPhaseCreated
+	state.Error = ""
+	return saveStandaloneClusterState(state)
+}
+
+func newTKGCtlClient(forceUpdateTKGCompatibilityImage bool) (standaloneClient, error) {
 	configDir, err := getTKGConfigDir()
 	if err != nil {
 		return nil, Error(err, "unable to determine Tanzu configuration directory.")
 	}
 
-	return tkgctl.New(tkgctl.Options{
+	return newStandaloneClient(tkgctl.Options{
 		ConfigDir: configDir,
 		CustomizerOptions: types.CustomizerOptions{
 			RegionManagerFactory: region.NewFactory(),
@@ -128,40 +295,3 @@ func getTKGConfigDir() (string, error) {
 	}
 	return filepath.Join(tanzuConfigDir, "tkg"), nil
 }
-
-func saveStandaloneClusterConfig(clusterName, clusterConfigPath string) error {
-	// If there is no cluster config provided
-	// assume CAPD and don't try to save anything
-	if clusterConfigPath == "" {
-		return nil
-	}
-
-	// Get config contents
-	clusterConfigBytes, err := os.ReadFile(clusterConfigPath)
-	if err != nil {
-		return fmt.Errorf("cannot read cluster config file: %v", err)
-	}
-
-	// Save the cluster configuration for future restore cycle
-	configDir, err := getTKGConfigDir()
-	if err != nil {
-		return err
-	}
-
-	clusterConfigDir := filepath.Join(configDir, "clusterconfigs")
-	err = os.MkdirAll(clusterConfigDir, 0755)
-	if err != nil {
-		return err
-	}
-
-	clusterConfigFile := clusterName + ".yaml"
-	writeConfigPath := filepath.Join(clusterConfigDir, clusterConfigFile)
-
-	log.Infof("Saving bootstrap cluster config for standalone cluster at '%v'", writeConfigPath)
-	err = os.WriteFile(writeConfigPath, clusterConfigBytes, constants.ConfigFilePermissions)
-	if err != nil {
-		return fmt.Errorf("cannot write cluster config file for standalone bootstrap cluster: %v", err)
-	}
-
-	return nil
-}
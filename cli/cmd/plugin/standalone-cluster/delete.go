@@ -4,6 +4,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -16,9 +17,10 @@ import (
 )
 
 type teardownStandaloneOptions struct {
-	force      bool
-	skip       bool
-	configFile string
+	force        bool
+	skip         bool
+	configFile   string
+	outputEvents string
 }
 
 // DeleteCmd deletes a standalone workload cluster.
@@ -40,15 +42,25 @@ func init() {
 	DeleteCmd.Flags().StringVarP(&tso.configFile, "config", "f", "", "Optional cluster configuration file. Defaults to config used during standalone-cluster create")
 	DeleteCmd.Flags().BoolVar(&tso.force, "force", false, "Force delete")
 	DeleteCmd.Flags().BoolVarP(&tso.skip, "yes", "y", false, "Delete workload cluster without asking for confirmation")
+	DeleteCmd.Flags().StringVarP(&tso.outputEvents, "output-events", "", "", "Write the progress of the deletion to stdout as newline-delimited events (json)")
 }
 
 func teardown(cmd *cobra.Command, args []string) error {
-	fmt.Print("\n!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n")
-	fmt.Print("Warning - Standalone clusters will be deprecated in a future release of Tanzu Community Edition\n")
-	fmt.Print("                                   Use at your own Risk\n")
-	fmt.Print("           Checkout the proposal for the standalone cluster replacement:\n")
-	fmt.Print("           https://github.com/vmware-tanzu/community-edition/issues/2266\n")
-	fmt.Print("!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n\n")
+	// keep the progress events parsable
+	warningOut := os.Stdout
+	if tso.outputEvents != "" {
+		warningOut = os.Stderr
+	}
+	fmt.Fprint(warningOut, "\n!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n")
+	fmt.Fprint(warningOut, "Warning - Standalone clusters will be deprecated in a future release of Tanzu Community Edition\n")
+	fmt.Fprint(warningOut, "                                   Use at your own Risk\n")
+	fmt.Fprint(warningOut, "           Checkout the proposal for the standalone cluster replacement:\n")
+	fmt.Fprint(warningOut, "           https://github.com/vmware-tanzu/community-edition/issues/2266\n")
+	fmt.Fprint(warningOut, "!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!\n\n")
+
+	if err := validateEventsFormat(tso.outputEvents); err != nil {
+		return err
+	}
 
 	// validate a cluster name was passed
 	if len(args) < 1 {
@@ -79,71 +91,94 @@ func teardown(cmd *cobra.Command, args []string) error {
 	}
 
 	if tso.configFile == "" {
-		clusterConfigPath, err := getStandaloneClusterConfig(clusterName)
+		clusterConfigPath, cleanup, err := getStandaloneClusterConfig(clusterName)
 		if err != nil {
 			return Error(err, "unable to load standalone cluster configuration")
 		}
+		defer cleanup()
 		tso.configFile = clusterConfigPath
 	}
 
-	// setup client options
-	opt := tkgctl.Options{
-		KubeConfig:        "",
-		KubeContext:       "",
-		ConfigDir:         configDir,
-		LogOptions:        tkgctl.LoggingOptions{Verbosity: logLevel, File: logFile},
-		ProviderGetter:    nil,
-		CustomizerOptions: types.CustomizerOptions{},
-		SettingsFile:      "",
-	}
+	return runWithEvents(cmd.OutOrStdout(), tso.outputEvents, operationDelete, clusterName, func() error {
+		// setup client options
+		opt := tkgctl.Options{
+			KubeConfig:        "",
+			KubeContext:       "",
+			ConfigDir:         configDir,
+			LogOptions:        tkgctl.LoggingOptions{Verbosity: logLevel, File: logFile},
+			ProviderGetter:    nil,
+			CustomizerOptions: types.CustomizerOptions{},
+			SettingsFile:      "",
+		}
 
-	// create new client
-	c, err := tkgctl.New(opt)
-	if err != nil {
-		fmt.Println(err.Error())
-	}
+		// create new client
+		c, clientErr := newStandaloneClient(opt)
+		if clientErr != nil {
+			return NonUsageError(cmd, clientErr, "unable to create Tanzu Standalone Cluster client")
+		}
 
-	// delete a new standlone cluster
-	teardownRegionOpts := tkgctl.DeleteRegionOptions{
-		ClusterName:   clusterName,
-		Force:         tso.force,
-		SkipPrompt:    tso.skip,
-		ClusterConfig: tso.configFile,
-	}
+		// delete a new standlone cluster
+		teardownRegionOpts := tkgctl.DeleteRegionOptions{
+			ClusterName:   clusterName,
+			Force:         tso.force,
+			SkipPrompt:    tso.skip,
+			ClusterConfig: tso.configFile,
+		}
 
-	err = c.DeleteStandalone(teardownRegionOpts)
-	if err != nil {
-		return Error(err, "standalone cluster deletion failed")
-	}
+		deleteErr := runPhase(phaseClusterDeletion, func() error {
+			return c.DeleteStandalone(teardownRegionOpts)
+		})
+		if deleteErr != nil {
+			return Error(deleteErr, "standalone cluster deletion failed")
+		}
 
-	err = removeStandaloneClusterConfig(clusterName)
-	if err != nil {
-		return Error(err, "could not remove temorary standalone cluster config")
-	}
+		return runPhase(phaseRemoveState, func() error {
+			if removeErr := removeStandaloneClusterConfig(clusterName); removeErr != nil {
+				return Error(removeErr, "could not remove temorary standalone cluster config")
+			}
 
-	return nil
+			deleteKeptBootstrapCluster(clusterName)
+
+			if removeErr := removeStandaloneClusterState(clusterName); removeErr != nil {
+				return Error(removeErr, "could not remove standalone cluster state")
+			}
+			return nil
+		})
+	})
 }
 
-func getStandaloneClusterConfig(clusterName string) (string, error) {
-	configDir, err := getTKGConfigDir()
-	if err != nil {
-		return "", err
+// deleteKeptBootstrapCluster deletes the bootstrap cluster kept to manage a
+// deleted cluster, when its Cluster API objects could not be moved to it
+func deleteKeptBootstrapCluster(clusterName string) {
+	state, err := loadStandaloneClusterState(clusterName)
+	if err != nil || !state.created() || state.BootstrapCluster == "" {
+		return
 	}
+	bootstrap, err := findBootstrapCluster(state.BootstrapCluster)
+	if err != nil || bootstrap == nil {
+		return
+	}
+	log.Infof("Deleting bootstrap cluster %s", bootstrap.Name())
+	if err = bootstrap.Delete(); err != nil {
+		log.Warningf("could not delete bootstrap cluster %s: %v", bootstrap.Name(), err)
+	}
+}
 
-	// fetch the expected cluster configuration for the restore cycle
-	clusterConfigDir := filepath.Join(configDir, "clusterconfigs")
-	clusterConfigFile := clusterName + ".yaml"
-	readConfigPath := filepath.Join(clusterConfigDir, clusterConfigFile)
-
-	log.Infof("Loading bootstrap cluster config for standalone cluster at '%v'", readConfigPath)
-
-	_, err = os.Stat(readConfigPath)
-	if os.IsNotExist(err) {
-		log.Infof("no bootstrap cluster config found - using default config")
-		return "", nil
+// getStandaloneClusterConfig returns a configuration file made of the
+// effective configuration recorded in the state of the cluster, and a
+// function removing the file
+func getStandaloneClusterConfig(clusterName string) (string, func(), error) {
+	state, err := loadStandaloneClusterState(clusterName)
+	if errors.Is(err, errStandaloneClusterNotFound) {
+		log.Infof("no standalone cluster state found - using default config")
+		return "", func() {}, nil
+	}
+	if err != nil {
+		return "", nil, err
 	}
 
-	return readConfigPath, nil
+	log.Infof("Loading bootstrap cluster config for standalone cluster from '%v'", state.path)
+	return state.writeClusterConfigFile()
 }
 
 func removeStandaloneClusterConfig(clusterName string) error {
@@ -0,0 +1,362 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/cli/component"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/client"
+)
+
+const (
+	defaultClusterCIDR = "100.96.0.0/11"
+	defaultServiceCIDR = "100.64.0.0/13"
+
+	redactedValue = "<redacted>"
+)
+
+var (
+	clusterNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+	// requiredConfigKeys are the configuration values an infrastructure provider
+	// cannot create a cluster without
+	requiredConfigKeys = map[string][]string{
+		"docker":  {},
+		"aws":     {"AWS_REGION", "AWS_NODE_AZ", "AWS_SSH_KEY_NAME"},
+		"azure":   {"AZURE_LOCATION", "AZURE_SUBSCRIPTION_ID", "AZURE_TENANT_ID", "AZURE_CLIENT_ID", "AZURE_SSH_PUBLIC_KEY_B64"},
+		"vsphere": {"VSPHERE_SERVER", "VSPHERE_DATACENTER", "VSPHERE_NETWORK", "VSPHERE_CONTROL_PLANE_ENDPOINT"},
+	}
+
+	// defaultMachineCounts are the control plane and worker counts of each plan
+	defaultMachineCounts = map[string][2]string{
+		"dev":  {"1", "1"},
+		"prod": {"3", "3"},
+	}
+
+	// secretConfigKeySuffixes identify the configuration values not printed by a dry run
+	secretConfigKeySuffixes = []string{"_PASSWORD", "_SECRET", "_SECRET_ACCESS_KEY", "_SESSION_TOKEN", "_B64ENCODED_CREDENTIALS"}
+)
+
+// standaloneClusterPlan is the resolved specification of a standalone cluster,
+// as printed by a dry run of the create command
+type standaloneClusterPlan struct {
+	Name                   string                 `json:"name"`
+	InfrastructureProvider string                 `json:"infrastructureProvider"`
+	Plan                   string                 `json:"plan"`
+	KubernetesVersion      string                 `json:"kubernetesVersion,omitempty"`
+	TKR                    string                 `json:"tkr,omitempty"`
+	Network                clusterNetworkPlan     `json:"network"`
+	ControlPlane           machinesPlan           `json:"controlPlane"`
+	Workers                machinesPlan           `json:"workers"`
+	Config                 map[string]interface{} `json:"config"`
+	// Manifests are the Cluster API objects applied to the bootstrap cluster
+	Manifests []map[string]interface{} `json:"manifests,omitempty"`
+}
+
+type clusterNetworkPlan struct {
+	ClusterCIDR          string `json:"clusterCIDR"`
+	ServiceCIDR          string `json:"serviceCIDR"`
+	ControlPlaneEndpoint string `json:"controlPlaneEndpoint,omitempty"`
+}
+
+type machinesPlan struct {
+	Count string `json:"count"`
+	Size  string `json:"size,omitempty"`
+}
+
+// dryRun validates the configuration of a standalone cluster and prints its
+// resolved specification, without creating a bootstrap cluster
+func dryRun(cmd *cobra.Command, clusterName string) error {
+	if iso.ui {
+		return fmt.Errorf("--dry-run cannot be used with --ui")
+	}
+	if clusterName == "" {
+		return fmt.Errorf("no cluster name specified")
+	}
+	switch component.OutputType(iso.outputFormat) {
+	case "", component.JSONOutputType, component.YAMLOutputType:
+	default:
+		return fmt.Errorf("unsupported output format %q: must be one of json or yaml", iso.outputFormat)
+	}
+
+	config, err := resolveClusterConfig(clusterName, &iso)
+	if err != nil {
+		return NonUsageError(cmd, err, "invalid standalone cluster configuration")
+	}
+	if err := validateClusterConfig(config); err != nil {
+		return NonUsageError(cmd, err, "invalid standalone cluster configuration")
+	}
+
+	plan := newStandaloneClusterPlan(config)
+	plan.Manifests, err = renderClusterManifests(config)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to render the Cluster API manifests of standalone cluster %s", clusterName)
+	}
+
+	if component.OutputType(iso.outputFormat) == component.JSONOutputType {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(plan)
+	} else {
+		var data []byte
+		if data, err = yaml.Marshal(plan); err == nil {
+			fmt.Fprint(cmd.OutOrStdout(), string(data))
+		}
+	}
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to render standalone cluster %s", clusterName)
+	}
+	return nil
+}
+
+// renderClusterManifests renders the Cluster API manifests of a cluster from
+// its resolved configuration, with the cluster templates of the providers
+// downloaded by Tanzu Framework. The data of secrets is redacted.
+func renderClusterManifests(config map[string]interface{}) ([]map[string]interface{}, error) {
+	configDir, err := getTKGConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	c, err := newTKGClient(configDir, configValues(config))
+	if err != nil {
+		return nil, err
+	}
+
+	options := &client.InitRegionOptions{
+		ClusterName:            configValue(config, "CLUSTER_NAME"),
+		Plan:                   configValue(config, "CLUSTER_PLAN"),
+		InfrastructureProvider: configValue(config, "INFRASTRUCTURE_PROVIDER"),
+		CniType:                configValue(config, "CNI"),
+		Edition:                BuildEdition,
+	}
+	// the infrastructure is not reached by a dry run, the configuration is
+	// only defaulted
+	if validationErr := c.ConfigureAndValidateManagementClusterConfiguration(options, true); validationErr != nil {
+		return nil, validationErr
+	}
+	data, _, err := c.BuildRegionalClusterConfiguration(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []map[string]interface{}
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		manifest := map[string]interface{}{}
+		if err = decoder.Decode(&manifest); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(manifest) == 0 {
+			continue
+		}
+		manifests = append(manifests, redactManifest(manifest))
+	}
+	return manifests, nil
+}
+
+// redactManifest redacts the data of a manifest of a secret
+func redactManifest(manifest map[string]interface{}) map[string]interface{} {
+	if manifest["kind"] != "Secret" {
+		return manifest
+	}
+	for _, field := range []string{"data", "stringData"} {
+		data, ok := manifest[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key := range data {
+			data[key] = redactedValue
+		}
+	}
+	return manifest
+}
+
+// validateClusterConfig checks the resolved configuration of a cluster,
+// reporting every invalid value at once
+func validateClusterConfig(config map[string]interface{}) error {
+	var problems []string
+
+	if name := configValue(config, "CLUSTER_NAME"); !clusterNameRegexp.MatchString(name) {
+		problems = append(problems, fmt.Sprintf("CLUSTER_NAME %q must consist of lower case alphanumeric characters or '-'", name))
+	}
+
+	problems = append(problems, validateProviderConfig(config)...)
+
+	if plan := configValue(config, "CLUSTER_PLAN"); !isSupportedPlan(plan) {
+		problems = append(problems, fmt.Sprintf("CLUSTER_PLAN %q is not supported, expected dev or prod", plan))
+	}
+
+	for _, key := range []string{"CLUSTER_CIDR", "SERVICE_CIDR"} {
+		if value := configValue(config, key); value != "" {
+			if _, _, err := net.ParseCIDR(value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s %q is not a valid CIDR", key, value))
+			}
+		}
+	}
+
+	for _, key := range []string{"CONTROL_PLANE_MACHINE_COUNT", "WORKER_MACHINE_COUNT"} {
+		if value := configValue(config, key); value != "" {
+			if count, err := strconv.Atoi(value); err != nil || count < 1 {
+				problems = append(problems, fmt.Sprintf("%s %q is not a positive number", key, value))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateProviderConfig checks the configuration values required by the
+// infrastructure provider of a cluster
+func validateProviderConfig(config map[string]interface{}) []string {
+	provider := configValue(config, "INFRASTRUCTURE_PROVIDER")
+	required, ok := requiredConfigKeys[provider]
+	if !ok {
+		return []string{fmt.Sprintf("INFRASTRUCTURE_PROVIDER %q is not supported, expected one of %s", provider, strings.Join(supportedProviders(), ", "))}
+	}
+
+	var problems []string
+	for _, key := range required {
+		if configValue(config, key) == "" {
+			problems = append(problems, fmt.Sprintf("%s is required by the %s infrastructure provider", key, provider))
+		}
+	}
+	return problems
+}
+
+func isSupportedPlan(plan string) bool {
+	_, ok := defaultMachineCounts[plan]
+	return ok
+}
+
+func supportedProviders() []string {
+	providers := make([]string, 0, len(requiredConfigKeys))
+	for provider := range requiredConfigKeys {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+func newStandaloneClusterPlan(config map[string]interface{}) *standaloneClusterPlan {
+	provider := configValue(config, "INFRASTRUCTURE_PROVIDER")
+	counts := defaultMachineCounts[configValue(config, "CLUSTER_PLAN")]
+
+	plan := &standaloneClusterPlan{
+		Name:                   configValue(config, "CLUSTER_NAME"),
+		InfrastructureProvider: provider,
+		Plan:                   configValue(config, "CLUSTER_PLAN"),
+		KubernetesVersion:      configValue(config, "KUBERNETES_VERSION"),
+		Network: clusterNetworkPlan{
+			ClusterCIDR:          defaultIfEmpty(configValue(config, "CLUSTER_CIDR"), defaultClusterCIDR),
+			ServiceCIDR:          defaultIfEmpty(configValue(config, "SERVICE_CIDR"), defaultServiceCIDR),
+			ControlPlaneEndpoint: configValue(config, "VSPHERE_CONTROL_PLANE_ENDPOINT"),
+		},
+		ControlPlane: machinesPlan{
+			Count: defaultIfEmpty(configValue(config, "CONTROL_PLANE_MACHINE_COUNT"), counts[0]),
+			Size:  machineSize(config, provider, "CONTROL_PLANE"),
+		},
+		Workers: machinesPlan{
+			Count: defaultIfEmpty(configValue(config, "WORKER_MACHINE_COUNT"), counts[1]),
+			Size:  machineSize(config, provider, "WORKER"),
+		},
+		Config: redactClusterConfig(config),
+	}
+
+	if plan.KubernetesVersion == "" {
+		plan.KubernetesVersion = getDefaultKubernetesVersion()
+	}
+	if plan.KubernetesVersion != "" {
+		plan.TKR = strings.ReplaceAll(plan.KubernetesVersion, "+", "---")
+	}
+	return plan
+}
+
+// machineSize describes the machines of a role, control plane or worker, from
+// the provider specific configuration or the generic size of the machines
+func machineSize(config map[string]interface{}, provider, role string) string {
+	var size string
+	switch provider {
+	case "aws":
+		size = configValue(config, map[string]string{"CONTROL_PLANE": "CONTROL_PLANE_MACHINE_TYPE", "WORKER": "NODE_MACHINE_TYPE"}[role])
+	case "azure":
+		size = configValue(config, map[string]string{"CONTROL_PLANE": "AZURE_CONTROL_PLANE_MACHINE_TYPE", "WORKER": "AZURE_NODE_MACHINE_TYPE"}[role])
+	case "vsphere":
+		cpus := configValue(config, "VSPHERE_"+role+"_NUM_CPUS")
+		memory := configValue(config, "VSPHERE_"+role+"_MEM_MIB")
+		disk := configValue(config, "VSPHERE_"+role+"_DISK_GIB")
+		if cpus != "" || memory != "" || disk != "" {
+			size = fmt.Sprintf("%s CPU, %s MiB memory, %s GiB disk",
+				defaultIfEmpty(cpus, "-"), defaultIfEmpty(memory, "-"), defaultIfEmpty(disk, "-"))
+		}
+	}
+	if size != "" {
+		return size
+	}
+
+	genericKey := map[string]string{"CONTROL_PLANE": "CONTROLPLANE_SIZE", "WORKER": "WORKER_SIZE"}[role]
+	return defaultIfEmpty(configValue(config, genericKey), configValue(config, "SIZE"))
+}
+
+// getDefaultKubernetesVersion reads the default Kubernetes version of the
+// latest Tanzu Kubernetes Grid BoM downloaded by Tanzu Framework
+func getDefaultKubernetesVersion() string {
+	configDir, err := getTKGConfigDir()
+	if err != nil {
+		return ""
+	}
+	bom := latestBoM(filepath.Join(configDir, "bom"))
+	if bom == "" {
+		return ""
+	}
+
+	data, err := os.ReadFile(bom)
+	if err != nil {
+		return ""
+	}
+	content := struct {
+		Default struct {
+			K8sVersion string `json:"k8sVersion"`
+		} `json:"default"`
+	}{}
+	if err := yaml.Unmarshal(data, &content); err != nil {
+		return ""
+	}
+	return content.Default.K8sVersion
+}
+
+// redactClusterConfig returns a copy of the configuration without its secret values
+func redactClusterConfig(config map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(config))
+	for key, value := range config {
+		redacted[key] = value
+		for _, suffix := range secretConfigKeySuffixes {
+			if strings.HasSuffix(key, suffix) && configValue(config, key) != "" {
+				redacted[key] = redactedValue
+				break
+			}
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,81 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateClusterConfig(t *testing.T) {
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"CLUSTER_NAME":                "standalone",
+			"INFRASTRUCTURE_PROVIDER":     "docker",
+			"CLUSTER_PLAN":                "dev",
+			"CLUSTER_CIDR":                defaultClusterCIDR,
+			"SERVICE_CIDR":                defaultServiceCIDR,
+			"CONTROL_PLANE_MACHINE_COUNT": 1,
+			"WORKER_MACHINE_COUNT":        "3",
+		}
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		value    interface{}
+		problems []string
+	}{
+		{"valid", "", nil, nil},
+		{"invalid name", "CLUSTER_NAME", "Standalone_1", []string{"CLUSTER_NAME"}},
+		{"missing name", "CLUSTER_NAME", nil, []string{"CLUSTER_NAME"}},
+		{"unsupported provider", "INFRASTRUCTURE_PROVIDER", "openstack", []string{"INFRASTRUCTURE_PROVIDER", "aws, azure, docker, vsphere"}},
+		{"provider values missing", "INFRASTRUCTURE_PROVIDER", "aws", []string{"AWS_REGION", "AWS_NODE_AZ", "AWS_SSH_KEY_NAME"}},
+		{"unsupported plan", "CLUSTER_PLAN", "large", []string{"CLUSTER_PLAN"}},
+		{"invalid cluster CIDR", "CLUSTER_CIDR", "100.96.0.0", []string{"CLUSTER_CIDR"}},
+		{"invalid service CIDR", "SERVICE_CIDR", "services", []string{"SERVICE_CIDR"}},
+		{"no control plane", "CONTROL_PLANE_MACHINE_COUNT", 0, []string{"CONTROL_PLANE_MACHINE_COUNT"}},
+		{"invalid worker count", "WORKER_MACHINE_COUNT", "three", []string{"WORKER_MACHINE_COUNT"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := valid()
+			if test.key != "" {
+				config[test.key] = test.value
+			}
+
+			err := validateClusterConfig(config)
+			if len(test.problems) == 0 {
+				if err != nil {
+					t.Fatalf("expected a valid configuration, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error reporting %v", test.problems)
+			}
+			for _, problem := range test.problems {
+				if !strings.Contains(err.Error(), problem) {
+					t.Errorf("expected the error to report %s, got %v", problem, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateClusterConfigReportsAllProblems(t *testing.T) {
+	err := validateClusterConfig(map[string]interface{}{
+		"CLUSTER_NAME":            "standalone",
+		"INFRASTRUCTURE_PROVIDER": "vsphere",
+		"CLUSTER_PLAN":            "dev",
+		"VSPHERE_SERVER":          "vcenter.local",
+		"WORKER_MACHINE_COUNT":    "-1",
+	})
+	if err == nil {
+		t.Fatal("expected an error for an invalid configuration")
+	}
+	if problems := strings.Split(err.Error(), "; "); len(problems) != 4 {
+		t.Errorf("expected 4 problems, got %q", problems)
+	}
+}
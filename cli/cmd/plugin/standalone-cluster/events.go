@@ -0,0 +1,287 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	eventsFormatJSON = "json"
+
+	operationCreate = "create"
+	operationDelete = "delete"
+
+	eventStarted   = "started"
+	eventCompleted = "completed"
+	eventFailed    = "failed"
+
+	// logPollInterval is the interval between reads of the Tanzu Framework log file
+	logPollInterval = 500 * time.Millisecond
+)
+
+// progressEvent is a newline-delimited JSON event of the progress of a create
+// or delete operation. Events without phase are the start and end of the
+// operation itself. Best-effort events are the sub-phases of a phase run by
+// Tanzu Framework, detected from its log: they may be missed.
+type progressEvent struct {
+	Time       time.Time `json:"time"`
+	Operation  string    `json:"operation"`
+	Cluster    string    `json:"cluster"`
+	Phase      string    `json:"phase,omitempty"`
+	Status     string    `json:"status"`
+	BestEffort bool      `json:"bestEffort,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// phases of the operations, run by the plugin
+const (
+	phaseBootstrapCluster         = "bootstrap-cluster"
+	phaseClusterCreation          = "cluster-creation"
+	phaseMove                     = "move"
+	phaseBootstrapClusterDeletion = "bootstrap-cluster-deletion"
+	phaseSaveState                = "save-state"
+	phaseClusterDeletion          = "cluster-deletion"
+	phaseRemoveState              = "remove-state"
+)
+
+// operationPhase is a sub-phase of a phase run by Tanzu Framework, started
+// when Tanzu Framework logs one of its markers
+type operationPhase struct {
+	name    string
+	markers []string
+}
+
+// subPhases are the sub-phases of the phases run by Tanzu Framework
+var subPhases = map[string][]operationPhase{
+	phaseClusterCreation: {
+		{name: "providers", markers: []string{"Installing providers on bootstrapper"}},
+		{name: "cluster-objects", markers: []string{"Start creating"}},
+		{name: "control-plane", markers: []string{"Waiting for cluster to be initialized", "Waiting for control plane"}},
+	},
+	phaseClusterDeletion: {
+		{name: "bootstrap-cluster", markers: []string{"Setting up bootstrapper"}},
+		{name: "providers", markers: []string{"Installing providers on bootstrapper"}},
+		{name: "pivot", markers: []string{"Moving all Cluster API objects"}},
+		{name: "cluster-objects-deletion", markers: []string{"Waiting for the Cluster API objects to be deleted", "Deleting standalone cluster", "Deleting management cluster"}},
+		{name: "bootstrap-cluster-deletion", markers: []string{"Deleting kind cluster"}},
+	},
+}
+
+// events writes the progress events of the running operation, when requested
+// with --output-events
+var events *eventEmitter
+
+func validateEventsFormat(format string) error {
+	if format != "" && format != eventsFormatJSON {
+		return fmt.Errorf("unsupported events format %q: must be json", format)
+	}
+	return nil
+}
+
+// eventEmitter writes the progress events of an operation
+type eventEmitter struct {
+	mu        sync.Mutex
+	encoder   *json.Encoder
+	operation string
+	cluster   string
+	// subPhases are the sub-phases of the current phase, and current the
+	// index of the current sub-phase, -1 before the first one
+	subPhases []operationPhase
+	current   int
+	// flushLog reads the lines of the Tanzu Framework log not read yet
+	flushLog func()
+}
+
+func (e *eventEmitter) emit(phase, status string, bestEffort bool, message string, err error) {
+	event := progressEvent{
+		Time:       time.Now().UTC(),
+		Operation:  e.operation,
+		Cluster:    e.cluster,
+		Phase:      phase,
+		Status:     status,
+		BestEffort: bestEffort,
+		Message:    message,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	_ = e.encoder.Encode(event)
+}
+
+func (e *eventEmitter) startPhase(phase string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.subPhases = subPhases[phase]
+	e.current = -1
+	e.emit(phase, eventStarted, false, "", nil)
+}
+
+// endPhase ends the current sub-phase, then the phase
+func (e *eventEmitter) endPhase(phase string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := eventCompleted
+	if err != nil {
+		status = eventFailed
+	}
+	if e.current >= 0 {
+		e.emit(e.subPhases[e.current].name, status, true, "", err)
+	}
+	e.subPhases = nil
+	e.current = -1
+	e.emit(phase, status, false, "", err)
+}
+
+// logLine moves to the sub-phase of the current phase started by a line of
+// the Tanzu Framework log. Sub-phases only move forward, the previous one is
+// completed.
+func (e *eventEmitter) logLine(line string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i := e.current + 1; i < len(e.subPhases); i++ {
+		for _, marker := range e.subPhases[i].markers {
+			if !strings.Contains(line, marker) {
+				continue
+			}
+			if e.current >= 0 {
+				e.emit(e.subPhases[e.current].name, eventCompleted, true, "", nil)
+			}
+			e.current = i
+			e.emit(e.subPhases[i].name, eventStarted, true, strings.TrimSpace(line), nil)
+			return
+		}
+	}
+}
+
+// runPhase runs a phase of the running operation, written as progress events
+// when requested
+func runPhase(phase string, run func() error) error {
+	if events == nil {
+		return run()
+	}
+	events.startPhase(phase)
+	err := run()
+	// the sub-phases logged last end with the phase
+	events.flushLog()
+	events.endPhase(phase, err)
+	return err
+}
+
+// runWithEvents runs an operation logging through Tanzu Framework. When
+// format is set, the operation and its phases, see runPhase, are written to
+// out as progress events, along with the sub-phases of the phases run by
+// Tanzu Framework, from the lines it writes to its log file.
+func runWithEvents(out io.Writer, format, operation, clusterName string, run func() error) error {
+	if format == "" {
+		return run()
+	}
+
+	// Tanzu Framework only writes its log to a file when asked to
+	if logFile == "" {
+		file, err := os.CreateTemp("", "standalone-cluster-*.log")
+		if err != nil {
+			return err
+		}
+		file.Close()
+		logFile = file.Name()
+		defer func() {
+			os.Remove(logFile)
+			logFile = ""
+		}()
+	}
+
+	events = &eventEmitter{
+		encoder:   json.NewEncoder(out),
+		operation: operation,
+		cluster:   clusterName,
+		current:   -1,
+	}
+	defer func() {
+		events = nil
+	}()
+
+	events.emit("", eventStarted, false, "", nil)
+	flush, stop := tailFile(logFile, events.logLine)
+	events.flushLog = flush
+	err := run()
+	stop()
+
+	status := eventCompleted
+	if err != nil {
+		status = eventFailed
+	}
+	events.emit("", status, false, "", err)
+	return err
+}
+
+// tailFile calls onLine for every line appended to the file at path, until
+// stop is called. flush reads the lines appended since the last read.
+func tailFile(path string, onLine func(string)) (flush, stop func()) {
+	var mu sync.Mutex
+	var offset int64
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+
+	var pending string
+	read := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		file, err := os.Open(path)
+		if err != nil {
+			return
+		}
+		defer file.Close()
+
+		if _, seekErr := file.Seek(offset, io.SeekStart); seekErr != nil {
+			return
+		}
+		reader := bufio.NewReader(file)
+		for {
+			chunk, readErr := reader.ReadString('\n')
+			offset += int64(len(chunk))
+			pending += chunk
+			if readErr != nil {
+				return
+			}
+			onLine(strings.TrimSuffix(pending, "\n"))
+			pending = ""
+		}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(logPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				read()
+				return
+			case <-ticker.C:
+				read()
+			}
+		}
+	}()
+
+	return read, func() {
+		close(done)
+		<-stopped
+	}
+}
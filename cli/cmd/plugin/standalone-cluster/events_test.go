@@ -0,0 +1,106 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunWithEvents(t *testing.T) {
+	logFile = filepath.Join(t.TempDir(), "tanzu.log")
+	defer func() {
+		logFile = ""
+	}()
+	appendLog := func(line string) {
+		file, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if _, err = file.WriteString(line + "\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	errMove := errors.New("move failed")
+	err := runWithEvents(out, eventsFormatJSON, operationCreate, "test", func() error {
+		if err := runPhase(phaseBootstrapCluster, func() error { return nil }); err != nil {
+			return err
+		}
+		err := runPhase(phaseClusterCreation, func() error {
+			appendLog("Installing providers on bootstrapper...")
+			appendLog("unrelated line")
+			appendLog("Waiting for control plane to be available...")
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return runPhase(phaseMove, func() error { return errMove })
+	})
+	if !errors.Is(err, errMove) {
+		t.Fatalf("expected the error of the operation, got %v", err)
+	}
+
+	type event struct {
+		phase      string
+		status     string
+		bestEffort bool
+	}
+	want := []event{
+		{"", eventStarted, false},
+		{phaseBootstrapCluster, eventStarted, false},
+		{phaseBootstrapCluster, eventCompleted, false},
+		{phaseClusterCreation, eventStarted, false},
+		{"providers", eventStarted, true},
+		{"providers", eventCompleted, true},
+		{"control-plane", eventStarted, true},
+		{"control-plane", eventCompleted, true},
+		{phaseClusterCreation, eventCompleted, false},
+		{phaseMove, eventStarted, false},
+		{phaseMove, eventFailed, false},
+		{"", eventFailed, false},
+	}
+
+	decoder := json.NewDecoder(out)
+	i := 0
+	for ; decoder.More(); i++ {
+		var got progressEvent
+		if err = decoder.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if i >= len(want) {
+			t.Fatalf("unexpected event %+v", got)
+		}
+		if got.Phase != want[i].phase || got.Status != want[i].status || got.BestEffort != want[i].bestEffort {
+			t.Errorf("event %d: expected %+v, got %+v", i, want[i], got)
+		}
+		if got.Operation != operationCreate || got.Cluster != "test" {
+			t.Errorf("event %d: expected the create operation of cluster test, got %+v", i, got)
+		}
+		if got.Status == eventFailed && got.Error != errMove.Error() {
+			t.Errorf("event %d: expected error %q, got %q", i, errMove, got.Error)
+		}
+	}
+	if i != len(want) {
+		t.Errorf("expected %d events, got %d", len(want), i)
+	}
+}
+
+func TestRunPhaseWithoutEvents(t *testing.T) {
+	ran := false
+	err := runPhase(phaseSaveState, func() error {
+		ran = true
+		return nil
+	})
+	if err != nil || !ran {
+		t.Errorf("expected the phase to run, got %v", err)
+	}
+}
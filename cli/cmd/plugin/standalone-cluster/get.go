@@ -0,0 +1,88 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/cli/component"
+)
+
+type getStandaloneOptions struct {
+	outputFormat string
+}
+
+// GetCmd shows the details of a standalone cluster.
+var GetCmd = &cobra.Command{
+	Use:   "get <cluster name>",
+	Short: "get the details of a standalone cluster",
+	Args:  cobra.ExactArgs(1),
+	RunE:  get,
+}
+
+var gso = getStandaloneOptions{}
+
+func init() {
+	GetCmd.Flags().StringVarP(&gso.outputFormat, "output", "o", "", "Output format (table|json|yaml)")
+}
+
+func get(cmd *cobra.Command, args []string) error {
+	if err := validateOutputFormat(gso.outputFormat); err != nil {
+		return err
+	}
+
+	c, err := loadStandaloneCluster(args[0])
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to get standalone cluster %s", args[0])
+	}
+	c.refreshStatus()
+
+	switch component.OutputType(gso.outputFormat) {
+	case component.JSONOutputType:
+		data, err := json.MarshalIndent(c, "", "  ")
+		if err != nil {
+			return NonUsageError(cmd, err, "unable to render standalone cluster %s", c.Name)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(data))
+		return nil
+	case component.YAMLOutputType:
+		data, err := yaml.Marshal(c)
+		if err != nil {
+			return NonUsageError(cmd, err, "unable to render standalone cluster %s", c.Name)
+		}
+		fmt.Fprint(cmd.OutOrStdout(), string(data))
+		return nil
+	}
+
+	t := component.NewOutputWriter(cmd.OutOrStdout(), gso.outputFormat, "NAME", "INFRASTRUCTURE", "PLAN", "CONTEXT", "KUBERNETES", "CONTROL PLANE", "WORKERS", "STATUS", "CREATED")
+	t.AddRow(c.Name, c.Infrastructure, c.Plan, c.Context, c.KubernetesVersion, c.ControlPlane, c.Workers, c.Status, c.CreationTime.Format(time.RFC3339))
+	t.Render()
+
+	if len(c.Nodes) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout())
+	t = component.NewOutputWriter(cmd.OutOrStdout(), gso.outputFormat, "NODE", "ROLE", "READY", "VERSION")
+	for _, node := range c.Nodes {
+		t.AddRow(node.Name, node.Role, node.Ready, node.Version)
+	}
+	t.Render()
+
+	return nil
+}
+
+// validateOutputFormat checks the output format is supported by component.NewOutputWriter
+func validateOutputFormat(outputFormat string) error {
+	switch component.OutputType(outputFormat) {
+	case "", component.TableOutputType, component.JSONOutputType, component.YAMLOutputType:
+		return nil
+	}
+	return fmt.Errorf("unsupported output format %q: must be one of table, json or yaml", outputFormat)
+}
@@ -5,7 +5,13 @@ go 1.16
 require (
 	github.com/spf13/cobra v1.2.0
 	github.com/vmware-tanzu/tanzu-framework v1.4.0-pre-alpha-2.0.20210915174701-14fe0fdf4f0b
+	k8s.io/api v0.17.11
+	k8s.io/apimachinery v0.17.11
+	k8s.io/client-go v0.17.11
 	k8s.io/klog/v2 v2.8.0
+	sigs.k8s.io/controller-runtime v0.5.14
+	sigs.k8s.io/kind v0.11.1
+	sigs.k8s.io/yaml v1.2.0
 )
 
 replace (
@@ -0,0 +1,217 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/kind/pkg/cluster"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+const (
+	// defaultRotateThreshold is the time before its expiry from which the
+	// admin client certificate of a cluster is renewed
+	defaultRotateThreshold = 30 * 24 * time.Hour
+)
+
+type kubeconfigOptions struct {
+	exportFile string
+	admin      bool
+	threshold  time.Duration
+	force      bool
+}
+
+// KubeconfigCmd manages the kubeconfig of standalone clusters.
+var KubeconfigCmd = &cobra.Command{
+	Use:   "kubeconfig",
+	Short: "manage the kubeconfig of standalone clusters",
+}
+
+var kubeconfigGetCmd = &cobra.Command{
+	Use:   "get <cluster name> --admin",
+	Short: "get the admin kubeconfig of a standalone cluster",
+	Args:  cobra.ExactArgs(1),
+	RunE:  getKubeconfig,
+}
+
+var kubeconfigRotateCmd = &cobra.Command{
+	Use:   "rotate <cluster name>",
+	Short: "renew the admin client certificate of a standalone cluster",
+	Args:  cobra.ExactArgs(1),
+	RunE:  rotateKubeconfig,
+}
+
+var kco = kubeconfigOptions{}
+
+func init() {
+	kubeconfigGetCmd.Flags().StringVarP(&kco.exportFile, "export-file", "", "", "File path to export the kubeconfig to, instead of merging it into the default kubeconfig")
+	kubeconfigGetCmd.Flags().BoolVarP(&kco.admin, "admin", "", false, "Get the admin kubeconfig of the cluster")
+
+	kubeconfigRotateCmd.Flags().StringVarP(&kco.exportFile, "export-file", "", "", "File path to export the renewed kubeconfig to, instead of merging it into the default kubeconfig")
+	kubeconfigRotateCmd.Flags().DurationVarP(&kco.threshold, "threshold", "", defaultRotateThreshold, "Renew the certificate when it expires within this duration")
+	kubeconfigRotateCmd.Flags().BoolVarP(&kco.force, "force", "", false, "Renew the certificate whatever its expiry")
+
+	KubeconfigCmd.AddCommand(kubeconfigGetCmd, kubeconfigRotateCmd)
+}
+
+func getKubeconfig(cmd *cobra.Command, args []string) error {
+	clusterName := args[0]
+	if !kco.admin {
+		// standalone clusters have no management cluster to get the
+		// identity management configuration from
+		return fmt.Errorf("only the admin kubeconfig of standalone clusters is available: use --admin")
+	}
+
+	config, err := loadAdminKubeconfig(clusterName)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to get kubeconfig of standalone cluster %s", clusterName)
+	}
+
+	err = writeKubeconfig(config, kco.exportFile)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to save kubeconfig of standalone cluster %s", clusterName)
+	}
+
+	printKubeconfigSaved(cmd, clusterName, config.CurrentContext)
+	return nil
+}
+
+func printKubeconfigSaved(cmd *cobra.Command, clusterName, kubeContext string) {
+	fmt.Fprintf(cmd.OutOrStdout(), "Credentials of standalone cluster '%s' have been saved\n", clusterName)
+	if kco.exportFile == "" {
+		fmt.Fprintf(cmd.OutOrStdout(), "You can now access the cluster by running 'kubectl config use-context %s'\n", kubeContext)
+		return
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "You can now access the cluster by running 'kubectl --kubeconfig %s --context %s'\n", kco.exportFile, kubeContext)
+}
+
+// loadAdminKubeconfig returns the admin kubeconfig of a cluster, read from
+// its Cluster API kubeconfig secret: from the bootstrap cluster holding the
+// cluster, for example after a failed creation, or else from the Cluster API
+// store of the cluster, reached with the kubeconfig saved by the plugin.
+func loadAdminKubeconfig(clusterName string) (*clientcmdapi.Config, error) {
+	config, err := loadBootstrapKubeconfig(clusterName)
+	if err != nil {
+		log.Warningf("could not read kubeconfig of standalone cluster %s from bootstrap clusters: %v", clusterName, err)
+	}
+	if config != nil {
+		return config, nil
+	}
+	return loadStoreKubeconfig(clusterName)
+}
+
+// loadStoreKubeconfig reads the Cluster API kubeconfig secret of a cluster
+// from its Cluster API store
+func loadStoreKubeconfig(clusterName string) (*clientcmdapi.Config, error) {
+	saved, err := loadClusterKubeconfig(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("no bootstrap cluster holds the cluster, and %v", err)
+	}
+	client, err := newKubeconfigClient(saved)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterStatusTimeout)
+	defer cancel()
+
+	kubeconfig, err := readClusterKubeconfigSecret(ctx, client, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read kubeconfig from the Cluster API store of the cluster: %v", err)
+	}
+	if kubeconfig == nil {
+		return nil, errClusterAPIStoreNotFound
+	}
+	log.Infof("Reading kubeconfig of standalone cluster %s from its Cluster API store", clusterName)
+	return clientcmd.Load(kubeconfig)
+}
+
+// loadBootstrapKubeconfig reads the Cluster API kubeconfig secret of a
+// cluster from the bootstrap clusters. It returns nil when no bootstrap
+// cluster holds the cluster.
+func loadBootstrapKubeconfig(clusterName string) (*clientcmdapi.Config, error) {
+	prov := newKindProvider()
+	bootstrapClusters, err := listBootstrapClusters(prov)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, bootstrapCluster := range bootstrapClusters {
+		config, readErr := readBootstrapKubeconfig(prov, bootstrapCluster, clusterName)
+		if readErr != nil {
+			log.Warningf("skipping bootstrap cluster %s: %v", bootstrapCluster, readErr)
+			continue
+		}
+		if config != nil {
+			log.Infof("Reading kubeconfig of standalone cluster %s from bootstrap cluster %s", clusterName, bootstrapCluster)
+			return config, nil
+		}
+	}
+	return nil, nil
+}
+
+func readBootstrapKubeconfig(prov *cluster.Provider, bootstrapCluster, clusterName string) (*clientcmdapi.Config, error) {
+	client, err := newBootstrapClusterClient(prov, bootstrapCluster)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterStatusTimeout)
+	defer cancel()
+
+	kubeconfig, err := readClusterKubeconfigSecret(ctx, client, clusterName)
+	if err != nil || kubeconfig == nil {
+		return nil, err
+	}
+	return clientcmd.Load(kubeconfig)
+}
+
+// writeKubeconfig merges a kubeconfig into the file at path, or into the
+// default kubeconfig when path is empty
+func writeKubeconfig(config *clientcmdapi.Config, path string) error {
+	if path == "" {
+		pathOptions := clientcmd.NewDefaultPathOptions()
+		existing, err := pathOptions.GetStartingConfig()
+		if err != nil {
+			return err
+		}
+		mergeKubeconfig(existing, config)
+		return clientcmd.ModifyConfig(pathOptions, *existing, true)
+	}
+
+	existing := clientcmdapi.NewConfig()
+	if _, err := os.Stat(path); err == nil {
+		existing, err = clientcmd.LoadFromFile(path)
+		if err != nil {
+			return err
+		}
+	}
+	mergeKubeconfig(existing, config)
+	return clientcmd.WriteToFile(*existing, path)
+}
+
+// mergeKubeconfig adds the clusters, users and contexts of src to dst. The
+// current context of dst is only set when it has none.
+func mergeKubeconfig(dst, src *clientcmdapi.Config) {
+	for name, c := range src.Clusters {
+		dst.Clusters[name] = c
+	}
+	for name, authInfo := range src.AuthInfos {
+		dst.AuthInfos[name] = authInfo
+	}
+	for name, c := range src.Contexts {
+		dst.Contexts[name] = c
+	}
+	if dst.CurrentContext == "" {
+		dst.CurrentContext = src.CurrentContext
+	}
+}
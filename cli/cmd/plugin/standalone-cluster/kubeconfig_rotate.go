@@ -0,0 +1,239 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	crtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+const (
+	// kubeAPIServerClientSigner is the Kubernetes signer of client certificates
+	// trusted by the API server
+	kubeAPIServerClientSigner = "kubernetes.io/kube-apiserver-client"
+
+	adminKeySize = 2048
+
+	rotateTimeout      = 2 * time.Minute
+	rotatePollInterval = 2 * time.Second
+)
+
+func rotateKubeconfig(cmd *cobra.Command, args []string) error {
+	clusterName := args[0]
+
+	config, err := loadAdminKubeconfig(clusterName)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to get kubeconfig of standalone cluster %s", clusterName)
+	}
+	authInfo, cert, err := adminClientCertificate(config)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to read admin client certificate of standalone cluster %s", clusterName)
+	}
+
+	if !kco.force && time.Until(cert.NotAfter) > kco.threshold {
+		fmt.Fprintf(cmd.OutOrStdout(), "The admin client certificate of standalone cluster '%s' expires on %s: it is not renewed\n",
+			clusterName, cert.NotAfter.UTC().Format(time.RFC3339))
+		return nil
+	}
+
+	restConfig, err := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to connect to standalone cluster %s", clusterName)
+	}
+
+	log.Infof("Renewing admin client certificate of standalone cluster %s, expiring on %s", clusterName, cert.NotAfter.UTC().Format(time.RFC3339))
+	certData, keyData, err := renewClientCertificate(restConfig, clusterName, cert.Subject)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to renew admin client certificate of standalone cluster %s", clusterName)
+	}
+	authInfo.ClientCertificateData = certData
+	authInfo.ClientKeyData = keyData
+
+	err = saveRenewedKubeconfig(clusterName, config)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to save renewed kubeconfig of standalone cluster %s", clusterName)
+	}
+	err = writeKubeconfig(config, kco.exportFile)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to save kubeconfig of standalone cluster %s", clusterName)
+	}
+
+	printKubeconfigSaved(cmd, clusterName, config.CurrentContext)
+	return nil
+}
+
+// saveRenewedKubeconfig saves a renewed admin kubeconfig with the state of a
+// cluster, and updates the Cluster API kubeconfig secret of its Cluster API
+// store, from which the kubeconfig is read
+func saveRenewedKubeconfig(clusterName string, config *clientcmdapi.Config) error {
+	kubeconfig, err := clientcmd.Write(*config)
+	if err != nil {
+		return err
+	}
+	if err = saveClusterKubeconfig(clusterName, kubeconfig); err != nil {
+		return err
+	}
+
+	client, err := newKubeconfigClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), clusterStatusTimeout)
+	defer cancel()
+	return updateClusterKubeconfigSecret(ctx, client, clusterName, kubeconfig)
+}
+
+// adminClientCertificate returns the user of the current context of an admin
+// kubeconfig, along with its client certificate
+func adminClientCertificate(config *clientcmdapi.Config) (*clientcmdapi.AuthInfo, *x509.Certificate, error) {
+	kubeContext, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return nil, nil, fmt.Errorf("context %s not found", config.CurrentContext)
+	}
+	authInfo, ok := config.AuthInfos[kubeContext.AuthInfo]
+	if !ok {
+		return nil, nil, fmt.Errorf("user %s not found", kubeContext.AuthInfo)
+	}
+
+	block, _ := pem.Decode(authInfo.ClientCertificateData)
+	if block == nil {
+		return nil, nil, fmt.Errorf("user %s does not authenticate with a client certificate", kubeContext.AuthInfo)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return authInfo, cert, nil
+}
+
+// renewClientCertificate issues a client certificate for the subject of the
+// current one, through a CertificateSigningRequest approved with the current
+// credentials. It returns the PEM encoded certificate and private key.
+func renewClientCertificate(cfg *rest.Config, clusterName string, subject pkix.Name) (certData, keyData []byte, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, adminKeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	request, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: subject.CommonName, Organization: subject.Organization},
+	}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := crtclient.New(cfg, crtclient.Options{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rotateTimeout)
+	defer cancel()
+
+	csr := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "certificates.k8s.io/v1",
+		"kind":       "CertificateSigningRequest",
+		"metadata": map[string]interface{}{
+			"name": fmt.Sprintf("%s-admin-%d", clusterName, time.Now().Unix()),
+		},
+		"spec": map[string]interface{}{
+			"request":    base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: request})),
+			"signerName": kubeAPIServerClientSigner,
+			"usages":     []interface{}{"digital signature", "key encipherment", "client auth"},
+		},
+	}}
+	err = client.Create(ctx, csr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create certificate signing request: %v", err)
+	}
+	defer func() {
+		if deleteErr := client.Delete(context.Background(), csr); deleteErr != nil {
+			log.Warningf("could not delete certificate signing request %s: %v", csr.GetName(), deleteErr)
+		}
+	}()
+
+	err = approveCertificateSigningRequest(ctx, cfg, csr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = wait.PollImmediate(rotatePollInterval, rotateTimeout, func() (bool, error) {
+		if getErr := client.Get(ctx, crtclient.ObjectKey{Name: csr.GetName()}, csr); getErr != nil {
+			return false, getErr
+		}
+		encoded, _, _ := unstructured.NestedString(csr.Object, "status", "certificate")
+		if encoded == "" {
+			return false, nil
+		}
+		certData, err = base64.StdEncoding.DecodeString(encoded)
+		return true, err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("certificate signing request %s was not signed: %v", csr.GetName(), err)
+	}
+
+	keyData = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return certData, keyData, nil
+}
+
+// approveCertificateSigningRequest approves a CertificateSigningRequest
+// through its approval subresource
+func approveCertificateSigningRequest(ctx context.Context, cfg *rest.Config, csr *unstructured.Unstructured) error {
+	err := unstructured.SetNestedSlice(csr.Object, []interface{}{
+		map[string]interface{}{
+			"type":    "Approved",
+			"status":  "True",
+			"reason":  "StandaloneClusterKubeconfigRotate",
+			"message": "Approved by tanzu standalone-cluster kubeconfig rotate",
+		},
+	}, "status", "conditions")
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(csr.Object)
+	if err != nil {
+		return err
+	}
+
+	transport, err := rest.TransportFor(cfg)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/apis/certificates.k8s.io/v1/certificatesigningrequests/%s/approval", strings.TrimSuffix(cfg.Host, "/"), csr.GetName())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot approve certificate signing request %s: %v", csr.GetName(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot approve certificate signing request %s: %s", csr.GetName(), resp.Status)
+	}
+	return nil
+}
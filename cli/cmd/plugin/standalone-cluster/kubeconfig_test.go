@@ -0,0 +1,82 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestClusterKubeconfigSecret(t *testing.T) {
+	client := newFakeClient(t, newObject(capiClusterListGVK.GroupVersion().WithKind("Cluster"), "tkg-system", "test", nil))
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tkg-system", Name: "test-kubeconfig"},
+		Data:       map[string][]byte{"value": []byte("kubeconfig")},
+	}
+	if err := client.Create(context.Background(), secret); err != nil {
+		t.Fatal(err)
+	}
+
+	kubeconfig, err := readClusterKubeconfigSecret(context.Background(), client, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(kubeconfig) != "kubeconfig" {
+		t.Errorf("expected the kubeconfig of the secret, got %q", kubeconfig)
+	}
+
+	if err = updateClusterKubeconfigSecret(context.Background(), client, "test", []byte("renewed")); err != nil {
+		t.Fatal(err)
+	}
+	kubeconfig, err = readClusterKubeconfigSecret(context.Background(), client, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(kubeconfig) != "renewed" {
+		t.Errorf("expected the renewed kubeconfig, got %q", kubeconfig)
+	}
+}
+
+func TestClusterKubeconfigSecretNotInStore(t *testing.T) {
+	client := newFakeClient(t)
+
+	kubeconfig, err := readClusterKubeconfigSecret(context.Background(), client, "test")
+	if err != nil || kubeconfig != nil {
+		t.Errorf("expected no kubeconfig for a cluster out of the store, got %q, %v", kubeconfig, err)
+	}
+	if err = updateClusterKubeconfigSecret(context.Background(), client, "test", []byte("renewed")); err != nil {
+		t.Errorf("expected nothing to update for a cluster out of the store, got %v", err)
+	}
+}
+
+func TestMergeKubeconfig(t *testing.T) {
+	dst := clientcmdapi.NewConfig()
+	dst.Contexts["kind-tkg-kind"] = &clientcmdapi.Context{Cluster: "kind-tkg-kind"}
+	dst.CurrentContext = "kind-tkg-kind"
+
+	src := clientcmdapi.NewConfig()
+	src.Clusters["test"] = &clientcmdapi.Cluster{Server: "https://127.0.0.1:6443"}
+	src.AuthInfos["test-admin"] = &clientcmdapi.AuthInfo{}
+	src.Contexts["test-admin@test"] = &clientcmdapi.Context{Cluster: "test", AuthInfo: "test-admin"}
+	src.CurrentContext = "test-admin@test"
+
+	mergeKubeconfig(dst, src)
+
+	if _, ok := dst.Contexts["test-admin@test"]; !ok {
+		t.Error("expected the context of the cluster to be merged")
+	}
+	if _, ok := dst.Clusters["test"]; !ok {
+		t.Error("expected the cluster to be merged")
+	}
+	if _, ok := dst.AuthInfos["test-admin"]; !ok {
+		t.Error("expected the user to be merged")
+	}
+	if dst.CurrentContext != "kind-tkg-kind" {
+		t.Errorf("expected the current context to be kept, got %s", dst.CurrentContext)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/cli/component"
+)
+
+type listStandaloneOptions struct {
+	outputFormat string
+}
+
+// ListCmd lists the standalone clusters created from this machine.
+var ListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list the standalone clusters created from this machine",
+	Args:  cobra.NoArgs,
+	RunE:  list,
+}
+
+var lso = listStandaloneOptions{}
+
+func init() {
+	ListCmd.Flags().StringVarP(&lso.outputFormat, "output", "o", "", "Output format (table|json|yaml)")
+}
+
+func list(cmd *cobra.Command, _ []string) error {
+	if err := validateOutputFormat(lso.outputFormat); err != nil {
+		return err
+	}
+
+	names, err := listStandaloneClusterNames()
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to list standalone clusters")
+	}
+
+	t := component.NewOutputWriter(cmd.OutOrStdout(), lso.outputFormat, "NAME", "INFRASTRUCTURE", "CONTEXT", "KUBERNETES", "CONTROL PLANE", "WORKERS", "STATUS")
+	for _, name := range names {
+		c, err := loadStandaloneCluster(name)
+		if err != nil {
+			return NonUsageError(cmd, err, "unable to load standalone cluster %s", name)
+		}
+		c.refreshStatus()
+		t.AddRow(c.Name, c.Infrastructure, c.Context, c.KubernetesVersion, c.ControlPlane, c.Workers, c.Status)
+	}
+	t.Render()
+
+	return nil
+}
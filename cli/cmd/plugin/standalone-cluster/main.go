@@ -54,6 +54,15 @@ func main() {
 	p.AddCommands(
 		CreateCmd,
 		DeleteCmd,
+		ListCmd,
+		GetCmd,
+		CleanupCmd,
+		KubeconfigCmd,
+		PreflightCmd,
+		BackupCmd,
+		RestoreCmd,
+		ScaleCmd,
+		UpgradeCmd,
 	)
 	if err := p.Execute(); err != nil {
 		os.Exit(1)
@@ -0,0 +1,271 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+const (
+	gibibyte = 1024 * 1024 * 1024
+
+	// resources needed by the bootstrap cluster, and by each node of a cluster
+	// on Docker, on top of the disk needed for the node images
+	bootstrapCPUs      = 2
+	bootstrapMemoryGiB = 2
+	nodeCPUs           = 1
+	nodeMemoryGiB      = 2
+	imagesDiskGiB      = 15
+	nodeDiskGiB        = 2
+
+	// inotify limits recommended by kind to run several clusters
+	minInotifyMaxUserWatches   = 524288
+	minInotifyMaxUserInstances = 512
+)
+
+type preflightOptions struct {
+	clusterConfigFile      string
+	infrastructureProvider string
+}
+
+// PreflightCmd checks the machine can create a standalone cluster.
+var PreflightCmd = &cobra.Command{
+	Use:   "preflight <cluster name> -f <configuration location>",
+	Short: "check this machine can create a standalone cluster",
+	Args:  cobra.ExactArgs(1),
+	RunE:  preflight,
+}
+
+var pfo = preflightOptions{}
+
+func init() {
+	PreflightCmd.Flags().StringVarP(&pfo.clusterConfigFile, "file", "f", "", "Configuration file from which the standalone cluster would be created")
+	PreflightCmd.Flags().StringVarP(&pfo.infrastructureProvider, "infrastructure", "i", "", "Infrastructure the standalone cluster would be deployed on")
+}
+
+// preflightProblem is a failed preflight check, with its remediation
+type preflightProblem struct {
+	check       string
+	problem     string
+	remediation string
+}
+
+// dockerInfo is the part of the output of 'docker info' the preflight checks use
+type dockerInfo struct {
+	NCPU          int      `json:"NCPU"`
+	MemTotal      int64    `json:"MemTotal"`
+	CgroupVersion string   `json:"CgroupVersion"`
+	DockerRootDir string   `json:"DockerRootDir"`
+	ServerErrors  []string `json:"ServerErrors"`
+}
+
+func preflight(cmd *cobra.Command, args []string) error {
+	config, err := resolveClusterConfig(args[0], &initStandaloneOptions{
+		clusterConfigFile:      pfo.clusterConfigFile,
+		infrastructureProvider: pfo.infrastructureProvider,
+	})
+	if err != nil {
+		return NonUsageError(cmd, err, "invalid standalone cluster configuration")
+	}
+
+	err = runPreflightChecks(cmd.OutOrStdout(), config)
+	if err != nil {
+		return NonUsageError(cmd, err, "standalone cluster %s cannot be created on this machine", args[0])
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), "All preflight checks passed")
+	return nil
+}
+
+// preflightCreate runs the preflight checks of create. Problems are written
+// to stderr, to keep the progress events parsable.
+func preflightCreate(cmd *cobra.Command, clusterName string) error {
+	config, err := resolveClusterConfig(clusterName, &iso)
+	if err != nil {
+		return NonUsageError(cmd, err, "invalid standalone cluster configuration")
+	}
+	err = runPreflightChecks(cmd.ErrOrStderr(), config)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to create standalone cluster %s: use --skip-preflight to create it anyway", clusterName)
+	}
+	return nil
+}
+
+// runPreflightChecks checks the machine can create a cluster of the
+// configuration, and reports every problem found at once
+func runPreflightChecks(out io.Writer, config map[string]interface{}) error {
+	log.Infof("Running preflight checks")
+
+	var problems []preflightProblem
+	info, problem := getDockerInfo()
+	if problem != nil {
+		problems = append(problems, *problem)
+	} else {
+		problems = append(problems, checkCgroupVersion(info)...)
+		if configValue(config, "INFRASTRUCTURE_PROVIDER") == defaultInfrastructureProvider {
+			problems = append(problems, checkDockerResources(info, config)...)
+		}
+	}
+	problems = append(problems, checkInotifyLimits()...)
+	problems = append(problems, checkLeftoverBootstrapClusters()...)
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	for _, p := range problems {
+		fmt.Fprintf(out, "[%s] %s\n", p.check, p.problem)
+		fmt.Fprintf(out, "    remediation: %s\n", p.remediation)
+	}
+	return fmt.Errorf("%d preflight check(s) failed", len(problems))
+}
+
+func getDockerInfo() (*dockerInfo, *preflightProblem) {
+	output, err := exec.Command("docker", "info", "--format", "{{json .}}").Output()
+	if err != nil {
+		return nil, &preflightProblem{
+			check:       "docker",
+			problem:     fmt.Sprintf("Docker is not reachable: %v", err),
+			remediation: "install and start Docker, and make sure the current user can run 'docker info'",
+		}
+	}
+
+	info := &dockerInfo{}
+	err = json.Unmarshal(output, info)
+	if err != nil {
+		return nil, &preflightProblem{
+			check:       "docker",
+			problem:     fmt.Sprintf("cannot read the output of 'docker info': %v", err),
+			remediation: "upgrade Docker to a supported version",
+		}
+	}
+	if len(info.ServerErrors) > 0 {
+		return nil, &preflightProblem{
+			check:       "docker",
+			problem:     fmt.Sprintf("Docker is not reachable: %s", strings.Join(info.ServerErrors, ", ")),
+			remediation: "start Docker, and make sure the current user can run 'docker info'",
+		}
+	}
+	return info, nil
+}
+
+func checkCgroupVersion(info *dockerInfo) []preflightProblem {
+	if info.CgroupVersion != "2" {
+		return nil
+	}
+	return []preflightProblem{{
+		check:       "cgroup",
+		problem:     "Docker uses cgroup v2, bootstrap and Docker clusters need cgroup v1",
+		remediation: "set the 'systemd.unified_cgroup_hierarchy=0' kernel parameter to restore cgroup v1",
+	}}
+}
+
+// checkDockerResources checks Docker has the CPUs, memory and disk needed by
+// the bootstrap cluster and the nodes of the cluster
+func checkDockerResources(info *dockerInfo, config map[string]interface{}) []preflightProblem {
+	nodes := clusterNodeCount(config)
+	cpus := bootstrapCPUs + nodes*nodeCPUs
+	memoryGiB := bootstrapMemoryGiB + nodes*nodeMemoryGiB
+	diskGiB := imagesDiskGiB + nodes*nodeDiskGiB
+	remediation := "increase the resources of Docker, in Docker Desktop from Preferences > Resources > Advanced, or use a plan with fewer nodes"
+
+	var problems []preflightProblem
+	if info.NCPU < cpus {
+		problems = append(problems, preflightProblem{
+			check:       "cpu",
+			problem:     fmt.Sprintf("Docker has %d CPUs, %d are needed for %d nodes", info.NCPU, cpus, nodes),
+			remediation: remediation,
+		})
+	}
+	if info.MemTotal < int64(memoryGiB)*gibibyte {
+		problems = append(problems, preflightProblem{
+			check:       "memory",
+			problem:     fmt.Sprintf("Docker has %.1f GiB of memory, %d GiB are needed for %d nodes", float64(info.MemTotal)/gibibyte, memoryGiB, nodes),
+			remediation: remediation,
+		})
+	}
+
+	free, ok := freeDiskSpace(info.DockerRootDir)
+	if !ok {
+		log.Infof("free disk space of Docker not checked: %s is not on this machine", info.DockerRootDir)
+	} else if free < uint64(diskGiB)*gibibyte {
+		problems = append(problems, preflightProblem{
+			check:       "disk",
+			problem:     fmt.Sprintf("%s has %.1f GiB free, %d GiB are needed for %d nodes", info.DockerRootDir, float64(free)/gibibyte, diskGiB, nodes),
+			remediation: "free disk space, e.g. with 'docker system prune', or increase the disk image size of Docker Desktop",
+		})
+	}
+	return problems
+}
+
+// clusterNodeCount returns the number of control plane and worker nodes of
+// a cluster configuration
+func clusterNodeCount(config map[string]interface{}) int {
+	counts := defaultMachineCounts[configValue(config, "CLUSTER_PLAN")]
+	var nodes int
+	for i, key := range []string{"CONTROL_PLANE_MACHINE_COUNT", "WORKER_MACHINE_COUNT"} {
+		count, err := strconv.Atoi(defaultIfEmpty(configValue(config, key), counts[i]))
+		if err != nil || count < 1 {
+			count = 1
+		}
+		nodes += count
+	}
+	return nodes
+}
+
+// checkInotifyLimits checks the inotify limits of Linux machines, which
+// limit the number of containers of nodes able to run
+func checkInotifyLimits() []preflightProblem {
+	var problems []preflightProblem
+	for _, limit := range []struct {
+		name string
+		min  int
+	}{
+		{"max_user_watches", minInotifyMaxUserWatches},
+		{"max_user_instances", minInotifyMaxUserInstances},
+	} {
+		data, err := os.ReadFile("/proc/sys/fs/inotify/" + limit.name)
+		if err != nil {
+			// not a Linux machine, the limits of the Docker Desktop VM apply
+			continue
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil || value >= limit.min {
+			continue
+		}
+		problems = append(problems, preflightProblem{
+			check:       "inotify",
+			problem:     fmt.Sprintf("fs.inotify.%s is %d, at least %d is needed", limit.name, value, limit.min),
+			remediation: fmt.Sprintf("run 'sudo sysctl fs.inotify.%s=%d', and add it to /etc/sysctl.conf to persist it", limit.name, limit.min),
+		})
+	}
+	return problems
+}
+
+func checkLeftoverBootstrapClusters() []preflightProblem {
+	bootstrapClusters, err := listBootstrapClusters(newKindProvider())
+	if err != nil {
+		log.Warningf("leftover bootstrap clusters not checked: %v", err)
+		return nil
+	}
+
+	problems := make([]preflightProblem, 0, len(bootstrapClusters))
+	for _, bootstrapCluster := range bootstrapClusters {
+		problems = append(problems, preflightProblem{
+			check:       "bootstrap",
+			problem:     fmt.Sprintf("bootstrap cluster %s is left from a previous operation", bootstrapCluster),
+			remediation: fmt.Sprintf("run 'tanzu standalone-cluster cleanup <cluster name>' for a failed creation, or 'kind delete cluster --name %s'", bootstrapCluster),
+		})
+	}
+	return problems
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import "syscall"
+
+// freeDiskSpace returns the space available to unprivileged users on the
+// filesystem of path, when path is on this machine
+func freeDiskSpace(path string) (uint64, bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, false
+	}
+	return stat.Bavail * uint64(stat.Bsize), true
+}
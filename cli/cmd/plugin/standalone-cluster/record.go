@@ -0,0 +1,94 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// minEncryptionKeySize is the minimum size of the key files the records of
+// clusters are encrypted with
+const minEncryptionKeySize = 32
+
+// sealedClusterRecord is the part of the record of a cluster holding its
+// credentials: its state with the secret values of its configuration, and its
+// admin kubeconfig, with which the Cluster API objects of the cluster are read
+// from its Cluster API store. It is encrypted with a key of the user.
+type sealedClusterRecord struct {
+	State      *standaloneClusterState `json:"state"`
+	Kubeconfig []byte                  `json:"kubeconfig"`
+}
+
+// readEncryptionKey reads the key file of the user and derives the AES-256
+// key the records of clusters are encrypted with
+func readEncryptionKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read encryption key: %v", err)
+	}
+	if len(data) < minEncryptionKeySize {
+		return nil, fmt.Errorf("encryption key file %s holds %d bytes: generate a key of at least %d random bytes, e.g. with 'openssl rand -out %s %d'", path, len(data), minEncryptionKeySize, path, minEncryptionKeySize)
+	}
+	key := sha256.Sum256(data)
+	return key[:], nil
+}
+
+// sealClusterRecord encrypts the record of a cluster with AES-GCM. The name of
+// the cluster is authenticated along with the record, for the record of a
+// cluster not to be restored as another one.
+func sealClusterRecord(key []byte, clusterName string, record *sealedClusterRecord) ([]byte, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newRecordCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, []byte(clusterName)), nil
+}
+
+// unsealClusterRecord decrypts the record of a cluster sealed by sealClusterRecord
+func unsealClusterRecord(key []byte, clusterName string, sealed []byte) (*sealedClusterRecord, error) {
+	gcm, err := newRecordCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("the record of standalone cluster %s is truncated", clusterName)
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	data, err := gcm.Open(nil, nonce, ciphertext, []byte(clusterName))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt the record of standalone cluster %s: check the encryption key is the one it was backed up with", clusterName)
+	}
+
+	record := &sealedClusterRecord{}
+	if err = json.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("cannot parse the record of standalone cluster %s: %v", clusterName, err)
+	}
+	if record.State == nil {
+		return nil, fmt.Errorf("the record of standalone cluster %s holds no state", clusterName)
+	}
+	return record, nil
+}
+
+func newRecordCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,336 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/clientcmd"
+	crtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/constants"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+// gzipMagic starts the gzip Velero backup archives
+var gzipMagic = []byte{0x1f, 0x8b}
+
+type restoreStandaloneOptions struct {
+	fromBackup        string
+	fromFile          string
+	encryptionKeyFile string
+	recreate          bool
+	veleroNamespace   string
+	wait              bool
+	timeout           time.Duration
+}
+
+// RestoreCmd restores a standalone cluster from a Velero backup.
+var RestoreCmd = &cobra.Command{
+	Use:   "restore <cluster name> (--from-file <backup archive or record file> | --from-backup <backup name>)",
+	Short: "restore a standalone cluster from a Velero backup",
+	Args:  cobra.ExactArgs(1),
+	RunE:  restore,
+}
+
+var rso = restoreStandaloneOptions{}
+
+func init() {
+	RestoreCmd.Flags().StringVarP(&rso.fromFile, "from-file", "", "", "Velero backup archive, or record file written by backup --record-file, to restore the cluster on this machine from")
+	RestoreCmd.Flags().StringVarP(&rso.encryptionKeyFile, "encryption-key-file", "", "", "File holding the key the cluster was backed up with, to restore it from a backup archive or a record file")
+	RestoreCmd.Flags().BoolVarP(&rso.recreate, "recreate", "", false, "Create the cluster again from the backup archive or the record file, when it is gone")
+	RestoreCmd.Flags().StringVarP(&rso.fromBackup, "from-backup", "", "", "Velero backup to restore the namespaces of the cluster from")
+	RestoreCmd.Flags().StringVarP(&rso.veleroNamespace, "velero-namespace", "", defaultVeleroNamespace, "Namespace Velero is installed in")
+	RestoreCmd.Flags().BoolVarP(&rso.wait, "wait", "", true, "Wait for the restore to complete")
+	RestoreCmd.Flags().DurationVarP(&rso.timeout, "timeout", "t", defaultBackupTimeout, "Time duration to wait for the restore, or the creation of the cluster with --recreate, to complete")
+}
+
+func restore(cmd *cobra.Command, args []string) error {
+	clusterName := args[0]
+
+	switch {
+	case rso.fromFile != "" && rso.fromBackup != "":
+		return fmt.Errorf("only one of --from-file and --from-backup can be used")
+	case rso.recreate && rso.fromFile == "":
+		return fmt.Errorf("--recreate can only be used with --from-file")
+	case rso.fromFile != "":
+		return restoreFromFile(cmd, clusterName)
+	case rso.fromBackup != "":
+		return restoreFromBackup(cmd, clusterName)
+	default:
+		return fmt.Errorf("no backup specified: use --from-file or --from-backup")
+	}
+}
+
+// restoreFromFile restores a cluster on this machine from the record saved in
+// a Velero backup archive, or in a record file: its state, configuration and
+// admin kubeconfig, for it to be managed from this machine. With --recreate, a
+// cluster which is gone is created again from its configuration.
+func restoreFromFile(cmd *cobra.Command, clusterName string) error {
+	_, err := loadStandaloneClusterState(clusterName)
+	if err == nil {
+		return fmt.Errorf("standalone cluster %s already exists on this machine", clusterName)
+	}
+	if !errors.Is(err, errStandaloneClusterNotFound) {
+		return NonUsageError(cmd, err, "unable to load standalone cluster %s", clusterName)
+	}
+	if rso.encryptionKeyFile == "" {
+		return fmt.Errorf("no encryption key specified: set --encryption-key-file to the key the cluster was backed up with")
+	}
+	key, err := readEncryptionKey(rso.encryptionKeyFile)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to restore standalone cluster %s", clusterName)
+	}
+
+	record, err := readSealedClusterRecord(rso.fromFile, clusterName, key)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to read record of standalone cluster %s from %s", clusterName, rso.fromFile)
+	}
+	kubeconfig, err := clientcmd.Load(record.Kubeconfig)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to read kubeconfig of standalone cluster %s", clusterName)
+	}
+
+	// a cluster which is still running must not be created twice
+	reachErr := checkClusterReachable(record.Kubeconfig)
+	switch {
+	case rso.recreate && reachErr == nil:
+		return fmt.Errorf("standalone cluster %s is running: restore it without --recreate", clusterName)
+	case !rso.recreate && reachErr != nil:
+		return NonUsageError(cmd, reachErr, "standalone cluster %s is unreachable: if it is gone, create it again with --recreate", clusterName)
+	}
+
+	state := record.State
+	_, err = writeRestoredClusterConfig(state)
+	if err != nil {
+		return Error(err, "unable to restore configuration of standalone cluster %s", clusterName)
+	}
+	if rso.recreate {
+		return recreateStandaloneCluster(cmd, state)
+	}
+
+	err = saveStandaloneClusterState(state)
+	if err != nil {
+		return Error(err, "unable to restore state of standalone cluster %s", clusterName)
+	}
+	// the Cluster API objects of the cluster are read from its store with
+	// its kubeconfig, to scale or upgrade it from this machine
+	err = saveClusterKubeconfig(clusterName, record.Kubeconfig)
+	if err != nil {
+		return Error(err, "unable to restore kubeconfig of standalone cluster %s", clusterName)
+	}
+	err = writeKubeconfig(kubeconfig, "")
+	if err != nil {
+		return Error(err, "unable to restore kubeconfig of standalone cluster %s", clusterName)
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Standalone cluster '%s' has been restored on this machine, from which it can now be managed\n", clusterName)
+	return nil
+}
+
+// readSealedClusterRecord reads the record of a cluster from a Velero backup
+// archive or a record file, and decrypts it
+func readSealedClusterRecord(path, clusterName string, key []byte) (*sealedClusterRecord, error) {
+	secret, err := readClusterRecord(path, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	sealed, ok := secret.Data[clusterRecordSealedKey]
+	if !ok {
+		return nil, fmt.Errorf("the record of standalone cluster %s holds no credentials: it was backed up by a previous version of the plugin", clusterName)
+	}
+	return unsealClusterRecord(key, clusterName, sealed)
+}
+
+// checkClusterReachable checks the cluster of a kubeconfig answers requests
+func checkClusterReachable(kubeconfig []byte) error {
+	cfg, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	cfg.Timeout = clusterStatusTimeout
+
+	client, err := crtclient.New(cfg, crtclient.Options{})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), clusterStatusTimeout)
+	defer cancel()
+	return client.List(ctx, &corev1.NamespaceList{})
+}
+
+// recreateStandaloneCluster creates a restored cluster which is gone again,
+// from its configuration, for its namespaces to be restored in it
+func recreateStandaloneCluster(cmd *cobra.Command, state *standaloneClusterState) error {
+	log.Infof("Creating standalone cluster %s again from its restored configuration", state.Name)
+	state.CreationTime = time.Now()
+	state.Phase = createPhaseConfigured
+	state.BootstrapCluster = ""
+	err := createFromState(cmd, state, nil, rso.timeout, "")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Standalone cluster '%s' has been created again\n", state.Name)
+	fmt.Fprintf(cmd.OutOrStdout(), "Install the velero package, then run 'tanzu standalone-cluster restore %s --from-backup <backup name>'\n", state.Name)
+	return nil
+}
+
+// readClusterRecord reads the secret holding the record of a cluster from a
+// Velero backup archive, as downloaded by 'velero backup download', or from
+// the record file written by 'tanzu standalone-cluster backup --record-file'
+func readClusterRecord(path, clusterName string) (*corev1.Secret, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	if magic, peekErr := reader.Peek(len(gzipMagic)); peekErr != nil || !bytes.Equal(magic, gzipMagic) {
+		return readClusterRecordFile(reader, clusterName)
+	}
+
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("not a Velero backup archive: %v", err)
+	}
+	defer gzipReader.Close()
+
+	// resources are archived under resources/<resource>/[<version>/]namespaces/<namespace>/<name>.json
+	suffix := fmt.Sprintf("/namespaces/%s/%s%s.json", clusterRecordNamespace, clusterRecordSecretPrefix, clusterName)
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, readErr := tarReader.Next()
+		if readErr == io.EOF {
+			return nil, fmt.Errorf("the backup holds no record of standalone cluster %s: it was not made by 'tanzu standalone-cluster backup'", clusterName)
+		}
+		if readErr != nil {
+			return nil, fmt.Errorf("not a Velero backup archive: %v", readErr)
+		}
+
+		name := strings.TrimPrefix(header.Name, "./")
+		if !strings.HasPrefix(name, "resources/secrets/") || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		secret := &corev1.Secret{}
+		if decodeErr := json.NewDecoder(tarReader).Decode(secret); decodeErr != nil {
+			return nil, fmt.Errorf("cannot parse %s: %v", name, decodeErr)
+		}
+		return secret, nil
+	}
+}
+
+// readClusterRecordFile reads the record of a cluster from a record file
+func readClusterRecordFile(reader io.Reader, clusterName string) (*corev1.Secret, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{}
+	if err = yaml.Unmarshal(data, secret); err != nil || secret.Kind != "Secret" {
+		return nil, fmt.Errorf("neither a Velero backup archive nor a record file of a standalone cluster")
+	}
+	if secret.Name != clusterRecordSecretPrefix+clusterName {
+		return nil, fmt.Errorf("the record file holds the record of %s, not of standalone cluster %s", strings.TrimPrefix(secret.Name, clusterRecordSecretPrefix), clusterName)
+	}
+	return secret, nil
+}
+
+// writeRestoredClusterConfig writes the effective configuration of a restored
+// cluster, for it to be managed or created again from it
+func writeRestoredClusterConfig(state *standaloneClusterState) (string, error) {
+	path, err := getGeneratedClusterConfigPath(state.Name)
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := yaml.Marshal(state.Config)
+	if err != nil {
+		return "", err
+	}
+	log.Infof("Restoring configuration of standalone cluster at '%v'", path)
+	err = os.WriteFile(path, data, constants.ConfigFilePermissions)
+	if err != nil {
+		return "", err
+	}
+	// the configuration file the cluster was created from is not on this machine
+	state.ConfigFile = path
+	return path, nil
+}
+
+// restoreFromBackup restores the namespaces of a cluster from a Velero
+// backup, with the Velero of the cluster
+func restoreFromBackup(cmd *cobra.Command, clusterName string) error {
+	client, _, err := newStandaloneClusterClient(clusterName)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to connect to standalone cluster %s", clusterName)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rso.timeout)
+	defer cancel()
+
+	veleroBackup := &unstructured.Unstructured{}
+	veleroBackup.SetGroupVersionKind(veleroGVK("Backup"))
+	err = client.Get(ctx, crtclient.ObjectKey{Namespace: rso.veleroNamespace, Name: rso.fromBackup}, veleroBackup)
+	switch {
+	case meta.IsNoMatchError(err):
+		return NonUsageError(cmd, err, "velero is not installed: install the velero package with the backup storage location of the backup")
+	case apierrors.IsNotFound(err):
+		return NonUsageError(cmd, err, "velero backup %s not found: check the backup storage location of the backup is configured", rso.fromBackup)
+	case err != nil:
+		return NonUsageError(cmd, err, "unable to get Velero backup %s", rso.fromBackup)
+	}
+
+	veleroRestore := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"backupName": rso.fromBackup,
+			// the record of the cluster holds the credentials of the backed up
+			// cluster, not of this one
+			"excludedNamespaces": []interface{}{clusterRecordNamespace},
+		},
+	}}
+	veleroRestore.SetGroupVersionKind(veleroGVK("Restore"))
+	veleroRestore.SetNamespace(rso.veleroNamespace)
+	veleroRestore.SetName(fmt.Sprintf("%s-%s", rso.fromBackup, time.Now().UTC().Format("20060102150405")))
+	veleroRestore.SetLabels(map[string]string{standaloneClusterLabel: clusterName})
+
+	log.Infof("Restoring standalone cluster %s from Velero backup %s", clusterName, rso.fromBackup)
+	err = client.Create(ctx, veleroRestore)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to create Velero restore %s", veleroRestore.GetName())
+	}
+
+	if rso.wait {
+		err = waitForVeleroPhase(ctx, client, veleroRestore, rso.timeout)
+		if err != nil {
+			return NonUsageError(cmd, err, "Velero restore of standalone cluster %s did not complete", clusterName)
+		}
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Standalone cluster '%s' restored from backup '%s' by restore '%s'\n", clusterName, rso.fromBackup, veleroRestore.GetName())
+	return nil
+}
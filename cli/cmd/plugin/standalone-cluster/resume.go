@@ -0,0 +1,91 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/tkgctl"
+)
+
+// resume resumes the failed creation of a standalone cluster. When the
+// bootstrap cluster of the failed creation is still running, Tanzu Framework
+// reuses it, along with the Cluster API resources it already holds. Otherwise
+// the cluster is created from the start, from its recorded configuration.
+func resume(cmd *cobra.Command, clusterName string) error {
+	state, err := loadStandaloneClusterState(clusterName)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to resume standalone cluster %s", clusterName)
+	}
+	if state.created() {
+		return fmt.Errorf("standalone cluster %s was already created", clusterName)
+	}
+
+	var bootstrap bootstrapCluster
+	if state.BootstrapCluster != "" {
+		bootstrap, err = findBootstrapCluster(state.BootstrapCluster)
+		if err != nil {
+			return Error(err, "unable to find bootstrap cluster %s", state.BootstrapCluster)
+		}
+
+		if bootstrap != nil {
+			log.Infof("Resuming creation of standalone cluster %s from phase '%s' with bootstrap cluster %s", clusterName, state.Phase, state.BootstrapCluster)
+		} else {
+			log.Warningf("bootstrap cluster %s not found: creating standalone cluster %s from the start", state.BootstrapCluster, clusterName)
+			state.BootstrapCluster = ""
+			state.Phase = createPhaseConfigured
+		}
+	}
+
+	return createFromState(cmd, state, bootstrap, iso.timeout, iso.outputEvents)
+}
+
+// createFromState creates a standalone cluster from the configuration recorded
+// in its state, with the bootstrap cluster of a previous creation if any
+func createFromState(cmd *cobra.Command, state *standaloneClusterState, bootstrap bootstrapCluster, timeout time.Duration, outputEvents string) error {
+	configFile, cleanup, err := state.writeClusterConfigFile()
+	if err != nil {
+		return Error(err, "unable to load standalone cluster configuration")
+	}
+	defer cleanup()
+
+	initRegionOpts := tkgctl.InitRegionOptions{
+		ClusterConfigFile:      configFile,
+		ClusterName:            state.Name,
+		Plan:                   defaultPlan,
+		InfrastructureProvider: state.InfrastructureProvider,
+		Edition:                BuildEdition,
+		Timeout:                timeout,
+		CeipOptIn:              "false",
+	}
+
+	state.Status = createStatusCreating
+	state.Error = ""
+	err = saveStandaloneClusterState(state)
+	if err != nil {
+		return Error(err, "failed to store standalone cluster state")
+	}
+
+	return runWithEvents(cmd.OutOrStdout(), outputEvents, operationCreate, state.Name, func() error {
+		c, clientErr := newTKGCtlClient(false)
+		if clientErr != nil {
+			return NonUsageError(cmd, clientErr, "unable to create Tanzu Standalone Cluster client")
+		}
+
+		if initErr := initStandalone(c, initRegionOpts, state, bootstrap); initErr != nil {
+			return Error(initErr, "failed to create standalone cluster.")
+		}
+
+		return runPhase(phaseSaveState, func() error {
+			if saveErr := completeStandaloneClusterCreation(state); saveErr != nil {
+				return Error(saveErr, "failed to store standalone cluster state")
+			}
+			return nil
+		})
+	})
+}
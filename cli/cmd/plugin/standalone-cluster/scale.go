@@ -0,0 +1,103 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	crtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+const defaultScaleTimeout = 30 * time.Minute
+
+type scaleStandaloneOptions struct {
+	workerMachineCount int
+	timeout            time.Duration
+}
+
+// ScaleCmd scales the workers of a standalone cluster.
+var ScaleCmd = &cobra.Command{
+	Use:   "scale <cluster name>",
+	Short: "scale the workers of a standalone cluster",
+	Args:  cobra.ExactArgs(1),
+	RunE:  scale,
+}
+
+var sso = scaleStandaloneOptions{}
+
+func init() {
+	ScaleCmd.Flags().IntVarP(&sso.workerMachineCount, "worker-machine-count", "w", 0, "Number of worker machines of the cluster")
+	ScaleCmd.Flags().DurationVarP(&sso.timeout, "timeout", "t", defaultScaleTimeout, "Time duration to wait for the workers to be scaled")
+}
+
+// scale sets the number of workers of a standalone cluster. Cluster API scales
+// the cluster from a bootstrap cluster its Cluster API objects are moved to,
+// which is deleted once the workers are ready and the objects moved back.
+func scale(cmd *cobra.Command, args []string) error {
+	clusterName := args[0]
+	if sso.workerMachineCount < 1 {
+		return fmt.Errorf("invalid worker machine count %d: set --worker-machine-count to at least 1", sso.workerMachineCount)
+	}
+
+	state, err := loadStandaloneClusterState(clusterName)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to load standalone cluster %s", clusterName)
+	}
+	if !state.created() {
+		return fmt.Errorf("the creation of standalone cluster %s did not complete: resume it or clean it up before scaling it", clusterName)
+	}
+
+	err = manageStandaloneCluster(state, sso.timeout, func(ctx context.Context, client crtclient.Client) error {
+		log.Infof("Scaling the workers of standalone cluster %s to %d machines", clusterName, sso.workerMachineCount)
+		return scaleMachineDeployments(ctx, client, clusterName, sso.workerMachineCount, sso.timeout)
+	})
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to scale standalone cluster %s", clusterName)
+	}
+
+	state.Config["WORKER_MACHINE_COUNT"] = sso.workerMachineCount
+	err = saveStandaloneClusterState(state)
+	if err != nil {
+		return Error(err, "failed to store standalone cluster state")
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Standalone cluster '%s' scaled to %d workers\n", clusterName, sso.workerMachineCount)
+	return nil
+}
+
+// scaleMachineDeployments spreads the workers of a cluster across its machine
+// deployments, of which the prod plan of some providers has one per
+// availability zone, then waits for the machines to be ready
+func scaleMachineDeployments(ctx context.Context, client crtclient.Client, clusterName string, workers int, timeout time.Duration) error {
+	deployments, err := listClusterObjects(ctx, client, machineDeploymentListGVK, clusterName)
+	if err != nil {
+		return err
+	}
+	if len(deployments) == 0 {
+		return fmt.Errorf("no machine deployment found for cluster %s", clusterName)
+	}
+
+	for i := range deployments {
+		replicas := workers / len(deployments)
+		if i < workers%len(deployments) {
+			replicas++
+		}
+		patch := crtclient.MergeFrom(deployments[i].DeepCopy())
+		if err = unstructured.SetNestedField(deployments[i].Object, int64(replicas), "spec", "replicas"); err != nil {
+			return err
+		}
+		if err = client.Patch(ctx, &deployments[i], patch); err != nil {
+			return fmt.Errorf("cannot scale machine deployment %s: %v", deployments[i].GetName(), err)
+		}
+	}
+
+	log.Infof("Waiting for the workers of cluster %s to be ready", clusterName)
+	return waitForRollout(ctx, client, machineDeploymentListGVK, clusterName, timeout)
+}
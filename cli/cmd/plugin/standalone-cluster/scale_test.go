@@ -0,0 +1,71 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// newMachineDeployment returns a machine deployment of a cluster whose status
+// reports replicas ready machines
+func newMachineDeployment(clusterName, name string, replicas int64) *unstructured.Unstructured {
+	deployment := newObject(machineDeploymentListGVK.GroupVersion().WithKind("MachineDeployment"), "default", name, map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": int64(1),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"version": "v1.21.2+vmware.1",
+					"infrastructureRef": map[string]interface{}{
+						"apiVersion": "infrastructure.cluster.x-k8s.io/v1alpha3",
+						"kind":       "DockerMachineTemplate",
+						"name":       name,
+					},
+				},
+			},
+		},
+		"status": map[string]interface{}{
+			"replicas":        replicas,
+			"updatedReplicas": replicas,
+			"readyReplicas":   replicas,
+		},
+	})
+	deployment.SetLabels(map[string]string{clusterNameLabel: clusterName})
+	return deployment
+}
+
+func TestScaleMachineDeployments(t *testing.T) {
+	client := newFakeClient(t,
+		newMachineDeployment("test", "test-md-0", 2),
+		newMachineDeployment("test", "test-md-1", 1),
+		newMachineDeployment("other", "other-md-0", 1),
+	)
+
+	if err := scaleMachineDeployments(context.Background(), client, "test", 3, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int64{"test-md-0": 2, "test-md-1": 1, "other-md-0": 1}
+	for name, replicas := range want {
+		deployment := &unstructured.Unstructured{}
+		deployment.SetGroupVersionKind(machineDeploymentListGVK.GroupVersion().WithKind("MachineDeployment"))
+		if err := client.Get(context.Background(), objectKey("default", name), deployment); err != nil {
+			t.Fatal(err)
+		}
+		if got, _, _ := unstructured.NestedInt64(deployment.Object, "spec", "replicas"); got != replicas {
+			t.Errorf("expected %d replicas for %s, got %d", replicas, name, got)
+		}
+	}
+}
+
+func TestScaleMachineDeploymentsWithoutDeployment(t *testing.T) {
+	client := newFakeClient(t, newMachineDeployment("other", "other-md-0", 1))
+
+	if err := scaleMachineDeployments(context.Background(), client, "test", 3, time.Second); err == nil {
+		t.Fatal("expected an error for a cluster without machine deployment")
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/constants"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+const (
+	stateDirName = "standalone-clusters"
+
+	// statuses of the creation of a standalone cluster. Clusters created by
+	// previous versions of the plugin have no status and are created.
+	createStatusCreating = "creating"
+	createStatusFailed   = "failed"
+	createStatusCreated  = "created"
+
+	// phases of the creation of a standalone cluster, as checkpointed in its state
+	createPhaseConfigured       = "configured"
+	createPhaseBootstrapCreated = "bootstrap-cluster-created"
+	createPhaseCreated          = "created"
+
+	defaultInfrastructureProvider = "docker"
+)
+
+var errStandaloneClusterNotFound = errors.New("standalone cluster not found")
+
+// standaloneClusterState is the record of a standalone cluster created from
+// this machine, used by the lifecycle commands once the bootstrap cluster is gone.
+type standaloneClusterState struct {
+	Name                   string    `json:"name"`
+	InfrastructureProvider string    `json:"infrastructureProvider"`
+	Plan                   string    `json:"plan"`
+	CreationTime           time.Time `json:"creationTime"`
+	PluginVersion          string    `json:"pluginVersion"`
+	// ConfigFile is the configuration file the cluster was created from, if any
+	ConfigFile string `json:"configFile,omitempty"`
+	// Config is the effective cluster configuration, with defaults applied
+	Config map[string]interface{} `json:"config"`
+
+	// Status is the status of the creation of the cluster, and Phase its last
+	// completed phase
+	Status string `json:"status,omitempty"`
+	Phase  string `json:"phase,omitempty"`
+	// BootstrapCluster is the kind cluster left by a failed creation, or
+	// holding the Cluster API objects of the cluster when they could not be
+	// moved to the cluster
+	BootstrapCluster string `json:"bootstrapCluster,omitempty"`
+	// Error is the error which failed the creation
+	Error string `json:"error,omitempty"`
+
+	path string
+}
+
+func getStateDir() (string, error) {
+	configDir, err := getTKGConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, stateDirName), nil
+}
+
+// newStandaloneClusterState builds the state of a cluster created with the
+// provided options. The effective configuration is made of the configuration
+// file and the options of the create command.
+func newStandaloneClusterState(clusterName string, options *initStandaloneOptions, creationTime time.Time) (*standaloneClusterState, error) {
+	config, err := resolveClusterConfig(clusterName, options)
+	if err != nil {
+		return nil, err
+	}
+
+	configFile := options.clusterConfigFile
+	if configFile != "" {
+		if abs, err := filepath.Abs(configFile); err == nil {
+			configFile = abs
+		}
+	}
+
+	return &standaloneClusterState{
+		Name:                   clusterName,
+		InfrastructureProvider: configValue(config, "INFRASTRUCTURE_PROVIDER"),
+		Plan:                   configValue(config, "CLUSTER_PLAN"),
+		CreationTime:           creationTime.UTC(),
+		PluginVersion:          descriptor.Version,
+		ConfigFile:             configFile,
+		Config:                 config,
+	}, nil
+}
+
+// resolveClusterConfig merges the configuration file and the options of the
+// create command, and applies the plugin defaults
+func resolveClusterConfig(clusterName string, options *initStandaloneOptions) (map[string]interface{}, error) {
+	config := make(map[string]interface{})
+	if options.clusterConfigFile != "" {
+		if err := readClusterConfig(options.clusterConfigFile, config); err != nil {
+			return nil, err
+		}
+	}
+
+	config["CLUSTER_NAME"] = clusterName
+	if options.infrastructureProvider != "" {
+		config["INFRASTRUCTURE_PROVIDER"] = options.infrastructureProvider
+	}
+	if configValue(config, "INFRASTRUCTURE_PROVIDER") == "" {
+		config["INFRASTRUCTURE_PROVIDER"] = defaultInfrastructureProvider
+	}
+	if configValue(config, "CLUSTER_PLAN") == "" {
+		config["CLUSTER_PLAN"] = defaultPlan
+	}
+	return config, nil
+}
+
+// created returns whether the creation of the cluster completed
+func (s *standaloneClusterState) created() bool {
+	return s.Status == "" || s.Status == createStatusCreated
+}
+
+// getGeneratedClusterConfigPath returns the path of the cluster configuration
+// generated by Tanzu Framework while creating a standalone cluster
+func getGeneratedClusterConfigPath(clusterName string) (string, error) {
+	configDir, err := getTKGConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "configs", clusterName+"_ClusterConfig"), nil
+}
+
+// readClusterConfig merges the values of a cluster configuration file into config
+func readClusterConfig(path string, config map[string]interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read cluster config file: %v", err)
+	}
+
+	values := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("cannot parse cluster config file %s: %v", path, err)
+	}
+	for k, v := range values {
+		config[k] = v
+	}
+	return nil
+}
+
+func saveStandaloneClusterState(state *standaloneClusterState) error {
+	stateDir, err := getStateDir()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(stateDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	state.path = filepath.Join(stateDir, state.Name+".yaml")
+	log.Infof("Saving state of standalone cluster at '%v'", state.path)
+	err = os.WriteFile(state.path, data, constants.ConfigFilePermissions)
+	if err != nil {
+		return fmt.Errorf("cannot write state file for standalone cluster: %v", err)
+	}
+
+	return nil
+}
+
+// loadStandaloneClusterState reads the state of a standalone cluster. Clusters
+// created by previous versions of the plugin have no state file: their state
+// is built from the saved cluster configuration, when there is one.
+func loadStandaloneClusterState(clusterName string) (*standaloneClusterState, error) {
+	stateDir, err := getStateDir()
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(stateDir, clusterName+".yaml")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return loadLegacyStandaloneClusterState(clusterName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read state file for standalone cluster: %v", err)
+	}
+
+	state := &standaloneClusterState{}
+	if err := yaml.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("cannot parse state file %s: %v", path, err)
+	}
+	state.path = path
+	return state, nil
+}
+
+func loadLegacyStandaloneClusterState(clusterName string) (*standaloneClusterState, error) {
+	clusterConfigsDir, err := getClusterConfigsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(clusterConfigsDir, clusterName+".yaml")
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", errStandaloneClusterNotFound, clusterName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]interface{})
+	if err := readClusterConfig(path, config); err != nil {
+		return nil, err
+	}
+
+	return &standaloneClusterState{
+		Name:                   clusterName,
+		InfrastructureProvider: defaultIfEmpty(configValue(config, "INFRASTRUCTURE_PROVIDER"), defaultInfrastructureProvider),
+		Plan:                   configValue(config, "CLUSTER_PLAN"),
+		CreationTime:           info.ModTime().UTC(),
+		ConfigFile:             path,
+		Config:                 config,
+		path:                   path,
+	}, nil
+}
+
+// listStandaloneClusterNames returns the names of the standalone clusters
+// which have a state file or, for clusters created by previous versions of
+// the plugin, a saved cluster configuration
+func listStandaloneClusterNames() ([]string, error) {
+	stateDir, err := getStateDir()
+	if err != nil {
+		return nil, err
+	}
+	clusterConfigsDir, err := getClusterConfigsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, dir := range []string{stateDir, clusterConfigsDir} {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
+				continue
+			}
+			name := strings.TrimSuffix(entry.Name(), ".yaml")
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// writeClusterConfigFile writes the effective cluster configuration of the
+// state to a temporary file, to be used by Tanzu Framework. The returned
+// function removes the file.
+func (s *standaloneClusterState) writeClusterConfigFile() (string, func(), error) {
+	configDir, err := getTKGConfigDir()
+	if err != nil {
+		return "", nil, err
+	}
+
+	data, err := yaml.Marshal(s.Config)
+	if err != nil {
+		return "", nil, err
+	}
+
+	file, err := os.CreateTemp(configDir, s.Name+"-*.yaml")
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	cleanup := func() {
+		if err := os.Remove(file.Name()); err != nil && !os.IsNotExist(err) {
+			log.Warningf("could not remove temporary cluster config file '%v': %v", file.Name(), err)
+		}
+	}
+
+	if _, err := file.Write(data); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return file.Name(), cleanup, nil
+}
+
+// removeStandaloneClusterState removes the state file of a standalone cluster
+// and its kubeconfig, along with the cluster configuration saved by
+// previous versions of the plugin
+func removeStandaloneClusterState(clusterName string) error {
+	stateDir, err := getStateDir()
+	if err != nil {
+		return err
+	}
+	clusterConfigsDir, err := getClusterConfigsDir()
+	if err != nil {
+		return err
+	}
+	kubeconfigPath, err := getClusterKubeconfigPath(clusterName)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range []string{
+		filepath.Join(stateDir, clusterName+".yaml"),
+		kubeconfigPath,
+		filepath.Join(clusterConfigsDir, clusterName+".yaml"),
+	} {
+		log.Infof("Removing state of standalone cluster at '%v'", path)
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not delete file: %v", path)
+		}
+	}
+
+	return nil
+}
@@ -1,23 +1,44 @@
 // Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
+// The CLI tests of the standalone-cluster plugin. They run against the plugin
+// built with the clitest build tag, which creates and deletes clusters with a
+// fake Tanzu Framework client, for the tests to run without Docker:
+//
+//	GOFLAGS=-tags=clitest make build-install-plugins-local
+//	tanzu test plugin standalone-cluster
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/cli"
 	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/cli/command/plugin"
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/config"
 	clitest "github.com/vmware-tanzu/tanzu-framework/pkg/v1/test/cli"
 )
 
-var pluginName = "package"
+var pluginName = "standalone-cluster"
 
 var descriptor = cli.NewTestFor(pluginName)
 
+// fakeFailureEnv is the environment variable holding the error the fake
+// Tanzu Framework client of the plugin fails its operations with
+const fakeFailureEnv = "STANDALONE_CLUSTER_FAKE_FAILURE"
+
+// names of the clusters created by the tests, removed by Cleanup
+var clusterNames []string
+
+// the temporary directory of the configuration files of the tests
+var workDir string
+
 func main() {
 	p, err := plugin.NewPlugin(descriptor)
 	if err != nil {
@@ -32,24 +53,364 @@ func main() {
 func test(c *cobra.Command, _ []string) error {
 	m := clitest.NewMain(pluginName, c, Cleanup)
 	defer m.Finish()
-	// TODO: setup test
 
+	var err error
+	workDir, err = os.MkdirTemp("", "standalone-cluster-test-")
+	if err != nil {
+		return err
+	}
+
+	for _, suite := range []func(*clitest.Main) error{
+		testArguments,
+		testCreateAndDelete,
+		testFailures,
+		testDeleteUICluster,
+	} {
+		if suiteErr := suite(m); suiteErr != nil {
+			return suiteErr
+		}
+	}
+	return nil
+}
+
+// testArguments checks the validation of the arguments of create and delete
+func testArguments(m *clitest.Main) error {
 	err := m.RunTest(
-		"list package",
-		"package list -o json",
+		"create without cluster name",
+		"standalone-cluster create",
 		func(t *clitest.Test) error {
-			// TODO: do some work...
-			return nil
+			return t.ExecContainsErrorString("no cluster name specified")
 		},
 	)
 	if err != nil {
 		return err
 	}
 
+	err = m.RunTest(
+		"create with unsupported events format",
+		"standalone-cluster create test-events --output-events xml",
+		func(t *clitest.Test) error {
+			return t.ExecContainsErrorString(`unsupported events format "xml"`)
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = m.RunTest(
+		"create with invalid dry run output format",
+		"standalone-cluster create test-output --dry-run -o table",
+		func(t *clitest.Test) error {
+			return t.ExecContainsErrorString(`unsupported output format "table"`)
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = m.RunTest(
+		"restore without encryption key",
+		"standalone-cluster restore test-restore --from-file test-restore-data.tar.gz",
+		func(t *clitest.Test) error {
+			return t.ExecContainsErrorString("no encryption key specified")
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return m.RunTest(
+		"delete without cluster name",
+		"standalone-cluster delete",
+		func(t *clitest.Test) error {
+			return t.ExecContainsErrorString("no cluster name specified")
+		},
+	)
+}
+
+// testCreateAndDelete checks the configuration of a cluster is saved when it
+// is created, loaded to delete it, then removed
+func testCreateAndDelete(m *clitest.Main) error {
+	name := generateClusterName()
+	configFile, err := writeClusterConfigFile(name)
+	if err != nil {
+		return err
+	}
+
+	err = m.RunTest(
+		"create cluster",
+		fmt.Sprintf("standalone-cluster create %s -f %s --skip-preflight", name, configFile),
+		func(t *clitest.Test) error {
+			if _, _, execErr := t.Exec(); execErr != nil {
+				return execErr
+			}
+			if checkErr := checkStateContains(name, "status: created"); checkErr != nil {
+				return checkErr
+			}
+			if checkErr := checkFileExists(clusterKubeconfigPath(name), true); checkErr != nil {
+				return checkErr
+			}
+			return checkFileExists(generatedClusterConfigPath(name), true)
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = m.RunTest(
+		"create existing cluster",
+		fmt.Sprintf("standalone-cluster create %s -f %s --skip-preflight", name, configFile),
+		func(t *clitest.Test) error {
+			if execErr := t.ExecContainsErrorString(fmt.Sprintf("standalone cluster %s already exists", name)); execErr != nil {
+				return execErr
+			}
+			return checkStateContains(name, "status: created")
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = m.RunTest(
+		"list clusters",
+		"standalone-cluster list -o json",
+		func(t *clitest.Test) error {
+			return t.ExecContainsString(fmt.Sprintf("%q", name))
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = m.RunTest(
+		"dry run of created cluster",
+		fmt.Sprintf("standalone-cluster create %s -f %s --dry-run", name, configFile),
+		func(t *clitest.Test) error {
+			return t.ExecContainsString("CLUSTER_NAME: " + name)
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = m.RunTest(
+		"dry run renders manifests",
+		fmt.Sprintf("standalone-cluster create %s -f %s --dry-run", name, configFile),
+		func(t *clitest.Test) error {
+			return t.ExecContainsString("kind: Cluster")
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = m.RunTest(
+		"scale cluster without worker count",
+		fmt.Sprintf("standalone-cluster scale %s", name),
+		func(t *clitest.Test) error {
+			return t.ExecContainsErrorString("invalid worker machine count 0")
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = m.RunTest(
+		"upgrade cluster to unknown TKr",
+		fmt.Sprintf("standalone-cluster upgrade %s --tkr v0.0.0---unknown", name),
+		func(t *clitest.Test) error {
+			return t.ExecContainsErrorString("no BoM of Tanzu Kubernetes release v0.0.0---unknown")
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = m.RunTest(
+		"back up cluster without encryption key",
+		fmt.Sprintf("standalone-cluster backup %s", name),
+		func(t *clitest.Test) error {
+			return t.ExecContainsErrorString("no encryption key specified")
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return m.RunTest(
+		"delete cluster",
+		fmt.Sprintf("standalone-cluster delete %s -y", name),
+		func(t *clitest.Test) error {
+			if _, _, execErr := t.Exec(); execErr != nil {
+				return execErr
+			}
+			if checkErr := checkFileExists(statePath(name), false); checkErr != nil {
+				return checkErr
+			}
+			if checkErr := checkFileExists(clusterKubeconfigPath(name), false); checkErr != nil {
+				return checkErr
+			}
+			return checkFileExists(generatedClusterConfigPath(name), false)
+		},
+	)
+}
+
+// testFailures checks the errors of failed operations are formatted with
+// their cause, and that failed creations are recorded
+func testFailures(m *clitest.Main) error {
+	name := generateClusterName()
+	configFile, err := writeClusterConfigFile(name)
+	if err != nil {
+		return err
+	}
+
+	os.Setenv(fakeFailureEnv, "fake creation failure")
+	err = m.RunTest(
+		"create cluster failure",
+		fmt.Sprintf("standalone-cluster create %s -f %s --skip-preflight", name, configFile),
+		func(t *clitest.Test) error {
+			if execErr := t.ExecContainsErrorString("failed to initialize standalone cluster.\nCause: fake creation failure"); execErr != nil {
+				return execErr
+			}
+			return checkStateContains(name, "status: failed")
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = m.RunTest(
+		"create cluster after failure",
+		fmt.Sprintf("standalone-cluster create %s -f %s --skip-preflight", name, configFile),
+		func(t *clitest.Test) error {
+			return t.ExecContainsErrorString(fmt.Sprintf("a previous creation of standalone cluster %s did not complete", name))
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	os.Setenv(fakeFailureEnv, "fake deletion failure")
+	err = m.RunTest(
+		"delete cluster failure",
+		fmt.Sprintf("standalone-cluster delete %s -y", name),
+		func(t *clitest.Test) error {
+			if execErr := t.ExecContainsErrorString("standalone cluster deletion failed\nCause: fake deletion failure"); execErr != nil {
+				return execErr
+			}
+			return checkFileExists(statePath(name), true)
+		},
+	)
+	os.Unsetenv(fakeFailureEnv)
+	if err != nil {
+		return err
+	}
+
+	return m.RunTest(
+		"delete failed cluster",
+		fmt.Sprintf("standalone-cluster delete %s -y", name),
+		func(t *clitest.Test) error {
+			if _, _, execErr := t.Exec(); execErr != nil {
+				return execErr
+			}
+			return checkFileExists(statePath(name), false)
+		},
+	)
+}
+
+// testDeleteUICluster checks the cluster configuration saved by the
+// Kickstart UI is loaded to delete a cluster, then removed
+func testDeleteUICluster(m *clitest.Main) error {
+	name := generateClusterName()
+	path := uiClusterConfigPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(fmt.Sprintf("CLUSTER_NAME: %s\n", name)), 0600); err != nil {
+		return err
+	}
+
+	return m.RunTest(
+		"delete cluster created from the UI",
+		fmt.Sprintf("standalone-cluster delete %s -y", name),
+		func(t *clitest.Test) error {
+			if _, _, execErr := t.Exec(); execErr != nil {
+				return execErr
+			}
+			return checkFileExists(path, false)
+		},
+	)
+}
+
+func generateClusterName() string {
+	name := fmt.Sprintf("standalone-test-%d-%d", time.Now().Unix(), len(clusterNames))
+	clusterNames = append(clusterNames, name)
+	return name
+}
+
+func writeClusterConfigFile(clusterName string) (string, error) {
+	path := filepath.Join(workDir, clusterName+".yaml")
+	data := fmt.Sprintf("CLUSTER_NAME: %s\nCLUSTER_PLAN: dev\nINFRASTRUCTURE_PROVIDER: docker\n", clusterName)
+	return path, os.WriteFile(path, []byte(data), 0600)
+}
+
+func tanzuConfigPath(elem ...string) string {
+	dir, err := config.LocalDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return filepath.Join(append([]string{dir}, elem...)...)
+}
+
+func statePath(clusterName string) string {
+	return tanzuConfigPath("tkg", "standalone-clusters", clusterName+".yaml")
+}
+
+func clusterKubeconfigPath(clusterName string) string {
+	return tanzuConfigPath("tkg", "standalone-clusters", clusterName+".kubeconfig")
+}
+
+func generatedClusterConfigPath(clusterName string) string {
+	return tanzuConfigPath("tkg", "configs", clusterName+"_ClusterConfig")
+}
+
+func uiClusterConfigPath(clusterName string) string {
+	return tanzuConfigPath("clusterconfigs", clusterName+".yaml")
+}
+
+func checkFileExists(path string, exists bool) error {
+	_, err := os.Stat(path)
+	switch {
+	case exists && err != nil:
+		return fmt.Errorf("expected %s to exist: %v", path, err)
+	case !exists && err == nil:
+		return fmt.Errorf("expected %s to be removed", path)
+	}
+	return nil
+}
+
+func checkStateContains(clusterName, contains string) error {
+	data, err := os.ReadFile(statePath(clusterName))
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(data), contains) {
+		return fmt.Errorf("expected state of cluster %s to contain %q:\n%s", clusterName, contains, data)
+	}
 	return nil
 }
 
 // Cleanup the test.
 func Cleanup() error {
+	for _, name := range clusterNames {
+		for _, path := range []string{statePath(name), clusterKubeconfigPath(name), generatedClusterConfigPath(name), uiClusterConfigPath(name)} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	if workDir != "" {
+		return os.RemoveAll(workDir)
+	}
 	return nil
 }
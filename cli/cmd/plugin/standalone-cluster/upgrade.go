@@ -0,0 +1,292 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	crtclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/vmware-tanzu/tanzu-framework/pkg/v1/tkg/log"
+)
+
+const (
+	defaultUpgradeTimeout = 60 * time.Minute
+
+	// tkrLabel labels a Cluster API cluster with its Tanzu Kubernetes release
+	tkrLabel = "tanzuKubernetesRelease"
+)
+
+// upgradedTemplateSuffixRegexp matches the suffix of the machine templates
+// cloned by an upgrade
+var upgradedTemplateSuffixRegexp = regexp.MustCompile(`-tkr-[0-9]+$`)
+
+type upgradeStandaloneOptions struct {
+	tkr          string
+	machineImage string
+	timeout      time.Duration
+}
+
+// UpgradeCmd upgrades a standalone cluster to a Tanzu Kubernetes release.
+var UpgradeCmd = &cobra.Command{
+	Use:   "upgrade <cluster name>",
+	Short: "upgrade a standalone cluster to a Tanzu Kubernetes release",
+	Args:  cobra.ExactArgs(1),
+	RunE:  upgrade,
+}
+
+var uso = upgradeStandaloneOptions{}
+
+func init() {
+	UpgradeCmd.Flags().StringVarP(&uso.tkr, "tkr", "", "", "Tanzu Kubernetes release to upgrade the cluster to")
+	UpgradeCmd.Flags().StringVarP(&uso.machineImage, "machine-image", "", "", "Machine image of the Tanzu Kubernetes release: the kind node image on Docker, the AMI ID on AWS, the VM template on vSphere (default image of the release BoM)")
+	UpgradeCmd.Flags().DurationVarP(&uso.timeout, "timeout", "t", defaultUpgradeTimeout, "Time duration to wait for the machines of the cluster to be upgraded")
+}
+
+// kubernetesRelease is the part of a Tanzu Kubernetes release a cluster is
+// upgraded to
+type kubernetesRelease struct {
+	name              string
+	kubernetesVersion string
+	machineImage      string
+	etcdImageTag      string
+	corednsImageTag   string
+}
+
+// upgrade upgrades a standalone cluster to a Tanzu Kubernetes release. Cluster
+// API replaces the machines of the cluster from a bootstrap cluster its
+// Cluster API objects are moved to, which is deleted once the machines are
+// ready and the objects moved back.
+func upgrade(cmd *cobra.Command, args []string) error {
+	clusterName := args[0]
+	if uso.tkr == "" {
+		return fmt.Errorf("no Tanzu Kubernetes release specified: set --tkr")
+	}
+
+	state, err := loadStandaloneClusterState(clusterName)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to load standalone cluster %s", clusterName)
+	}
+	if !state.created() {
+		return fmt.Errorf("the creation of standalone cluster %s did not complete: resume it or clean it up before upgrading it", clusterName)
+	}
+
+	release, err := readKubernetesRelease(uso.tkr, state, uso.machineImage)
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to upgrade standalone cluster %s", clusterName)
+	}
+
+	err = manageStandaloneCluster(state, uso.timeout, func(ctx context.Context, client crtclient.Client) error {
+		return upgradeCluster(ctx, client, clusterName, release, uso.timeout)
+	})
+	if err != nil {
+		return NonUsageError(cmd, err, "unable to upgrade standalone cluster %s", clusterName)
+	}
+
+	state.Config["KUBERNETES_VERSION"] = release.kubernetesVersion
+	err = saveStandaloneClusterState(state)
+	if err != nil {
+		return Error(err, "failed to store standalone cluster state")
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Standalone cluster '%s' upgraded to Tanzu Kubernetes release '%s', Kubernetes %s\n", clusterName, release.name, release.kubernetesVersion)
+	return nil
+}
+
+// readKubernetesRelease reads a Tanzu Kubernetes release from its BoM, with
+// the machine image of the infrastructure provider of a cluster, unless one is
+// provided
+func readKubernetesRelease(tkr string, state *standaloneClusterState, machineImage string) (*kubernetesRelease, error) {
+	if state.InfrastructureProvider == "azure" {
+		return nil, fmt.Errorf("upgrading standalone clusters on azure is not supported")
+	}
+
+	path, err := getTKRBoMPath(tkr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("no BoM of Tanzu Kubernetes release %s: %s was not downloaded by Tanzu Framework", tkr, path)
+	}
+	content, err := readBoM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	release := &kubernetesRelease{
+		name:              tkr,
+		kubernetesVersion: content.componentVersion(kubernetesComponent),
+		machineImage:      machineImage,
+		etcdImageTag:      content.imageTag("etcd", "etcd"),
+		corednsImageTag:   content.imageTag("coredns", "coredns"),
+	}
+	if release.kubernetesVersion == "" {
+		return nil, fmt.Errorf("no Kubernetes version found in BoM %s", path)
+	}
+
+	if release.machineImage == "" {
+		switch state.InfrastructureProvider {
+		case "docker":
+			release.machineImage = content.image(kindComponent, kindNodeImage)
+		case "aws":
+			if amis := content.AMI[configValue(state.Config, "AWS_REGION")]; len(amis) > 0 {
+				release.machineImage = amis[0].ID
+			}
+		}
+	}
+	if release.machineImage == "" {
+		return nil, fmt.Errorf("no machine image of Tanzu Kubernetes release %s found for infrastructure provider %s: set --machine-image", tkr, state.InfrastructureProvider)
+	}
+	return release, nil
+}
+
+// upgradeCluster rolls the machines of a cluster out to a Tanzu Kubernetes
+// release, the control plane first, then the workers. The infrastructure
+// machine templates, which cannot be updated, are cloned with the machine
+// image of the release.
+func upgradeCluster(ctx context.Context, client crtclient.Client, clusterName string, release *kubernetesRelease, timeout time.Duration) error {
+	controlPlanes, err := listClusterObjects(ctx, client, kubeadmControlPlaneListGVK, clusterName)
+	if err != nil {
+		return err
+	}
+	if len(controlPlanes) != 1 {
+		return fmt.Errorf("found %d control planes for cluster %s", len(controlPlanes), clusterName)
+	}
+
+	log.Infof("Upgrading the control plane of cluster %s to Kubernetes %s", clusterName, release.kubernetesVersion)
+	err = upgradeMachines(ctx, client, &controlPlanes[0], release, []string{"spec", "version"}, []string{"spec", "infrastructureTemplate"})
+	if err != nil {
+		return err
+	}
+	if err = waitForRollout(ctx, client, kubeadmControlPlaneListGVK, clusterName, timeout); err != nil {
+		return fmt.Errorf("control plane of cluster %s not upgraded: %v", clusterName, err)
+	}
+
+	deployments, err := listClusterObjects(ctx, client, machineDeploymentListGVK, clusterName)
+	if err != nil {
+		return err
+	}
+	log.Infof("Upgrading the workers of cluster %s to Kubernetes %s", clusterName, release.kubernetesVersion)
+	for i := range deployments {
+		err = upgradeMachines(ctx, client, &deployments[i], release,
+			[]string{"spec", "template", "spec", "version"}, []string{"spec", "template", "spec", "infrastructureRef"})
+		if err != nil {
+			return err
+		}
+	}
+	if err = waitForRollout(ctx, client, machineDeploymentListGVK, clusterName, timeout); err != nil {
+		return fmt.Errorf("workers of cluster %s not upgraded: %v", clusterName, err)
+	}
+
+	clusters, err := findClusterAPIClusters(ctx, client, clusterName)
+	if err != nil {
+		return err
+	}
+	for i := range clusters {
+		patch := crtclient.MergeFrom(clusters[i].DeepCopy())
+		labels := clusters[i].GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[tkrLabel] = release.name
+		clusters[i].SetLabels(labels)
+		if err = client.Patch(ctx, &clusters[i], patch); err != nil {
+			return fmt.Errorf("cannot label cluster %s with its Tanzu Kubernetes release: %v", clusterName, err)
+		}
+	}
+	return nil
+}
+
+// upgradeMachines sets the Kubernetes version of a control plane or of a
+// machine deployment, and its infrastructure template to a clone with the
+// machine image of the release. The etcd and CoreDNS images of a control plane
+// are upgraded along with Kubernetes.
+func upgradeMachines(ctx context.Context, client crtclient.Client, object *unstructured.Unstructured, release *kubernetesRelease, versionField, templateField []string) error {
+	ref, found, err := unstructured.NestedStringMap(object.Object, templateField...)
+	if err != nil || !found {
+		return fmt.Errorf("no infrastructure template found for %s %s", object.GetKind(), object.GetName())
+	}
+	clone, err := cloneMachineTemplate(ctx, client, object.GetNamespace(), ref, release.machineImage)
+	if err != nil {
+		return err
+	}
+
+	patch := crtclient.MergeFrom(object.DeepCopy())
+	if err = unstructured.SetNestedField(object.Object, release.kubernetesVersion, versionField...); err != nil {
+		return err
+	}
+	if err = unstructured.SetNestedStringMap(object.Object, clone, templateField...); err != nil {
+		return err
+	}
+
+	imageTags := []struct {
+		tag   string
+		field []string
+	}{
+		{release.etcdImageTag, []string{"spec", "kubeadmConfigSpec", "clusterConfiguration", "etcd", "local", "imageTag"}},
+		{release.corednsImageTag, []string{"spec", "kubeadmConfigSpec", "clusterConfiguration", "dns", "imageTag"}},
+	}
+	for _, imageTag := range imageTags {
+		if _, found, _ := unstructured.NestedString(object.Object, imageTag.field...); found && imageTag.tag != "" {
+			if err = unstructured.SetNestedField(object.Object, imageTag.tag, imageTag.field...); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = client.Patch(ctx, object, patch); err != nil {
+		return fmt.Errorf("cannot upgrade %s %s: %v", object.GetKind(), object.GetName(), err)
+	}
+	return nil
+}
+
+// cloneMachineTemplate creates a clone of an infrastructure machine template
+// with another machine image, and returns the reference of the clone
+func cloneMachineTemplate(ctx context.Context, client crtclient.Client, namespace string, ref map[string]string, machineImage string) (map[string]string, error) {
+	template := &unstructured.Unstructured{}
+	template.SetAPIVersion(ref["apiVersion"])
+	template.SetKind(ref["kind"])
+	if err := client.Get(ctx, crtclient.ObjectKey{Namespace: namespace, Name: ref["name"]}, template); err != nil {
+		return nil, fmt.Errorf("cannot get %s %s: %v", ref["kind"], ref["name"], err)
+	}
+
+	clone := &unstructured.Unstructured{Object: map[string]interface{}{"spec": template.DeepCopy().Object["spec"]}}
+	clone.SetAPIVersion(template.GetAPIVersion())
+	clone.SetKind(template.GetKind())
+	clone.SetNamespace(namespace)
+	clone.SetName(fmt.Sprintf("%s-tkr-%d", upgradedTemplateSuffixRegexp.ReplaceAllString(template.GetName(), ""), time.Now().Unix()))
+	clone.SetLabels(template.GetLabels())
+	clone.SetOwnerReferences(template.GetOwnerReferences())
+
+	var imageField []string
+	switch template.GetKind() {
+	case "DockerMachineTemplate":
+		imageField = []string{"spec", "template", "spec", "customImage"}
+	case "AWSMachineTemplate":
+		imageField = []string{"spec", "template", "spec", "ami", "id"}
+	case "VSphereMachineTemplate":
+		imageField = []string{"spec", "template", "spec", "template"}
+	default:
+		return nil, fmt.Errorf("upgrading the machine image of %s is not supported", template.GetKind())
+	}
+	if err := unstructured.SetNestedField(clone.Object, machineImage, imageField...); err != nil {
+		return nil, err
+	}
+
+	if err := client.Create(ctx, clone); err != nil {
+		return nil, fmt.Errorf("cannot create %s %s: %v", clone.GetKind(), clone.GetName(), err)
+	}
+	return map[string]string{
+		"apiVersion": clone.GetAPIVersion(),
+		"kind":       clone.GetKind(),
+		"name":       clone.GetName(),
+		"namespace":  namespace,
+	}, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2020-2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	crtclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const dockerMachineTemplateAPIVersion = "infrastructure.cluster.x-k8s.io/v1alpha3"
+
+func objectKey(namespace, name string) crtclient.ObjectKey {
+	return crtclient.ObjectKey{Namespace: namespace, Name: name}
+}
+
+func newDockerMachineTemplate(name string) *unstructured.Unstructured {
+	return newObject(schema.FromAPIVersionAndKind(dockerMachineTemplateAPIVersion, "DockerMachineTemplate"), "default", name, map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{"customImage": "projects.registry.vmware.com/tkg/kind/node:v1.21.2_vmware.1"},
+			},
+		},
+	})
+}
+
+func newKubeadmControlPlane(clusterName string) *unstructured.Unstructured {
+	controlPlane := newObject(kubeadmControlPlaneListGVK.GroupVersion().WithKind("KubeadmControlPlane"), "default", clusterName+"-control-plane", map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": int64(1),
+			"version":  "v1.21.2+vmware.1",
+			"infrastructureTemplate": map[string]interface{}{
+				"apiVersion": dockerMachineTemplateAPIVersion,
+				"kind":       "DockerMachineTemplate",
+				"name":       clusterName + "-control-plane-tkr-1",
+			},
+			"kubeadmConfigSpec": map[string]interface{}{
+				"clusterConfiguration": map[string]interface{}{
+					"etcd": map[string]interface{}{
+						"local": map[string]interface{}{"imageTag": "v3.4.13_vmware.15"},
+					},
+				},
+			},
+		},
+		"status": map[string]interface{}{
+			"replicas":        int64(1),
+			"updatedReplicas": int64(1),
+			"readyReplicas":   int64(1),
+		},
+	})
+	controlPlane.SetLabels(map[string]string{clusterNameLabel: clusterName})
+	return controlPlane
+}
+
+func TestUpgradeCluster(t *testing.T) {
+	client := newFakeClient(t,
+		newObject(capiClusterListGVK.GroupVersion().WithKind("Cluster"), "default", "test", nil),
+		newKubeadmControlPlane("test"),
+		newDockerMachineTemplate("test-control-plane-tkr-1"),
+		newMachineDeployment("test", "test-md-0", 1),
+		newDockerMachineTemplate("test-md-0"),
+	)
+	release := &kubernetesRelease{
+		name:              "v1.22.2---vmware.1-tkg.1",
+		kubernetesVersion: "v1.22.2+vmware.1",
+		machineImage:      "projects.registry.vmware.com/tkg/kind/node:v1.22.2_vmware.1",
+		etcdImageTag:      "v3.5.0_vmware.1",
+	}
+
+	if err := upgradeCluster(context.Background(), client, "test", release, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	controlPlane := &unstructured.Unstructured{}
+	controlPlane.SetGroupVersionKind(kubeadmControlPlaneListGVK.GroupVersion().WithKind("KubeadmControlPlane"))
+	if err := client.Get(context.Background(), objectKey("default", "test-control-plane"), controlPlane); err != nil {
+		t.Fatal(err)
+	}
+	if version, _, _ := unstructured.NestedString(controlPlane.Object, "spec", "version"); version != release.kubernetesVersion {
+		t.Errorf("expected control plane version %s, got %s", release.kubernetesVersion, version)
+	}
+	if tag, _, _ := unstructured.NestedString(controlPlane.Object, "spec", "kubeadmConfigSpec", "clusterConfiguration", "etcd", "local", "imageTag"); tag != release.etcdImageTag {
+		t.Errorf("expected etcd image tag %s, got %s", release.etcdImageTag, tag)
+	}
+	// CoreDNS is not configured by the control plane, so its tag is not set
+	if _, found, _ := unstructured.NestedString(controlPlane.Object, "spec", "kubeadmConfigSpec", "clusterConfiguration", "dns", "imageTag"); found {
+		t.Error("expected the CoreDNS image tag not to be set")
+	}
+	name, _, _ := unstructured.NestedString(controlPlane.Object, "spec", "infrastructureTemplate", "name")
+	if !strings.HasPrefix(name, "test-control-plane-tkr-") || name == "test-control-plane-tkr-1" {
+		t.Errorf("expected a clone of the control plane template, got %s", name)
+	}
+	assertMachineImage(t, client, name, release.machineImage)
+
+	deployment := &unstructured.Unstructured{}
+	deployment.SetGroupVersionKind(machineDeploymentListGVK.GroupVersion().WithKind("MachineDeployment"))
+	if err := client.Get(context.Background(), objectKey("default", "test-md-0"), deployment); err != nil {
+		t.Fatal(err)
+	}
+	if version, _, _ := unstructured.NestedString(deployment.Object, "spec", "template", "spec", "version"); version != release.kubernetesVersion {
+		t.Errorf("expected worker version %s, got %s", release.kubernetesVersion, version)
+	}
+	name, _, _ = unstructured.NestedString(deployment.Object, "spec", "template", "spec", "infrastructureRef", "name")
+	if !strings.HasPrefix(name, "test-md-0-tkr-") {
+		t.Errorf("expected a clone of the worker template, got %s", name)
+	}
+	assertMachineImage(t, client, name, release.machineImage)
+
+	cluster := &unstructured.Unstructured{}
+	cluster.SetGroupVersionKind(capiClusterListGVK.GroupVersion().WithKind("Cluster"))
+	if err := client.Get(context.Background(), objectKey("default", "test"), cluster); err != nil {
+		t.Fatal(err)
+	}
+	if label := cluster.GetLabels()[tkrLabel]; label != release.name {
+		t.Errorf("expected cluster to be labelled with release %s, got %q", release.name, label)
+	}
+}
+
+func TestUpgradeClusterWithoutControlPlane(t *testing.T) {
+	client := newFakeClient(t, newMachineDeployment("test", "test-md-0", 1))
+
+	if err := upgradeCluster(context.Background(), client, "test", &kubernetesRelease{}, time.Second); err == nil {
+		t.Fatal("expected an error for a cluster without control plane")
+	}
+}
+
+func assertMachineImage(t *testing.T, client crtclient.Client, templateName, machineImage string) {
+	t.Helper()
+	template := &unstructured.Unstructured{}
+	template.SetAPIVersion(dockerMachineTemplateAPIVersion)
+	template.SetKind("DockerMachineTemplate")
+	if err := client.Get(context.Background(), objectKey("default", templateName), template); err != nil {
+		t.Fatal(err)
+	}
+	if image, _, _ := unstructured.NestedString(template.Object, "spec", "template", "spec", "customImage"); image != machineImage {
+		t.Errorf("expected machine image %s for template %s, got %s", machineImage, templateName, image)
+	}
+}